@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Endpoints are served under /api/v1, the original paths remain as aliases
+// with their original error format.
+const apiPrefix = "/api/v1"
+
+// An endpoint and its description in the OpenAPI document.
+type apiRoute struct {
+	Path        string
+	Methods     []string // GET when empty
+	Summary     string
+	Description string
+	Params      []apiParam
+	// Example values of the request body and response, used for their schema.
+	// Use oneOf for endpoints returning different types.
+	Request  any
+	Response any
+	// Not JSON, eg. text/event-stream
+	ContentType string
+	// Served as is at the original path, without the /api/v1 prefix
+	Legacy bool
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string // string, integer, number or boolean
+	Format      string // eg. date or int64
+	Enum        []string
+	Required    bool
+	// Sent as a header instead of a query parameter
+	Header bool
+}
+
+// Alternative responses in the OpenAPI document.
+type oneOf []any
+
+// Error body of /api/v1 endpoints.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Registered routes, in order, for the OpenAPI document
+var apiRoutes []apiRoute
+
+// Query parameters shared by the history endpoints
+var (
+	periodParam = apiParam{Name: "period", Description: "Defaults to day, /balance returns the live balance without a period", Type: "string", Enum: []string{"day", "month"}}
+	dateParam   = apiParam{Name: "date", Description: "Day or a day in the month, defaults to today", Type: "string", Format: "date"}
+	meterParam  = apiParam{Name: "meter", Description: "Meter serial, defaults to all meters", Type: "string"}
+)
+
+// Register the handler at /api/v1 and, for legacy routes, the original path.
+func handle(route apiRoute, handler http.HandlerFunc) {
+	if len(route.Methods) == 0 {
+		route.Methods = []string{http.MethodGet}
+	}
+	apiRoutes = append(apiRoutes, route)
+
+	methodChecked := func(w http.ResponseWriter, r *http.Request) {
+		allowed := slices.Contains(route.Methods, r.Method) ||
+			(r.Method == http.MethodHead && slices.Contains(route.Methods, http.MethodGet))
+		if !allowed {
+			w.Header().Set("Allow", strings.Join(route.Methods, ", "))
+			writeError(w, r, http.StatusMethodNotAllowed, "Use "+strings.Join(route.Methods, " or "))
+			return
+		}
+		handler(w, r)
+	}
+	http.HandleFunc(apiPrefix+route.Path, methodChecked)
+	if route.Legacy {
+		http.HandleFunc(route.Path, methodChecked)
+	}
+}
+
+func isAPIRequest(r *http.Request) bool {
+	return r.URL.Path == apiPrefix || strings.HasPrefix(r.URL.Path, apiPrefix+"/")
+}
+
+// Error in the envelope of /api/v1, or as {"error": "message"} on the original paths.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if !isAPIRequest(r) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": message,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(apiError{Error: apiErrorDetail{
+		Status:  status,
+		Code:    errorCode(status),
+		Message: message,
+	}})
+}
+
+// Machine readable code of an error status.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
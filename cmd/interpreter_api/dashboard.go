@@ -0,0 +1,33 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Single page dashboard using the /api/v1 endpoints
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// The dashboard for browsers at /, other clients keep getting the status message.
+func serveRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.ServeFileFS(w, r, dashboardFiles, "dashboard/index.html")
+		return
+	}
+
+	response := map[string]string{
+		"message": "European Smart Meter API",
+		"status":  "running",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// The page and its assets hold no data, so they load before the user authenticates.
+func isDashboardPath(r *http.Request) bool {
+	return r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/dashboard/")
+}
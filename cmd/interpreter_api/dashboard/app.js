@@ -0,0 +1,371 @@
+"use strict";
+
+// Dashboard for the interpreter API, using the live event stream and the history endpoints.
+// Reading timestamps are the meter's local time labelled as UTC, so they are shown with UTC getters.
+
+const HISTORY_REFRESH_MS = 5 * 60 * 1000;
+const GRID_CHART_SECONDS = 3600;
+
+const state = {
+  token: new URLSearchParams(location.search).get("token") || localStorage.getItem("esm-token") || "",
+  reading: null,
+  solar: null,
+  gridPoints: [],
+  solarPeriod: "day",
+};
+
+if (state.token) {
+  localStorage.setItem("esm-token", state.token);
+}
+
+// API helpers
+
+function apiURL(path, query = {}) {
+  const url = new URL("/api/v1" + path, location.origin);
+  for (const [name, value] of Object.entries(query)) {
+    url.searchParams.set(name, value);
+  }
+  if (state.token) {
+    url.searchParams.set("token", state.token);
+  }
+  return url;
+}
+
+async function api(path, query) {
+  const response = await fetch(apiURL(path, query));
+  if (response.status === 401 && !response.headers.has("WWW-Authenticate")) {
+    askToken();
+  }
+  const body = await response.json();
+  if (!response.ok) {
+    throw new Error(body.error ? body.error.message : response.statusText);
+  }
+  return body;
+}
+
+// Tokens are remembered in this browser, basic auth is handled by the browser itself
+function askToken() {
+  const token = prompt("This API requires a token");
+  if (token) {
+    localStorage.setItem("esm-token", token);
+    location.reload();
+  }
+}
+
+// Formatting
+
+function formatPower(watt) {
+  if (watt === null || watt === undefined || Number.isNaN(watt)) {
+    return "–";
+  }
+  if (Math.abs(watt) < 1000) {
+    return `${Math.round(watt)} W`;
+  }
+  return `${(watt / 1000).toFixed(2)} kW`;
+}
+
+function formatNumber(value, unit, digits = 2) {
+  if (value === null || value === undefined) {
+    return "–";
+  }
+  return `${value.toFixed(digits)} ${unit}`;
+}
+
+function meterTime(timestamp) {
+  return new Date(timestamp);
+}
+
+function meterDate(timestamp) {
+  return meterTime(timestamp).toISOString().slice(0, 10);
+}
+
+function clock(date) {
+  return date.toISOString().slice(11, 16);
+}
+
+function setText(id, text) {
+  document.getElementById(id).textContent = text;
+}
+
+// Live values
+
+function gridWatt(reading) {
+  return (reading.current_consumption_kw - reading.current_production_kw) * 1000;
+}
+
+function renderFlow() {
+  const reading = state.reading;
+  if (!reading) {
+    return;
+  }
+  const grid = gridWatt(reading);
+  const solar = state.solar ? state.solar.current_production_w : null;
+  const house = grid + (solar || 0);
+
+  setText("flow-grid", formatPower(Math.abs(grid)));
+  setText("flow-solar", solar === null ? "No inverter" : formatPower(solar));
+  setText("flow-house", formatPower(house));
+
+  const gridLine = document.getElementById("flow-grid-line");
+  gridLine.setAttribute("class", "flow-line");
+  if (Math.abs(grid) >= 10) {
+    gridLine.classList.add("active", grid > 0 ? "import" : "export");
+    gridLine.classList.toggle("reverse", grid < 0);
+  }
+  const solarLine = document.getElementById("flow-solar-line");
+  solarLine.setAttribute("class", "flow-line");
+  if (solar && solar >= 10) {
+    solarLine.classList.add("active", "solar");
+  }
+
+  setText("flow-direction", grid >= 0
+    ? `Importing ${formatPower(grid)} from the grid`
+    : `Exporting ${formatPower(-grid)} to the grid`);
+}
+
+function renderPhases() {
+  const reading = state.reading;
+  const container = document.getElementById("phases");
+  const phases = [1, 2, 3].filter((n) => n === 1 || reading[`l${n}_voltage_v`] > 0);
+  const nets = phases.map((n) => reading[`l${n}_consumption_kw`] - reading[`l${n}_production_kw`]);
+  // Scale to at least 3 kW so small loads do not fill the bar
+  const scale = Math.max(3, ...nets.map(Math.abs));
+
+  container.innerHTML = "";
+  phases.forEach((n, i) => {
+    const net = nets[i];
+    const width = Math.min(50, (Math.abs(net) / scale) * 50);
+    const phase = document.createElement("div");
+    phase.className = "phase";
+    phase.innerHTML = `
+      <div class="phase-label">
+        <strong>L${n}</strong>
+        <span>${formatPower(net * 1000)} · ${formatNumber(reading[`l${n}_voltage_v`], "V", 1)} · ${formatNumber(reading[`l${n}_current_a`], "A", 1)}</span>
+      </div>
+      <div class="phase-bar">
+        <span class="center"></span>
+        <span class="${net >= 0 ? "import" : "export"}" style="width: ${width}%"></span>
+      </div>`;
+    container.appendChild(phase);
+  });
+}
+
+function renderPeak(peak) {
+  setText("peak-average", formatPower(peak.average_w));
+  setText("peak-projected", formatPower(peak.projected_w));
+  setText("peak-month", formatPower(peak.month_peak_w));
+}
+
+function handleReading(reading) {
+  state.reading = reading;
+  renderFlow();
+  renderPhases();
+  setText("gas-total", formatNumber(reading.gas_consumption_m3, "m³", 3));
+  setText("updated", `Updated ${clock(meterTime(reading.timestamp))}`);
+  addGridPoint(reading);
+  drawGridChart();
+}
+
+function addGridPoint(reading) {
+  const time = meterTime(reading.timestamp).getTime();
+  const points = state.gridPoints;
+  if (points.length > 0 && time <= points[points.length - 1].time) {
+    return;
+  }
+  points.push({ time, watt: gridWatt(reading) });
+  while (points.length > 0 && points[0].time < time - GRID_CHART_SECONDS * 1000) {
+    points.shift();
+  }
+}
+
+// Charts
+
+function prepareCanvas(canvas) {
+  const ratio = window.devicePixelRatio || 1;
+  const width = canvas.clientWidth;
+  const height = canvas.clientHeight || Number(canvas.getAttribute("height"));
+  canvas.width = width * ratio;
+  canvas.height = height * ratio;
+  const context = canvas.getContext("2d");
+  context.scale(ratio, ratio);
+  context.clearRect(0, 0, width, height);
+  const style = getComputedStyle(document.documentElement);
+  context.font = "11px system-ui, sans-serif";
+  context.fillStyle = style.getPropertyValue("--muted");
+  context.strokeStyle = style.getPropertyValue("--line");
+  return { context, width, height, style };
+}
+
+function drawGridChart() {
+  const canvas = document.getElementById("grid-chart");
+  const { context, width, height, style } = prepareCanvas(canvas);
+  const points = state.gridPoints;
+  if (points.length < 2) {
+    return;
+  }
+
+  const left = 48, bottom = height - 18, top = 8;
+  const maxWatt = Math.max(500, ...points.map((p) => p.watt));
+  const minWatt = Math.min(0, ...points.map((p) => p.watt));
+  const start = points[0].time, end = points[points.length - 1].time;
+  const x = (time) => left + ((time - start) / Math.max(1, end - start)) * (width - left - 4);
+  const y = (watt) => top + ((maxWatt - watt) / (maxWatt - minWatt)) * (bottom - top);
+
+  // Zero line and labels
+  context.beginPath();
+  context.moveTo(left, y(0));
+  context.lineTo(width, y(0));
+  context.stroke();
+  context.fillText(formatPower(maxWatt), 0, top + 8);
+  context.fillText(formatPower(minWatt), 0, bottom);
+  context.fillText(clock(new Date(start)), left, height - 4);
+  const endLabel = clock(new Date(end));
+  context.fillText(endLabel, width - context.measureText(endLabel).width, height - 4);
+
+  // Import above and export below zero
+  for (const [color, clip] of [["--import", (w) => Math.max(0, w)], ["--export", (w) => Math.min(0, w)]]) {
+    context.beginPath();
+    context.moveTo(x(start), y(0));
+    for (const point of points) {
+      context.lineTo(x(point.time), y(clip(point.watt)));
+    }
+    context.lineTo(x(end), y(0));
+    context.closePath();
+    context.fillStyle = style.getPropertyValue(color);
+    context.fill();
+  }
+}
+
+function drawSolarChart(history) {
+  const canvas = document.getElementById("solar-chart");
+  const { context, width, height, style } = prepareCanvas(canvas);
+  const intervals = history.intervals || [];
+  if (intervals.length === 0) {
+    return;
+  }
+
+  const left = 48, bottom = height - 18, top = 8;
+  const maxKWH = Math.max(0.1, ...intervals.map((i) => i.production_kwh));
+  const slot = (width - left) / intervals.length;
+  context.fillText(formatNumber(maxKWH, "kWh"), 0, top + 8);
+
+  intervals.forEach((interval, i) => {
+    const barHeight = (interval.production_kwh / maxKWH) * (bottom - top);
+    context.fillStyle = style.getPropertyValue("--solar");
+    context.fillRect(left + i * slot + 1, bottom - barHeight, Math.max(1, slot - 2), barHeight);
+
+    // Label every few bars so they do not overlap
+    const every = Math.ceil(intervals.length / 12);
+    if (i % every === 0) {
+      const start = new Date(interval.start);
+      const label = state.solarPeriod === "day" ? clock(start) : String(start.getUTCDate());
+      context.fillStyle = style.getPropertyValue("--muted");
+      context.fillText(label, left + i * slot, height - 4);
+    }
+  });
+}
+
+// History
+
+async function loadToday() {
+  if (!state.reading) {
+    return;
+  }
+  const date = meterDate(state.reading.timestamp);
+  try {
+    const [balance, bill] = await Promise.all([
+      api("/balance", { period: "day", date }),
+      api("/bill", { period: "day", date }),
+    ]);
+    setText("today-import", formatNumber(balance.import_kwh, "kWh"));
+    setText("today-export", formatNumber(balance.export_kwh, "kWh"));
+    setText("today-solar", formatNumber(balance.solar_kwh, "kWh"));
+    setText("today-consumption", formatNumber(balance.consumption_kwh, "kWh"));
+    setText("today-sufficiency", formatNumber(balance.self_sufficiency_ratio * 100, "%", 0));
+    setText("today-cost", formatNumber(bill.total, bill.currency));
+    setText("gas-today", formatNumber(bill.gas_m3, "m³", 3));
+    setText("today-note", "");
+  } catch (error) {
+    setText("today-note", error.message);
+  }
+}
+
+async function loadSolarHistory() {
+  if (!state.reading) {
+    return;
+  }
+  try {
+    const history = await api("/solar/history", {
+      period: state.solarPeriod,
+      date: meterDate(state.reading.timestamp),
+    });
+    drawSolarChart(history);
+    setText("solar-note", `${formatNumber(history.production_kwh, "kWh")} produced, peak ${formatPower(history.peak_w)}`);
+  } catch (error) {
+    setText("solar-note", error.message);
+  }
+}
+
+async function loadRecentReadings() {
+  const latest = await api("/latest");
+  const since = Math.floor(meterTime(latest.timestamp).getTime() / 1000) - GRID_CHART_SECONDS;
+  const readings = await api("/since", { ts: since });
+  readings.forEach(addGridPoint);
+  handleReading(latest);
+}
+
+// Live stream, the browser reconnects and resumes after the last reading by itself
+
+function connect() {
+  const connection = document.getElementById("connection");
+  const events = new EventSource(apiURL("/events", { types: "readings,solar,peak" }));
+  events.onopen = () => connection.className = "dot live";
+  events.onerror = () => {
+    connection.className = "dot error";
+    setText("updated", "Reconnecting…");
+  };
+  events.addEventListener("readings", (event) => handleReading(JSON.parse(event.data)));
+  events.addEventListener("solar", (event) => {
+    state.solar = JSON.parse(event.data);
+    renderFlow();
+  });
+  events.addEventListener("peak", (event) => renderPeak(JSON.parse(event.data)));
+}
+
+async function start() {
+  document.querySelectorAll(".toggle button").forEach((button) => {
+    button.addEventListener("click", () => {
+      document.querySelectorAll(".toggle button").forEach((b) => b.classList.toggle("active", b === button));
+      state.solarPeriod = button.dataset.period;
+      loadSolarHistory();
+    });
+  });
+  window.addEventListener("resize", () => {
+    drawGridChart();
+    loadSolarHistory();
+  });
+
+  try {
+    await loadRecentReadings();
+  } catch (error) {
+    setText("updated", error.message);
+  }
+  try {
+    const solar = await api("/solar");
+    state.solar = { current_production_w: solar.active_power_w };
+    renderFlow();
+  } catch {
+    // No inverter configured or not read yet, the stream sends it once available
+  }
+  api("/peak").then(renderPeak).catch(() => {});
+
+  connect();
+  loadToday();
+  loadSolarHistory();
+  setInterval(() => {
+    loadToday();
+    loadSolarHistory();
+  }, HISTORY_REFRESH_MS);
+}
+
+start();
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Comments keep proxies from closing idle event streams
+const eventsKeepAliveInterval = 30 * time.Second
+
+// Server-sent event, readings carry their unix timestamp as id so clients can resume.
+func eventFrame(id int64, eventType string, data []byte) []byte {
+	var frame bytes.Buffer
+	if id > 0 {
+		fmt.Fprintf(&frame, "id: %d\n", id)
+	}
+	if eventType != "" {
+		fmt.Fprintf(&frame, "event: %s\n", eventType)
+	}
+	// JSON has no raw newlines, so the data always fits on one line
+	fmt.Fprintf(&frame, "data: %s\n\n", data)
+	return frame.Bytes()
+}
+
+// The /ws stream as server-sent events, with the same query parameters.
+// Readings after the Last-Event-ID header (or last_event_id parameter) are
+// sent from the reading buffer first.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	sub, err := subscriptionFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var resumeAfter int64
+	if lastEventID != "" {
+		if resumeAfter, err = strconv.ParseInt(lastEventID, 10, 64); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid Last-Event-ID, expected a unix timestamp")
+			return
+		}
+	}
+
+	client := wsClients.newClient(r.RemoteAddr, transportEvents, nil, sub)
+	if !wsClients.register(client) {
+		wsClients.refuse(w, r)
+		return
+	}
+	defer client.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+
+	stream, err := client.resume(sub, resumeAfter, func(message wsMessage) error {
+		controller.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if _, err := w.Write(message.data); err != nil {
+			return err
+		}
+		return controller.Flush()
+	})
+	if err != nil {
+		return
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case message := <-client.send:
+			if err := stream.sendQueued(message); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			controller.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-client.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreterpb"
+	"github.com/NotCoffee418/european_smart_meter/pkg/solarinverter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// gRPC interface next to the HTTP API. Streams are clients of the same hub as /ws and /events,
+// so they share its client limit, queueing and statistics.
+type grpcServer struct {
+	interpreterpb.UnimplementedInterpreterServer
+}
+
+// Serve gRPC with the TLS and authentication of the HTTP API, and reflection for grpcurl.
+func serveGRPC(address string) error {
+	cfg := config.ActiveInterpreterAPIConfig
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := grpcAuthenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := grpcAuthenticate(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+		// Streams to clients that stopped answering are closed, like websockets without pongs
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: wsPingPeriod, Timeout: wsWriteWait}),
+	}
+	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		tlsConfig, err := serverTLSConfig()
+		if err != nil {
+			return err
+		}
+		certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(options...)
+	interpreterpb.RegisterInterpreterServer(server, &grpcServer{})
+	reflection.Register(server)
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// A verified client certificate, or a token or basic auth credentials in the authorization metadata.
+func grpcAuthenticate(ctx context.Context) error {
+	if !authRequired() {
+		return nil
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			return nil
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		if isAuthorizationValid(authorization) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Authentication required")
+}
+
+func (s *grpcServer) GetLatest(ctx context.Context, req *interpreterpb.GetLatestRequest) (*interpreterpb.Reading, error) {
+	reading := p1Reader.GetLatestReading()
+	if reading == nil {
+		return nil, status.Error(codes.NotFound, "No readings available yet")
+	}
+	return readingMessage(reading), nil
+}
+
+func (s *grpcServer) StreamReadings(req *interpreterpb.StreamReadingsRequest, stream grpc.ServerStreamingServer[interpreterpb.Reading]) error {
+	sub := &wsSubscription{
+		Types:           []string{wsTypeReadings},
+		IntervalSeconds: req.IntervalSeconds,
+		ChangeOnly:      req.ChangeOnly,
+		Deadband:        req.Deadband,
+	}
+	if err := sub.validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	remoteAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+	client := wsClients.newClient(remoteAddr, transportGRPC, nil, sub)
+	if !wsClients.register(client) {
+		return status.Error(codes.ResourceExhausted, "Too many clients")
+	}
+	defer client.close()
+
+	resumed, err := client.resume(sub, req.ResumeAfter, func(message wsMessage) error {
+		return stream.Send(readingMessage(message.update.Reading))
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case message := <-client.send:
+			if err := resumed.sendQueued(message); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-client.done:
+			return nil
+		}
+	}
+}
+
+func (s *grpcServer) GetSolar(ctx context.Context, req *interpreterpb.GetSolarRequest) (*interpreterpb.Solar, error) {
+	solarStatus, err := solarinverter.GetStatus()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	solar := &interpreterpb.Solar{
+		ActivePowerW:     solarStatus.Snapshot.ActivePowerW,
+		DailyYieldWh:     solarStatus.Snapshot.DailyYieldWh,
+		LifetimeYieldWh:  solarStatus.Snapshot.LifetimeYieldWh,
+		ReadAt:           timestamppb.New(solarStatus.UpdatedAt),
+		AgeSeconds:       solarStatus.Age.Seconds(),
+		Stale:            solarStatus.Stale,
+		DeviceStatusText: solarStatus.Snapshot.DeviceStatusText,
+	}
+	if solarStatus.LastError != nil {
+		solar.LastError = solarStatus.LastError.Error()
+	}
+	return solar, nil
+}
+
+func readingMessage(reading *interpreter.RawMeterReading) *interpreterpb.Reading {
+	return &interpreterpb.Reading{
+		Timestamp:                reading.Timestamp,
+		Id:                       (&wsUpdate{Reading: reading}).id(),
+		CurrentConsumptionKw:     reading.CurrentConsumptionKW,
+		CurrentProductionKw:      reading.CurrentProductionKW,
+		L1ConsumptionKw:          reading.L1ConsumptionKW,
+		L2ConsumptionKw:          reading.L2ConsumptionKW,
+		L3ConsumptionKw:          reading.L3ConsumptionKW,
+		L1ProductionKw:           reading.L1ProductionKW,
+		L2ProductionKw:           reading.L2ProductionKW,
+		L3ProductionKw:           reading.L3ProductionKW,
+		TotalConsumptionDayKwh:   reading.TotalConsumptionDayKWH,
+		TotalConsumptionNightKwh: reading.TotalConsumptionNightKWH,
+		TotalProductionDayKwh:    reading.TotalProductionDayKWH,
+		TotalProductionNightKwh:  reading.TotalProductionNightKWH,
+		CurrentTariff:            int32(reading.CurrentTariff),
+		L1VoltageV:               reading.L1VoltageV,
+		L2VoltageV:               reading.L2VoltageV,
+		L3VoltageV:               reading.L3VoltageV,
+		L1CurrentA:               reading.L1CurrentA,
+		L2CurrentA:               reading.L2CurrentA,
+		L3CurrentA:               reading.L3CurrentA,
+		SwitchElectricity:        int32(reading.SwitchElectricity),
+		SwitchGas:                int32(reading.SwitchGas),
+		MeterSerialElectricity:   reading.MeterSerialElectricity,
+		MeterSerialGas:           reading.MeterSerialGas,
+		GasConsumptionM3:         reading.GasConsumptionM3,
+	}
+}
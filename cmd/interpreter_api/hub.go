@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Websocket and event stream clients each get a queue and their own writer, so a slow
+// client only delays itself and no connection is ever written from two goroutines.
+const (
+	wsWriteWait = 10 * time.Second
+	// Clients that do not answer pings within this time are disconnected
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// Clients only send subscriptions
+	wsMaxMessageSize = 4096
+)
+
+var errTooManyClients = errors.New("too many websocket clients")
+
+// How a client is connected, each gets its messages in its own format
+const (
+	transportWebSocket = "websocket"
+	transportEvents    = "events"
+	transportGRPC      = "grpc"
+)
+
+// Queued message, id is the reading timestamp for readings on /events
+type wsMessage struct {
+	id   int64
+	data []byte
+	// gRPC clients convert the update themselves
+	update *wsUpdate
+}
+
+type wsHub struct {
+	mutex      sync.Mutex
+	clients    map[*wsClient]struct{}
+	maxClients int
+	queueSize  int
+
+	connections atomic.Int64
+	rejected    atomic.Int64
+	sent        atomic.Int64
+	dropped     atomic.Int64
+}
+
+type wsClient struct {
+	hub       *wsHub
+	transport string
+	// nil for event stream and gRPC clients
+	conn      *websocket.Conn
+	send      chan wsMessage
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// nil for clients that did not subscribe
+	filterMutex sync.Mutex
+	filter      *wsFilter
+
+	remoteAddr  string
+	connectedAt time.Time
+	sent        atomic.Int64
+	dropped     atomic.Int64
+}
+
+// Websocket statistics, as shown on /ws/stats.
+type wsHubStats struct {
+	Clients             int             `json:"clients"`
+	MaxClients          int             `json:"max_clients"`
+	QueueSize           int             `json:"queue_size"`
+	TotalConnections    int64           `json:"total_connections"`
+	RejectedConnections int64           `json:"rejected_connections"`
+	MessagesSent        int64           `json:"messages_sent"`
+	MessagesDropped     int64           `json:"messages_dropped"`
+	Connected           []wsClientStats `json:"connected"`
+}
+
+type wsClientStats struct {
+	RemoteAddr      string          `json:"remote_addr"`
+	Transport       string          `json:"transport"` // websocket, events or grpc
+	ConnectedAt     time.Time       `json:"connected_at"`
+	Subscription    *wsSubscription `json:"subscription"`
+	Queued          int             `json:"queued"`
+	MessagesSent    int64           `json:"messages_sent"`
+	MessagesDropped int64           `json:"messages_dropped"`
+}
+
+func newWsHub(maxClients int, queueSize int) *wsHub {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &wsHub{
+		clients:    map[*wsClient]struct{}{},
+		maxClients: maxClients,
+		queueSize:  queueSize,
+	}
+}
+
+// Upgrade the request and register the client, subscribed when sub is not nil.
+// Refused clients get a 503 before the upgrade when the hub is full.
+func (h *wsHub) accept(w http.ResponseWriter, r *http.Request, sub *wsSubscription) (*wsClient, error) {
+	if h.full() {
+		h.refuse(w, r)
+		return nil, errTooManyClients
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := h.newClient(r.RemoteAddr, transportWebSocket, conn, sub)
+
+	// Another client may have taken the last place during the upgrade
+	if !h.register(client) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many clients"),
+			time.Now().Add(wsWriteWait))
+		conn.Close()
+		return nil, errTooManyClients
+	}
+	return client, nil
+}
+
+func (h *wsHub) newClient(remoteAddr string, transport string, conn *websocket.Conn, sub *wsSubscription) *wsClient {
+	client := &wsClient{
+		hub:         h,
+		transport:   transport,
+		conn:        conn,
+		send:        make(chan wsMessage, h.queueSize),
+		done:        make(chan struct{}),
+		remoteAddr:  remoteAddr,
+		connectedAt: time.Now(),
+	}
+	if sub != nil {
+		client.filter = newWsFilter(*sub)
+	}
+	return client
+}
+
+// Add the client, false when the hub is full.
+func (h *wsHub) register(client *wsClient) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.maxClients > 0 && len(h.clients) >= h.maxClients {
+		h.rejected.Add(1)
+		return false
+	}
+	h.clients[client] = struct{}{}
+	h.connections.Add(1)
+	return true
+}
+
+func (h *wsHub) refuse(w http.ResponseWriter, r *http.Request) {
+	h.rejected.Add(1)
+	writeError(w, r, http.StatusServiceUnavailable, "Too many clients")
+}
+
+func (h *wsHub) full() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.maxClients > 0 && len(h.clients) >= h.maxClients
+}
+
+func (h *wsHub) count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.clients)
+}
+
+// Queue the update for every client that wants it, never blocking on a slow one.
+func (h *wsHub) publish(update *wsUpdate) {
+	h.mutex.Lock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mutex.Unlock()
+
+	now := time.Now()
+	for _, client := range clients {
+		if message, ok := client.render(update, now); ok {
+			client.enqueue(message)
+		}
+	}
+}
+
+func (h *wsHub) remove(client *wsClient) {
+	h.mutex.Lock()
+	delete(h.clients, client)
+	h.mutex.Unlock()
+}
+
+func (h *wsHub) stats() wsHubStats {
+	h.mutex.Lock()
+	connected := make([]wsClientStats, 0, len(h.clients))
+	for client := range h.clients {
+		client.filterMutex.Lock()
+		var sub *wsSubscription
+		if client.filter != nil {
+			sub = &client.filter.sub
+		}
+		client.filterMutex.Unlock()
+		connected = append(connected, wsClientStats{
+			RemoteAddr:      client.remoteAddr,
+			Transport:       client.transport,
+			ConnectedAt:     client.connectedAt,
+			Subscription:    sub,
+			Queued:          len(client.send),
+			MessagesSent:    client.sent.Load(),
+			MessagesDropped: client.dropped.Load(),
+		})
+	}
+	h.mutex.Unlock()
+
+	return wsHubStats{
+		Clients:             len(connected),
+		MaxClients:          h.maxClients,
+		QueueSize:           h.queueSize,
+		TotalConnections:    h.connections.Load(),
+		RejectedConnections: h.rejected.Load(),
+		MessagesSent:        h.sent.Load(),
+		MessagesDropped:     h.dropped.Load(),
+		Connected:           connected,
+	}
+}
+
+func (c *wsClient) render(update *wsUpdate, now time.Time) (wsMessage, bool) {
+	c.filterMutex.Lock()
+	defer c.filterMutex.Unlock()
+	return c.format(c.filter, update, now)
+}
+
+// Message for the update according to filter, false when it is skipped.
+// Websocket clients get JSON, event stream clients a server-sent event
+// and gRPC clients the update itself.
+func (c *wsClient) format(filter *wsFilter, update *wsUpdate, now time.Time) (wsMessage, bool) {
+	message := wsMessage{id: update.id()}
+	if filter == nil {
+		data := update.legacyMessage()
+		if data == nil {
+			return message, false
+		}
+		message.data = data
+		if c.transport == transportEvents {
+			message.data = eventFrame(message.id, "", data)
+		}
+		return message, true
+	}
+
+	payload := filter.render(update, now)
+	if payload == nil {
+		return message, false
+	}
+	switch c.transport {
+	case transportEvents:
+		data, _ := json.Marshal(payload)
+		message.data = eventFrame(message.id, update.Type, data)
+	case transportGRPC:
+		message.update = update
+	default:
+		message.data, _ = json.Marshal(wsEnvelope{Type: update.Type, Data: payload})
+	}
+	return message, true
+}
+
+// Replace the subscription, answering with the subscription or the error.
+func (c *wsClient) subscribe(message []byte) {
+	var request wsRequest
+	err := json.Unmarshal(message, &request)
+	if err == nil && request.Action != "subscribe" {
+		err = fmt.Errorf("unknown action %q", request.Action)
+	}
+	if err == nil {
+		err = request.wsSubscription.validate()
+	}
+	if err != nil {
+		data, _ := json.Marshal(wsEnvelope{Type: "error", Error: err.Error()})
+		c.enqueue(wsMessage{data: data})
+		return
+	}
+
+	c.filterMutex.Lock()
+	c.filter = newWsFilter(request.wsSubscription)
+	c.filterMutex.Unlock()
+	data, _ := json.Marshal(wsEnvelope{Type: "subscribed", Data: request.wsSubscription})
+	c.enqueue(wsMessage{data: data})
+}
+
+// Queue a message, dropping the oldest queued one when the client fell behind.
+// Live readings are only useful while recent, so the newest message is kept.
+func (c *wsClient) enqueue(message wsMessage) {
+	for {
+		select {
+		case c.send <- message:
+			return
+		case <-c.done:
+			return
+		default:
+		}
+		select {
+		case <-c.send:
+			c.dropped.Add(1)
+			c.hub.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Serve the client until it disconnects or stops answering pings.
+func (c *wsClient) run() {
+	go c.writePump()
+	c.readPump()
+}
+
+// Incoming messages are subscriptions, reading is also needed to process pongs and closes.
+func (c *wsClient) readPump() {
+	defer c.close()
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		c.subscribe(message)
+	}
+}
+
+// The only goroutine writing to the connection.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer c.close()
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
+				return
+			}
+			c.sent.Add(1)
+			c.hub.sent.Add(1)
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.hub.remove(c)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	})
+}
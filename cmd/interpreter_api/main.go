@@ -5,29 +5,62 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/dayahead"
+	"github.com/NotCoffee418/european_smart_meter/pkg/deviceemulation"
+	"github.com/NotCoffee418/european_smart_meter/pkg/energybalance"
+	"github.com/NotCoffee418/european_smart_meter/pkg/energycost"
 	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/loadcontrol"
+	"github.com/NotCoffee418/european_smart_meter/pkg/mdns"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+	"github.com/NotCoffee418/european_smart_meter/pkg/ocpp"
+	"github.com/NotCoffee418/european_smart_meter/pkg/pathing"
 	"github.com/NotCoffee418/european_smart_meter/pkg/port_reader"
+	"github.com/NotCoffee418/european_smart_meter/pkg/readingbuffer"
+	"github.com/NotCoffee418/european_smart_meter/pkg/rules"
 	"github.com/NotCoffee418/european_smart_meter/pkg/solarinverter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/virtualmeter"
 	"github.com/gorilla/websocket"
 )
 
-var p1Reader *port_reader.P1Reader
+var (
+	p1Reader      *port_reader.P1Reader
+	readingBuffer *readingbuffer.RingBuffer
+	// nil when load control is disabled
+	loadController *loadcontrol.Controller
+	// nil when the OCPP central system is disabled
+	centralSystem *ocpp.CentralSystem
+	// nil when the virtual meter is disabled
+	virtualMeter *virtualmeter.Meter
+	// nil when device emulation is disabled
+	deviceEmulator *deviceemulation.Emulator
+	ruleEngine     *rules.Engine
+	peakTracker    = energycost.NewPeakTracker()
+	startedAt      = time.Now()
+)
+
+// Without a reading for this long /health reports degraded, the meter sends one every second
+const readingStaleAfter = 30 * time.Second
+
+const readingBufferSaveInterval = 10 * time.Minute
 
+// Origins are also checked by withSecurity, this covers handlers used without it
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins in development
-	},
+	CheckOrigin: isOriginAllowed,
 }
 
 // ws clients for broadcasting live readings
-var (
-	wsClients                   = make(map[*websocket.Conn]bool)
-	wsClientsMutex sync.RWMutex = sync.RWMutex{}
-)
+var wsClients *wsHub
 
 func main() {
 	// Load config
@@ -35,6 +68,86 @@ func main() {
 		log.Fatalf("Failed to load interpreter API config: %v", err)
 	}
 
+	if err := config.LoadTariffConfig(); err != nil {
+		log.Fatalf("Failed to load tariff config: %v", err)
+	}
+
+	if err := config.LoadLoadControlConfig(); err != nil {
+		log.Fatalf("Failed to load load control config: %v", err)
+	}
+
+	if err := config.LoadRulesConfig(); err != nil {
+		log.Fatalf("Failed to load rules config: %v", err)
+	}
+
+	wsClients = newWsHub(config.ActiveInterpreterAPIConfig.WebSocketMaxClients, config.ActiveInterpreterAPIConfig.WebSocketQueueSize)
+
+	// Recent readings so clients can fill gaps after reconnecting
+	readingBuffer = readingbuffer.NewRingBuffer(config.ActiveInterpreterAPIConfig.ReadingBufferSize)
+	if config.ActiveInterpreterAPIConfig.PersistReadingBuffer {
+		if err := readingBuffer.LoadFromFile(pathing.GetReadingBufferPath()); err != nil {
+			log.Printf("Failed to restore reading buffer: %v", err)
+		}
+		go persistReadingBuffer()
+	}
+
+	// Inverter reads can take over 30 seconds, so they never happen on the request path
+	if solarinverter.IsModbusConfigured() {
+		interval := time.Duration(config.ActiveInterpreterAPIConfig.SolarPollIntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		if err := solarinverter.StartPoller(interval, publishSolarProduction); err != nil {
+			log.Printf("Solar inverter polling disabled: %v", err)
+		}
+	}
+
+	// Invalid rules are logged, the engine starts without rules and picks up the fixed file
+	ruleEngine, _ = rules.NewEngine(&config.RulesConfig{})
+	if err := ruleEngine.SetRules(config.ActiveRulesConfig); err != nil {
+		log.Printf("Failed to load rules: %v", err)
+	}
+	ruleEngine.SetEventHandler(func(event *rules.Event) {
+		wsClients.publish(&wsUpdate{Type: wsTypeEvents, Data: event})
+	})
+	go ruleEngine.Run(config.GetRulesConfigPath())
+
+	// Wallboxes connect to the central system, the ocpp actuator controls them through it
+	var chargePoints loadcontrol.ChargePoints
+	if config.ActiveInterpreterAPIConfig.OCPPEnabled {
+		cfg := config.ActiveInterpreterAPIConfig
+		centralSystem = ocpp.NewCentralSystem(cfg.OCPPChargePointIDs, cfg.OCPPChargePointPasswords)
+		if authRequired() && len(cfg.OCPPChargePointPasswords) == 0 {
+			log.Println("Warning: OCPP charge points connect without authentication, set ocpp_charge_point_passwords")
+		}
+		chargePoints = centralSystem
+	}
+
+	// Battery or EV charger driven by the net grid power
+	if config.ActiveLoadControlConfig.Enabled {
+		actuator, err := loadcontrol.NewActuator(&config.ActiveLoadControlConfig.Actuator, chargePoints)
+		if err != nil {
+			log.Fatalf("Failed to create load control actuator: %v", err)
+		}
+		if loadController, err = loadcontrol.NewController(config.ActiveLoadControlConfig, actuator); err != nil {
+			log.Fatalf("Failed to create load controller: %v", err)
+		}
+		go loadController.Run(time.Duration(max(config.ActiveLoadControlConfig.IntervalSeconds, 1)) * time.Second)
+	}
+
+	// Inverters and batteries read the P1 values as if from their own energy meter
+	if config.ActiveInterpreterAPIConfig.VirtualMeterPort > 0 {
+		var err error
+		if virtualMeter, err = virtualmeter.New(config.ActiveInterpreterAPIConfig.VirtualMeterProfile); err != nil {
+			log.Fatalf("Failed to create virtual meter: %v", err)
+		}
+	}
+
+	// Apps and batteries read the P1 values as if from a HomeWizard or Shelly meter
+	if config.ActiveInterpreterAPIConfig.DeviceEmulationPort > 0 {
+		deviceEmulator = deviceemulation.New()
+	}
+
 	// Start P1 reader
 	p1Reader = port_reader.NewP1Reader(
 		config.ActiveInterpreterAPIConfig.SerialDevice,
@@ -44,7 +157,20 @@ func main() {
 	// Start reading P1 port and handle signals/errors
 	go p1Reader.StartReading(
 		func(reading *interpreter.RawMeterReading) {
+			readingBuffer.Add(reading)
+			if virtualMeter != nil {
+				virtualMeter.Update(reading)
+			}
+			if deviceEmulator != nil {
+				deviceEmulator.Update(reading)
+			}
+			if loadController != nil {
+				loadController.HandleReading(reading)
+			}
+			ruleEngine.HandleReading(reading)
+			peak := peakTracker.Update(reading, time.Now())
 			BroadcastToWebSockets(reading)
+			wsClients.publish(&wsUpdate{Type: wsTypePeak, Data: peak})
 		},
 		func(err error) {
 			if err != nil {
@@ -54,99 +180,668 @@ func main() {
 	)
 
 	// Setup HTTP handlers
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		response := map[string]string{
-			"message": "European Smart Meter API",
-			"status":  "running",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	})
+	http.HandleFunc("/", serveRoot)
+	http.Handle("/dashboard/", http.FileServerFS(dashboardFiles))
 
-	http.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+	handle(apiRoute{
+		Path:     "/latest",
+		Summary:  "Latest reading from the smart meter",
+		Response: interpreter.RawMeterReading{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
 		reading := p1Reader.GetLatestReading()
 		w.Header().Set("Content-Type", "application/json")
 		if reading == nil {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "No readings available yet",
-			})
+			writeError(w, r, http.StatusNotFound, "No readings available yet")
 			return
 		}
 
 		json.NewEncoder(w).Encode(reading)
 	})
 
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+	// Readings after ts (unix seconds) still held in the buffer, oldest first.
+	handle(apiRoute{
+		Path:        "/since",
+		Summary:     "Buffered readings after a time",
+		Description: "Readings after ts still held in the buffer, oldest first. Used to fill gaps after reconnecting.",
+		Params: []apiParam{
+			{Name: "ts", Description: "Unix timestamp", Type: "integer", Format: "int64", Required: true},
+		},
+		Response: []interpreter.RawMeterReading{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		since, err := strconv.ParseInt(r.URL.Query().Get("ts"), 10, 64)
 		if err != nil {
-			log.Printf("WebSocket upgrade error: %v", err)
+			writeError(w, r, http.StatusBadRequest, "Query parameter ts must be a unix timestamp")
 			return
 		}
 
-		AddWebSocketClient(conn)
+		json.NewEncoder(w).Encode(readingBuffer.Since(since))
+	})
+
+	handle(apiRoute{
+		Path:        "/ws",
+		Summary:     "Websocket stream of readings",
+		Description: "Upgrades to a websocket. Without subscription parameters every reading is sent, subscriptions can also be sent as {\"action\": \"subscribe\", ...} messages.",
+		Params:      subscriptionParams,
+		Legacy:      true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		sub, err := subscriptionFromQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		client, err := wsClients.accept(w, r, sub)
+		if err != nil {
+			log.Printf("WebSocket upgrade error: %v", err)
+			return
+		}
 
 		// Send current reading immediately if available
 		if reading := p1Reader.GetLatestReading(); reading != nil {
-			conn.WriteMessage(websocket.TextMessage, reading.ToJsonBytes())
+			if message, ok := client.render(&wsUpdate{Type: wsTypeReadings, Reading: reading}, time.Now()); ok {
+				client.enqueue(message)
+			}
 		}
+		client.run()
+	})
 
-		// Keep connection alive
-		for {
-			_, _, err := conn.ReadMessage()
+	// The /ws stream as server-sent events for clients without websockets
+	handle(apiRoute{
+		Path:        "/events",
+		Summary:     "Server-sent event stream of readings",
+		Description: "The websocket stream as server-sent events. Readings carry their unix timestamp as id, missed readings are resent after Last-Event-ID.",
+		Params: append(slices.Clone(subscriptionParams),
+			apiParam{Name: "Last-Event-ID", Description: "Resume after this reading", Type: "integer", Format: "int64", Header: true},
+			apiParam{Name: "last_event_id", Description: "Resume after this reading, for clients that cannot set headers", Type: "integer", Format: "int64"},
+		),
+		ContentType: "text/event-stream",
+		Legacy:      true,
+	}, serveEvents)
+
+	// Average import of the current quarter hour and the month peak for capacity tariffs
+	handle(apiRoute{
+		Path:     "/peak",
+		Summary:  "Capacity tariff peak",
+		Response: energycost.PeakStatus{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(peakTracker.Status(time.Now()))
+	})
+
+	// Connected websocket clients and the messages dropped for falling behind
+	handle(apiRoute{
+		Path:     "/ws/stats",
+		Summary:  "Connected stream clients",
+		Response: wsHubStats{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(wsClients.stats())
+	})
+
+	// Cost of the current power flow per hour, based on the configured tariffs.
+	handle(apiRoute{
+		Path:     "/cost",
+		Summary:  "Cost of the current power flow per hour",
+		Response: energycost.LiveCost{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		reading := p1Reader.GetLatestReading()
+		if reading == nil {
+			writeError(w, r, http.StatusNotFound, "No readings available yet")
+			return
+		}
+
+		cost, err := energycost.CalculateLiveCost(config.ActiveTariffConfig, reading)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(cost)
+	})
+
+	// Daily or monthly bill from the meter database.
+	// ?period=day|month&date=YYYY-MM-DD&meter=SERIAL, meter defaults to all meters.
+	handle(apiRoute{
+		Path:     "/bill",
+		Summary:  "Daily or monthly bill",
+		Params:   []apiParam{periodParam, dateParam, meterParam},
+		Response: energycost.Bill{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !meterdb.IsAvailable() {
+			writeError(w, r, http.StatusServiceUnavailable, "Meter database not available, is meter_collector installed?")
+			return
+		}
+
+		query := r.URL.Query()
+		date := time.Now()
+		if dateParam := query.Get("date"); dateParam != "" {
+			parsed, err := time.Parse(time.DateOnly, dateParam)
 			if err != nil {
-				RemoveWebSocketClient(conn)
-				break
+				writeError(w, r, http.StatusBadRequest, "Query parameter date must be formatted as YYYY-MM-DD")
+				return
 			}
+			date = parsed
+		}
+
+		var bill *energycost.Bill
+		var err error
+		switch query.Get("period") {
+		case "", "day":
+			bill, err = energycost.DailyBill(config.ActiveTariffConfig, query.Get("meter"), date)
+		case "month":
+			bill, err = energycost.MonthlyBill(config.ActiveTariffConfig, query.Get("meter"), date)
+		default:
+			writeError(w, r, http.StatusBadRequest, "Query parameter period must be day or month")
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
 		}
+		json.NewEncoder(w).Encode(bill)
 	})
 
-	// May be fast or slow depending on cached response from inverter.
-	http.HandleFunc("/solar", func(w http.ResponseWriter, r *http.Request) {
+	// Self-consumption and self-sufficiency with solar production.
+	// Without a period the live balance is returned, combining the latest reading with the inverter.
+	// ?period=day|month&date=YYYY-MM-DD&meter=SERIAL returns the balance stored by meter_collector.
+	handle(apiRoute{
+		Path:        "/balance",
+		Summary:     "Self-consumption and self-sufficiency",
+		Description: "Without a period the live balance from the latest reading and the inverter, otherwise the stored balance of the day or month. The live balance fails with 503 while the inverter snapshot is stale.",
+		Params:      []apiParam{periodParam, dateParam, meterParam},
+		Response:    oneOf{energybalance.LiveBalance{}, energybalance.PeriodBalance{}},
+		Legacy:      true,
+	}, func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		power, err := solarinverter.ReadSolarData()
+		query := r.URL.Query()
+
+		if query.Get("period") == "" {
+			reading := p1Reader.GetLatestReading()
+			if reading == nil {
+				writeError(w, r, http.StatusNotFound, "No readings available yet")
+				return
+			}
+			solar, err := solarinverter.GetStatus()
+			if err != nil {
+				writeError(w, r, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			// The poller keeps the last snapshot of an unreachable inverter
+			if solar.Stale {
+				writeError(w, r, http.StatusServiceUnavailable, fmt.Sprintf("Solar inverter not read for %.0f seconds", solar.Age.Seconds()))
+				return
+			}
+			json.NewEncoder(w).Encode(energybalance.CalculateLive(reading, solar.Snapshot.ActivePowerW))
+			return
+		}
+
+		if !meterdb.IsAvailable() {
+			writeError(w, r, http.StatusServiceUnavailable, "Meter database not available, is meter_collector installed?")
+			return
+		}
+
+		date := time.Now()
+		if dateParam := query.Get("date"); dateParam != "" {
+			parsed, err := time.Parse(time.DateOnly, dateParam)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Query parameter date must be formatted as YYYY-MM-DD")
+				return
+			}
+			date = parsed
+		}
+
+		var balance *energybalance.PeriodBalance
+		var err error
+		switch query.Get("period") {
+		case "day":
+			balance, err = energybalance.DailyBalance(query.Get("meter"), date)
+		case "month":
+			balance, err = energybalance.MonthlyBalance(query.Get("meter"), date)
+		default:
+			writeError(w, r, http.StatusBadRequest, "Query parameter period must be day or month")
+			return
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": err.Error(),
-			})
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(balance)
+	})
+
+	// Current and upcoming day-ahead prices imported by meter_collector.
+	// ?hours=N limits how far ahead to look, defaults to 48.
+	handle(apiRoute{
+		Path:    "/prices",
+		Summary: "Current and upcoming day-ahead prices",
+		Params: []apiParam{
+			{Name: "hours", Description: "How far ahead to look, defaults to 48", Type: "integer"},
+		},
+		Response: pricesResponse{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !meterdb.IsAvailable() {
+			writeError(w, r, http.StatusServiceUnavailable, "Meter database not available, is meter_collector installed?")
 			return
 		}
-		json.NewEncoder(w).Encode(map[string]int32{
-			"currentProduction": power,
+
+		hours := 48
+		if hoursParam := r.URL.Query().Get("hours"); hoursParam != "" {
+			parsed, err := strconv.Atoi(hoursParam)
+			if err != nil || parsed <= 0 {
+				writeError(w, r, http.StatusBadRequest, "Query parameter hours must be a positive number")
+				return
+			}
+			hours = parsed
+		}
+
+		// Prices are stored in meter time, follow the meter clock when we have it
+		now := dayahead.LocalAsUTC(time.Now(), dayahead.LoadLocation(config.ActiveTariffConfig.Timezone))
+		if reading := p1Reader.GetLatestReading(); reading != nil {
+			if readingTime, err := time.Parse(time.RFC3339, reading.Timestamp); err == nil {
+				now = readingTime
+			}
+		}
+
+		prices, err := dayahead.DatabaseProvider{}.GetPrices(now, now.Add(time.Duration(hours)*time.Hour))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		contractPrices := energycost.ContractPrices(config.ActiveTariffConfig, prices)
+		var current *energycost.ContractPrice
+		upcoming := contractPrices
+		if len(prices) > 0 && !prices[0].Start.After(now) {
+			current = contractPrices[0]
+			upcoming = contractPrices[1:]
+		}
+		json.NewEncoder(w).Encode(pricesResponse{
+			Currency: config.ActiveTariffConfig.Currency,
+			Current:  current,
+			Upcoming: upcoming,
+		})
+	})
+
+	// Load control status, POST a JSON object with the settings to change, eg. {"mode": "peak_shaving"}.
+	handle(apiRoute{
+		Path:        "/control",
+		Methods:     []string{http.MethodGet, http.MethodPost},
+		Summary:     "Load control status and settings",
+		Description: "POST the settings to change, eg. {\"mode\": \"peak_shaving\"}.",
+		Request:     loadcontrol.Settings{},
+		Response:    loadcontrol.Status{},
+		Legacy:      true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if loadController == nil {
+			writeError(w, r, http.StatusServiceUnavailable, "Load control is disabled, enable it in load_control.toml")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var settings loadcontrol.Settings
+			if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+				writeError(w, r, http.StatusBadRequest, "Invalid settings: "+err.Error())
+				return
+			}
+			if err := loadController.Update(&settings); err != nil {
+				writeError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+		default:
+			writeError(w, r, http.StatusMethodNotAllowed, "Use GET or POST")
+			return
+		}
+		json.NewEncoder(w).Encode(loadController.Status())
+	})
+
+	// Enabled rules from rules.toml and whether they are firing.
+	handle(apiRoute{
+		Path:     "/rules",
+		Summary:  "Notification rules and whether they are firing",
+		Response: []rules.RuleStatus{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ruleEngine.Status())
+	})
+
+	// Charge points connect with OCPP 1.6J on /ocpp/{chargePointId}, /ocpp lists the connected ones.
+	handle(apiRoute{
+		Path:     "/ocpp",
+		Summary:  "Connected OCPP charge points",
+		Response: []ocpp.ChargePointStatus{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if centralSystem == nil {
+			writeError(w, r, http.StatusServiceUnavailable, "OCPP is disabled, enable it in interpreter_api.toml")
+			return
+		}
+		json.NewEncoder(w).Encode(centralSystem.ChargePoints())
+	})
+	http.HandleFunc("/ocpp/", func(w http.ResponseWriter, r *http.Request) {
+		if centralSystem == nil {
+			writeError(w, r, http.StatusServiceUnavailable, "OCPP is disabled")
+			return
+		}
+		centralSystem.ServeHTTP(w, r)
+	})
+
+	// Latest inverter snapshot from the background poller, returns immediately.
+	// stale is true when the inverter could not be read for three poll intervals.
+	handle(apiRoute{
+		Path:        "/solar",
+		Summary:     "Latest solar inverter snapshot",
+		Description: "The original /solar path also returns currentProduction and lifetimeYieldWh.",
+		Response:    solarResponse{},
+		Legacy:      true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status, err := solarinverter.GetStatus()
+		if err != nil {
+			writeError(w, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		lastError := ""
+		if status.LastError != nil {
+			lastError = status.LastError.Error()
+		}
+		response := solarResponse{
+			AgeSeconds:       math.Round(status.Age.Seconds()*10) / 10,
+			Stale:            status.Stale,
+			LastError:        lastError,
+			InverterSnapshot: status.Snapshot,
+		}
+		if isAPIRequest(r) {
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		// currentProduction and lifetimeYieldWh are kept for existing clients
+		json.NewEncoder(w).Encode(struct {
+			CurrentProduction int32 `json:"currentProduction"`
+			LifetimeYieldWh   int64 `json:"lifetimeYieldWh"`
+			solarResponse
+		}{
+			CurrentProduction: status.Snapshot.ActivePowerW,
+			LifetimeYieldWh:   status.Snapshot.LifetimeYieldWh,
+			solarResponse:     response,
 		})
 	})
 
+	// Solar production per hour of a day or per day of a month, stored by meter_collector.
+	// ?period=day|month&date=YYYY-MM-DD&meter=SERIAL, meter defaults to all meters.
+	handle(apiRoute{
+		Path:     "/solar/history",
+		Summary:  "Solar production per hour of a day or day of a month",
+		Params:   []apiParam{periodParam, dateParam, meterParam},
+		Response: energybalance.SolarHistory{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !meterdb.IsAvailable() {
+			writeError(w, r, http.StatusServiceUnavailable, "Meter database not available, is meter_collector installed?")
+			return
+		}
+
+		query := r.URL.Query()
+		date := time.Now()
+		if dateParam := query.Get("date"); dateParam != "" {
+			parsed, err := time.Parse(time.DateOnly, dateParam)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Query parameter date must be formatted as YYYY-MM-DD")
+				return
+			}
+			date = parsed
+		}
+
+		var history *energybalance.SolarHistory
+		var err error
+		switch query.Get("period") {
+		case "", "day":
+			history, err = energybalance.DailySolarHistory(query.Get("meter"), date)
+		case "month":
+			history, err = energybalance.MonthlySolarHistory(query.Get("meter"), date)
+		default:
+			writeError(w, r, http.StatusBadRequest, "Query parameter period must be day or month")
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(history)
+	})
+
+	// Stored solar readings, ?from=UNIX_TIMESTAMP&to=UNIX_TIMESTAMP&meter=SERIAL.
+	// At most a day is returned, to defaults to a day after from.
+	handle(apiRoute{
+		Path:    "/solar/readings",
+		Summary: "Stored solar readings, at most a day",
+		Params: []apiParam{
+			{Name: "from", Description: "Unix timestamp", Type: "integer", Format: "int64", Required: true},
+			{Name: "to", Description: "Unix timestamp, defaults to a day after from", Type: "integer", Format: "int64"},
+			meterParam,
+		},
+		Response: []meterdb.MeterDbSolarProductionReading{},
+		Legacy:   true,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !meterdb.IsAvailable() {
+			writeError(w, r, http.StatusServiceUnavailable, "Meter database not available, is meter_collector installed?")
+			return
+		}
+
+		query := r.URL.Query()
+		from, err := strconv.ParseInt(query.Get("from"), 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Query parameter from must be a unix timestamp")
+			return
+		}
+		to := from + 24*3600
+		if toParam := query.Get("to"); toParam != "" {
+			parsed, err := strconv.ParseInt(toParam, 10, 64)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Query parameter to must be a unix timestamp")
+				return
+			}
+			to = min(parsed, to)
+		}
+
+		readings, err := meterdb.GetSolarProductionReadings(query.Get("meter"), from, to)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(readings)
+	})
+
+	// 503 when no reading arrived recently, for container and uptime checks.
+	handle(apiRoute{
+		Path:        "/health",
+		Summary:     "Whether readings are arriving from the meter",
+		Description: "Responds with 503 and status degraded when no reading arrived for 30 seconds.",
+		Response:    healthResponse{},
+	}, func(w http.ResponseWriter, r *http.Request) {
+		response := healthResponse{
+			Status:           "ok",
+			UptimeSeconds:    math.Round(time.Since(startedAt).Seconds()),
+			SolarConfigured:  solarinverter.IsModbusConfigured(),
+			MeterDatabase:    meterdb.IsAvailable(),
+			WebSocketClients: wsClients.count(),
+		}
+		if reading := p1Reader.GetLatestReading(); reading != nil {
+			response.LastReading = reading.Timestamp
+			age := math.Round(time.Since(p1Reader.GetLatestReadingTime()).Seconds()*10) / 10
+			response.LastReadingAgeSeconds = &age
+		}
+		if status, err := solarinverter.GetStatus(); err == nil {
+			response.SolarStale = status.Stale
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if response.LastReadingAgeSeconds == nil || *response.LastReadingAgeSeconds > readingStaleAfter.Seconds() {
+			response.Status = "degraded"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+
+	handle(apiRoute{
+		Path:    "/openapi.json",
+		Summary: "This OpenAPI document",
+	}, serveOpenAPI)
+	// Unknown /api/v1 paths, the original paths fall through to /
+	http.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "Unknown endpoint, see "+apiPrefix+"/openapi.json")
+	})
+
 	listener := fmt.Sprintf("%s:%d", config.ActiveInterpreterAPIConfig.ListenAddress, config.ActiveInterpreterAPIConfig.ListenPort)
 
-	log.Printf("Starting European Smart Meter Interpreter API on %s", listener)
-	log.Fatal(http.ListenAndServe(listener, nil))
-}
+	if port := config.ActiveInterpreterAPIConfig.GRPCListenPort; port > 0 {
+		grpcListener := fmt.Sprintf("%s:%d", config.ActiveInterpreterAPIConfig.ListenAddress, port)
+		go func() {
+			log.Printf("Starting gRPC server on %s", grpcListener)
+			log.Fatal(serveGRPC(grpcListener))
+		}()
+	}
 
-func BroadcastToWebSockets(reading *interpreter.RawMeterReading) {
-	wsClientsMutex.RLock()
-	clients := make([]*websocket.Conn, 0, len(wsClients))
-	for client := range wsClients {
-		clients = append(clients, client)
+	if virtualMeter != nil {
+		meterListener := fmt.Sprintf("%s:%d", config.ActiveInterpreterAPIConfig.ListenAddress, config.ActiveInterpreterAPIConfig.VirtualMeterPort)
+		go func() {
+			log.Printf("Starting virtual %s meter on %s", config.ActiveInterpreterAPIConfig.VirtualMeterProfile, meterListener)
+			log.Fatal(virtualMeter.ListenAndServe(meterListener))
+		}()
 	}
-	wsClientsMutex.RUnlock()
 
-	for _, client := range clients {
-		if err := client.WriteMessage(websocket.TextMessage, reading.ToJsonBytes()); err != nil {
-			RemoveWebSocketClient(client)
+	if deviceEmulator != nil {
+		port := config.ActiveInterpreterAPIConfig.DeviceEmulationPort
+		emulationListener := fmt.Sprintf("%s:%d", config.ActiveInterpreterAPIConfig.ListenAddress, port)
+		go func() {
+			log.Printf("Starting HomeWizard and Shelly emulation on %s", emulationListener)
+			log.Fatal(http.ListenAndServe(emulationListener, deviceEmulator))
+		}()
+		// Discovery is optional, the devices can still be added by address
+		if config.ActiveInterpreterAPIConfig.DeviceEmulationMDNS {
+			go func() {
+				responder := mdns.NewResponder(config.ActiveInterpreterAPIConfig.ListenAddress, deviceEmulator.Services(port)...)
+				err := responder.Run()
+				log.Printf("mDNS advertisement stopped: %v", err)
+			}()
 		}
 	}
+
+	go func() {
+		log.Printf("Starting European Smart Meter Interpreter API on %s", listener)
+		log.Fatal(listenAndServe(listener, withSecurity(http.DefaultServeMux)))
+	}()
+
+	// Single shutdown path, stop reading the P1 port before saving what must survive a restart
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	log.Println("Shutting down")
+	p1Reader.StopReading()
+	if config.ActiveInterpreterAPIConfig.PersistReadingBuffer {
+		saveReadingBuffer()
+	}
+}
+
+// Periodically save the reading buffer, it is saved once more on shutdown.
+func persistReadingBuffer() {
+	ticker := time.NewTicker(readingBufferSaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		saveReadingBuffer()
+	}
+}
+
+func saveReadingBuffer() {
+	if err := readingBuffer.SaveToFile(pathing.GetReadingBufferPath()); err != nil {
+		log.Printf("Failed to save reading buffer: %v", err)
+	}
+}
+
+// Response of /solar, the original path adds currentProduction and lifetimeYieldWh.
+// stale is true when the inverter could not be read for three poll intervals.
+type solarResponse struct {
+	AgeSeconds float64 `json:"age_seconds"`
+	Stale      bool    `json:"stale"`
+	LastError  string  `json:"last_error,omitempty"`
+	*solarinverter.InverterSnapshot
+}
+
+// Response of /health, status is ok or degraded.
+type healthResponse struct {
+	Status        string  `json:"status"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	// Meter timestamp of the latest reading and seconds since it arrived, empty and null before the first reading
+	LastReading           string   `json:"last_reading"`
+	LastReadingAgeSeconds *float64 `json:"last_reading_age_seconds"`
+	SolarConfigured       bool     `json:"solar_configured"`
+	SolarStale            bool     `json:"solar_stale"`
+	MeterDatabase         bool     `json:"meter_database"`
+	WebSocketClients      int      `json:"websocket_clients"`
+}
+
+// Response of /prices, prices are in meter local time.
+type pricesResponse struct {
+	Currency string                      `json:"currency"`
+	Current  *energycost.ContractPrice   `json:"current"`
+	Upcoming []*energycost.ContractPrice `json:"upcoming"`
+}
+
+// Solar production sent along with each reading on /ws.
+type wsSolarProduction struct {
+	CurrentProductionW int32     `json:"current_production_w"`
+	LifetimeYieldWh    int64     `json:"lifetime_yield_wh"`
+	ReadAt             time.Time `json:"read_at"`
+	AgeSeconds         float64   `json:"age_seconds"`
+	Stale              bool      `json:"stale"`
+}
+
+// Clients without a subscription get the readings with the latest solar production
+// under "solar", which is omitted until the inverter was read successfully.
+func BroadcastToWebSockets(reading *interpreter.RawMeterReading) {
+	wsClients.publish(&wsUpdate{Type: wsTypeReadings, Reading: reading})
+}
+
+// Sent to clients subscribed to solar after each inverter read.
+func publishSolarProduction(*solarinverter.InverterSnapshot) {
+	if solar := currentSolarProduction(); solar != nil {
+		wsClients.publish(&wsUpdate{Type: wsTypeSolar, Data: solar})
+	}
 }
 
-func AddWebSocketClient(conn *websocket.Conn) {
-	wsClientsMutex.Lock()
-	wsClients[conn] = true
-	wsClientsMutex.Unlock()
+// nil until the inverter was read successfully.
+func currentSolarProduction() *wsSolarProduction {
+	status, err := solarinverter.GetStatus()
+	if err != nil {
+		return nil
+	}
+	return &wsSolarProduction{
+		CurrentProductionW: status.Snapshot.ActivePowerW,
+		LifetimeYieldWh:    status.Snapshot.LifetimeYieldWh,
+		ReadAt:             status.UpdatedAt,
+		AgeSeconds:         math.Round(status.Age.Seconds()*10) / 10,
+		Stale:              status.Stale,
+	}
 }
 
-func RemoveWebSocketClient(conn *websocket.Conn) {
-	wsClientsMutex.Lock()
-	delete(wsClients, conn)
-	wsClientsMutex.Unlock()
-	conn.Close()
+func webSocketMessage(reading *interpreter.RawMeterReading) ([]byte, error) {
+	message := struct {
+		*interpreter.RawMeterReading
+		Solar *wsSolarProduction `json:"solar,omitempty"`
+	}{RawMeterReading: reading, Solar: currentSolarProduction()}
+	return json.Marshal(message)
 }
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+)
+
+// OpenAPI 3 document generated from the registered routes,
+// schemas are derived from the JSON tags of the example values.
+func openAPIDocument() map[string]any {
+	schemas := newSchemaRegistry()
+	paths := map[string]any{}
+	for _, route := range apiRoutes {
+		operations := map[string]any{}
+		for _, method := range route.Methods {
+			operations[strings.ToLower(method)] = route.operation(schemas)
+		}
+		paths[apiPrefix+route.Path] = operations
+	}
+
+	document := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "European Smart Meter Interpreter API",
+			"version":     "1",
+			"description": "Live readings from the P1 port of the smart meter, solar production, costs and history.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas.schemas,
+		},
+	}
+
+	// Only the configured authentication methods are documented
+	cfg := config.ActiveInterpreterAPIConfig
+	securitySchemes := map[string]any{}
+	var security []map[string][]string
+	if len(cfg.APITokens) > 0 {
+		securitySchemes["bearerAuth"] = map[string]any{"type": "http", "scheme": "bearer"}
+		securitySchemes["tokenQuery"] = map[string]any{"type": "apiKey", "in": "query", "name": "token"}
+		security = append(security, map[string][]string{"bearerAuth": {}}, map[string][]string{"tokenQuery": {}})
+	}
+	if cfg.BasicAuthUsername != "" {
+		securitySchemes["basicAuth"] = map[string]any{"type": "http", "scheme": "basic"}
+		security = append(security, map[string][]string{"basicAuth": {}})
+	}
+	if len(security) > 0 {
+		document["components"].(map[string]any)["securitySchemes"] = securitySchemes
+		document["security"] = security
+	}
+	return document
+}
+
+func (route apiRoute) operation(schemas *schemaRegistry) map[string]any {
+	operation := map[string]any{
+		"summary": route.Summary,
+		"responses": map[string]any{
+			"200": route.response(schemas),
+			"default": map[string]any{
+				"description": "Error",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemaRef(schemas.add(reflect.TypeOf(apiError{})))},
+				},
+			},
+		},
+	}
+	if route.Description != "" {
+		operation["description"] = route.Description
+	}
+	if route.Legacy {
+		operation["description"] = strings.TrimSpace(route.Description + "\n\nAlso served at `" + route.Path + "` with errors as `{\"error\": \"message\"}`.")
+	}
+
+	var parameters []map[string]any
+	for _, param := range route.Params {
+		schema := map[string]any{"type": param.Type}
+		if param.Format != "" {
+			schema["format"] = param.Format
+		}
+		if len(param.Enum) > 0 {
+			schema["enum"] = param.Enum
+		}
+		in := "query"
+		if param.Header {
+			in = "header"
+		}
+		parameters = append(parameters, map[string]any{
+			"name":        param.Name,
+			"in":          in,
+			"description": param.Description,
+			"required":    param.Required,
+			"schema":      schema,
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if route.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(route.Request))},
+			},
+		}
+	}
+	return operation
+}
+
+func (route apiRoute) response(schemas *schemaRegistry) map[string]any {
+	response := map[string]any{"description": "OK"}
+	if route.ContentType != "" {
+		response["content"] = map[string]any{
+			route.ContentType: map[string]any{"schema": map[string]any{"type": "string"}},
+		}
+		return response
+	}
+
+	var schema map[string]any
+	if alternatives, ok := route.Response.(oneOf); ok {
+		var options []map[string]any
+		for _, alternative := range alternatives {
+			options = append(options, schemas.schema(reflect.TypeOf(alternative)))
+		}
+		schema = map[string]any{"oneOf": options}
+	} else if route.Response != nil {
+		schema = schemas.schema(reflect.TypeOf(route.Response))
+	}
+	if schema != nil {
+		response["content"] = map[string]any{
+			"application/json": map[string]any{"schema": schema},
+		}
+	}
+	return response
+}
+
+// Named struct types become components, referenced by name.
+type schemaRegistry struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+}
+
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// Register a named struct type and return its component name.
+func (s *schemaRegistry) add(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	// Unexported types of this package are named like the others
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if _, taken := s.schemas[name]; taken {
+		// Same name in another package, eg. loadcontrol.Status
+		name = t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:] + "." + name
+	}
+	s.names[t] = name
+	s.schemas[name] = nil // Reserved for recursive types
+	s.schemas[name] = s.structSchema(t)
+	return name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *schemaRegistry) schema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			// $ref siblings are ignored in OpenAPI 3.0
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return schemaRef(s.add(t))
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		schema := map[string]any{"type": "array", "items": s.schema(t.Elem())}
+		if t.Kind() == reflect.Array {
+			schema["minItems"], schema["maxItems"] = t.Len(), t.Len()
+		}
+		return schema
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	// Interfaces and anything else can be any value
+	return map[string]any{}
+}
+
+// Object schema with the fields as encoding/json would marshal them.
+func (s *schemaRegistry) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			fieldType := field.Type
+			if field.Anonymous && name == "" {
+				if fieldType.Kind() == reflect.Pointer {
+					fieldType = fieldType.Elem()
+				}
+				if fieldType.Kind() == reflect.Struct {
+					addFields(fieldType)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = s.schema(fieldType)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(openAPIDocument())
+}
@@ -0,0 +1,71 @@
+package main
+
+import "time"
+
+// Sends the readings an event stream or gRPC client missed, then its queued messages.
+// The client is registered before reading the buffer so no reading is missed in between,
+// readings that are both replayed and queued are skipped by their id.
+type resumedStream struct {
+	client *wsClient
+	send   func(message wsMessage) error
+	// Id of the last reading sent before the queued messages. Ids are meter time and go back
+	// an hour when DST ends, so they are only compared until the first new queued reading.
+	replayedID int64
+}
+
+// Send the buffered readings after resumeAfter, or the latest reading when it is 0.
+func (c *wsClient) resume(sub *wsSubscription, resumeAfter int64, send func(message wsMessage) error) (*resumedStream, error) {
+	stream := &resumedStream{client: c, send: send}
+	if resumeAfter <= 0 {
+		if reading := p1Reader.GetLatestReading(); reading != nil {
+			// Send current reading immediately, like /ws
+			if message, ok := c.render(&wsUpdate{Type: wsTypeReadings, Reading: reading}, time.Now()); ok {
+				return stream, stream.sendReplayed(message)
+			}
+		}
+		return stream, nil
+	}
+
+	// A separate filter, as the interval is measured in reading time here
+	var filter *wsFilter
+	if sub != nil {
+		filter = newWsFilter(*sub)
+	}
+	for _, reading := range readingBuffer.Since(resumeAfter) {
+		update := &wsUpdate{Type: wsTypeReadings, Reading: reading}
+		if message, ok := c.format(filter, update, time.Unix(update.id(), 0)); ok {
+			if err := stream.sendReplayed(message); err != nil {
+				return stream, err
+			}
+		}
+	}
+	return stream, nil
+}
+
+func (s *resumedStream) sendReplayed(message wsMessage) error {
+	if err := s.write(message); err != nil {
+		return err
+	}
+	s.replayedID = message.id
+	return nil
+}
+
+// Send a message from the client's queue, unless it was already replayed.
+func (s *resumedStream) sendQueued(message wsMessage) error {
+	if s.replayedID > 0 && message.id > 0 {
+		if message.id <= s.replayedID {
+			return nil
+		}
+		s.replayedID = 0
+	}
+	return s.write(message)
+}
+
+func (s *resumedStream) write(message wsMessage) error {
+	if err := s.send(message); err != nil {
+		return err
+	}
+	s.client.sent.Add(1)
+	s.client.hub.sent.Add(1)
+	return nil
+}
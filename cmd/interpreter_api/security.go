@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+)
+
+// Authentication is required once any method is configured.
+func authRequired() bool {
+	cfg := config.ActiveInterpreterAPIConfig
+	return len(cfg.APITokens) > 0 || cfg.BasicAuthUsername != "" || cfg.TLSClientCAFile != ""
+}
+
+// Check the origin allowlist and authentication before handing the request to next.
+func withSecurity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Charge points authenticate with their own credentials, checked by the central system
+		if isOCPPPath(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Browsers send the origin on cross-origin requests and websockets,
+		// other clients usually do not and are only subject to authentication
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !isOriginAllowed(r) {
+				writeError(w, r, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Add("Vary", "Origin")
+			// Preflight requests carry no credentials
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if authRequired() && !isDashboardPath(r) && !isAuthenticated(r) {
+			if config.ActiveInterpreterAPIConfig.BasicAuthUsername != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="European Smart Meter"`)
+			}
+			writeError(w, r, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Websocket of a charge point, not the /ocpp listing.
+func isOCPPPath(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/ocpp/")
+}
+
+// A verified client certificate, an API token or basic auth credentials.
+func isAuthenticated(r *http.Request) bool {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if token := r.URL.Query().Get("token"); token != "" && isTokenValid(token) {
+		return true
+	}
+	return isAuthorizationValid(r.Header.Get("Authorization"))
+}
+
+// A bearer token or basic auth credentials, as sent in the Authorization header or gRPC metadata.
+func isAuthorizationValid(authorization string) bool {
+	scheme, credentials, _ := strings.Cut(authorization, " ")
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return isTokenValid(credentials)
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return false
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		return ok && isBasicAuthValid(username, password)
+	}
+	return false
+}
+
+func isTokenValid(token string) bool {
+	for _, allowed := range config.ActiveInterpreterAPIConfig.APITokens {
+		if allowed != "" && subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func isBasicAuthValid(username string, password string) bool {
+	cfg := config.ActiveInterpreterAPIConfig
+	if cfg.BasicAuthUsername == "" {
+		return false
+	}
+	usernameOK := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.BasicAuthUsername)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.BasicAuthPassword)) == 1
+	return usernameOK && passwordOK
+}
+
+// Origins in the allowlist, any with "*", or only the API's own host when the list is empty.
+func isOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	allowed := config.ActiveInterpreterAPIConfig.AllowedOrigins
+	if slices.Contains(allowed, "*") || slices.Contains(allowed, strings.TrimSuffix(origin, "/")) {
+		return true
+	}
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return false
+}
+
+// Serve HTTPS when a certificate is configured, plain HTTP otherwise.
+func listenAndServe(address string, handler http.Handler) error {
+	cfg := config.ActiveInterpreterAPIConfig
+	server := &http.Server{Addr: address, Handler: handler}
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		if cfg.TLSClientCAFile != "" {
+			log.Println("Warning: tls_client_ca_file has no effect without tls_cert_file and tls_key_file")
+		}
+		if authRequired() {
+			log.Println("Warning: authentication is enabled without TLS, credentials are sent in plain text")
+		}
+		return server.ListenAndServe()
+	}
+
+	var err error
+	if server.TLSConfig, err = serverTLSConfig(); err != nil {
+		return err
+	}
+	return server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+}
+
+// TLS settings shared by the HTTP and gRPC servers, without the server certificate.
+func serverTLSConfig() (*tls.Config, error) {
+	cfg := config.ActiveInterpreterAPIConfig
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSClientCAFile)
+		}
+		// Tokens and basic auth remain an alternative to a client certificate
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if len(cfg.APITokens) == 0 && cfg.BasicAuthUsername == "" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+// Message types clients can subscribe to
+const (
+	wsTypeReadings = "readings"
+	wsTypeSolar    = "solar"
+	wsTypePeak     = "peak"
+	wsTypeEvents   = "events"
+)
+
+var wsTypes = []string{wsTypeReadings, wsTypeSolar, wsTypePeak, wsTypeEvents}
+
+// Fields that change with every message and are not compared for change_only
+var wsVolatileFields = []string{"timestamp", "read_at", "age_seconds"}
+
+// Reading fields clients can select, by their JSON name
+var readingFields = func() []string {
+	var fields map[string]any
+	data, _ := json.Marshal(&interpreter.RawMeterReading{})
+	json.Unmarshal(data, &fields)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}()
+
+// What a client wants to receive, sent as {"action": "subscribe", ...}
+// or as query parameters on /ws and /events, eg. ?types=readings,peak&fields=current_consumption_kw&interval=10.
+// Clients without a subscription receive every reading in the original format.
+type wsSubscription struct {
+	// Message types, readings when empty
+	Types []string `json:"types"`
+	// Reading fields to send, all when empty
+	Fields []string `json:"fields"`
+	// Minimum time between messages of a type, events are always sent
+	IntervalSeconds float64 `json:"interval_seconds"`
+	// Only send messages in which a value changed by more than its deadband
+	ChangeOnly bool               `json:"change_only"`
+	Deadband   float64            `json:"deadband"`
+	Deadbands  map[string]float64 `json:"deadbands"`
+}
+
+// Subscription query parameters of /ws and /events
+var subscriptionParams = []apiParam{
+	{Name: "types", Description: "Comma separated message types: readings, solar, peak and events", Type: "string"},
+	{Name: "fields", Description: "Comma separated reading fields, all when omitted", Type: "string"},
+	{Name: "interval", Description: "Minimum seconds between messages of a type", Type: "number"},
+	{Name: "change_only", Description: "Only send messages in which a value changed by more than the deadband", Type: "boolean"},
+	{Name: "deadband", Description: "Change needed for change_only", Type: "number"},
+}
+
+// Message from a client
+type wsRequest struct {
+	Action string `json:"action"`
+	wsSubscription
+}
+
+// Messages sent to subscribed clients
+type wsEnvelope struct {
+	Type  string `json:"type"`
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (s *wsSubscription) validate() error {
+	if len(s.Types) == 0 {
+		s.Types = []string{wsTypeReadings}
+	}
+	for _, t := range s.Types {
+		if !slices.Contains(wsTypes, t) {
+			return fmt.Errorf("unknown type %q, use %s", t, strings.Join(wsTypes, ", "))
+		}
+	}
+	for _, field := range s.Fields {
+		if !slices.Contains(readingFields, field) {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	if s.IntervalSeconds < 0 || s.Deadband < 0 {
+		return fmt.Errorf("interval_seconds and deadband can not be negative")
+	}
+	for field, deadband := range s.Deadbands {
+		if deadband < 0 {
+			return fmt.Errorf("deadband of %q can not be negative", field)
+		}
+	}
+	return nil
+}
+
+// Subscription from the query parameters, nil when there are none.
+func subscriptionFromQuery(query url.Values) (*wsSubscription, error) {
+	if !slices.ContainsFunc([]string{"types", "fields", "interval", "change_only", "deadband"}, query.Has) {
+		return nil, nil
+	}
+	list := func(name string) []string {
+		if query.Get(name) == "" {
+			return nil
+		}
+		return strings.Split(query.Get(name), ",")
+	}
+	number := func(name string) (float64, error) {
+		if query.Get(name) == "" {
+			return 0, nil
+		}
+		value, err := strconv.ParseFloat(query.Get(name), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return value, nil
+	}
+
+	s := &wsSubscription{Types: list("types"), Fields: list("fields")}
+	var err error
+	if s.IntervalSeconds, err = number("interval"); err != nil {
+		return nil, err
+	}
+	if s.Deadband, err = number("deadband"); err != nil {
+		return nil, err
+	}
+	if query.Get("change_only") != "" {
+		if s.ChangeOnly, err = strconv.ParseBool(query.Get("change_only")); err != nil {
+			return nil, fmt.Errorf("invalid change_only: %w", err)
+		}
+	}
+	return s, s.validate()
+}
+
+// Something that happened, rendered for each client according to its subscription.
+type wsUpdate struct {
+	Type    string
+	Reading *interpreter.RawMeterReading
+	// Payload of solar, peak and events
+	Data any
+
+	legacyOnce sync.Once
+	legacy     []byte
+	valuesOnce sync.Once
+	values     map[string]any
+}
+
+// Unix timestamp of the reading, used as event id on /events. 0 for other types.
+func (u *wsUpdate) id() int64 {
+	if u.Reading == nil {
+		return 0
+	}
+	ts, err := time.Parse(time.RFC3339, u.Reading.Timestamp)
+	if err != nil {
+		return 0
+	}
+	return ts.Unix()
+}
+
+// Message for clients without a subscription, only readings are sent to them.
+func (u *wsUpdate) legacyMessage() []byte {
+	if u.Type != wsTypeReadings {
+		return nil
+	}
+	u.legacyOnce.Do(func() {
+		u.legacy, _ = webSocketMessage(u.Reading)
+	})
+	return u.legacy
+}
+
+// Payload as a map, shared by all clients so it must not be modified.
+func (u *wsUpdate) valueMap() map[string]any {
+	u.valuesOnce.Do(func() {
+		var data []byte
+		if u.Reading != nil {
+			data, _ = json.Marshal(u.Reading)
+		} else {
+			data, _ = json.Marshal(u.Data)
+		}
+		json.Unmarshal(data, &u.values)
+	})
+	return u.values
+}
+
+// Per client state of a subscription.
+type wsFilter struct {
+	sub        wsSubscription
+	lastSent   map[string]time.Time
+	lastValues map[string]map[string]any
+}
+
+func newWsFilter(sub wsSubscription) *wsFilter {
+	return &wsFilter{
+		sub:        sub,
+		lastSent:   map[string]time.Time{},
+		lastValues: map[string]map[string]any{},
+	}
+}
+
+// Payload of the update, nil when the subscription skips it.
+func (f *wsFilter) render(u *wsUpdate, now time.Time) any {
+	if !slices.Contains(f.sub.Types, u.Type) {
+		return nil
+	}
+	if u.Type == wsTypeEvents {
+		return u.Data
+	}
+
+	interval := time.Duration(f.sub.IntervalSeconds * float64(time.Second))
+	if now.Sub(f.lastSent[u.Type]) < interval {
+		return nil
+	}
+	values := u.valueMap()
+	if u.Type == wsTypeReadings && len(f.sub.Fields) > 0 {
+		selected := map[string]any{"timestamp": values["timestamp"]}
+		for _, field := range f.sub.Fields {
+			selected[field] = values[field]
+		}
+		values = selected
+	}
+	if f.sub.ChangeOnly && !f.changed(f.lastValues[u.Type], values) {
+		return nil
+	}
+	f.lastSent[u.Type] = now
+	f.lastValues[u.Type] = values
+	return values
+}
+
+// Whether any value changed by more than its deadband since the last message.
+func (f *wsFilter) changed(previous map[string]any, values map[string]any) bool {
+	if previous == nil {
+		return true
+	}
+	for name, value := range values {
+		if slices.Contains(wsVolatileFields, name) {
+			continue
+		}
+		number, isNumber := value.(float64)
+		previousNumber, wasNumber := previous[name].(float64)
+		if !isNumber || !wasNumber {
+			if fmt.Sprint(value) != fmt.Sprint(previous[name]) {
+				return true
+			}
+			continue
+		}
+		deadband, ok := f.sub.Deadbands[name]
+		if !ok {
+			deadband = f.sub.Deadband
+		}
+		if math.Abs(number-previousNumber) > deadband {
+			return true
+		}
+	}
+	return false
+}
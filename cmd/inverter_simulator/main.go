@@ -0,0 +1,223 @@
+// Simulates a solar inverter over Modbus TCP, for development without hardware.
+// Production follows the sun over the day, the lifetime yield keeps counting.
+//
+//	inverter_simulator -driver huawei -listen 127.0.0.1:1502 -peak 5000 -battery
+//
+// Point the interpreter API at it with solar_inverter_ip, solar_inverter_modbus_port
+// and an empty wlan_connection_id.
+package main
+
+import (
+	"flag"
+	"log"
+	"math"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/modbusserver"
+	"github.com/NotCoffee418/european_smart_meter/pkg/solarinverter"
+)
+
+// State shared by both register maps.
+type simulatedInverter struct {
+	peakW     float64
+	battery   bool
+	pvStrings int
+
+	powerW          float64
+	dailyYieldWh    float64
+	lifetimeYieldWh float64
+	socPercent      float64
+	batteryPowerW   float64
+	day             int
+}
+
+func main() {
+	driver := flag.String("driver", solarinverter.DriverHuawei, "register map to serve, huawei or sunspec")
+	listen := flag.String("listen", "127.0.0.1:1502", "Modbus TCP listen address")
+	peakW := flag.Float64("peak", 5000, "production at noon in watts")
+	battery := flag.Bool("battery", false, "simulate a LUNA2000 battery (huawei only)")
+	flag.Parse()
+
+	inverter := &simulatedInverter{
+		peakW:           *peakW,
+		battery:         *battery,
+		pvStrings:       2,
+		lifetimeYieldWh: 12_345_000,
+		socPercent:      50,
+		day:             time.Now().YearDay(),
+	}
+
+	server := modbusserver.NewServer()
+	var update func(*modbusserver.Server)
+	switch *driver {
+	case solarinverter.DriverHuawei:
+		inverter.setupHuawei(server)
+		update = inverter.updateHuawei
+	case solarinverter.DriverSunSpec:
+		inverter.setupSunSpec(server)
+		update = inverter.updateSunSpec
+	default:
+		log.Fatalf("Unknown driver %q", *driver)
+	}
+	update(server)
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			inverter.step(now, time.Second)
+			update(server)
+		}
+	}()
+
+	log.Printf("Simulating %s inverter on %s", *driver, *listen)
+	log.Fatal(server.ListenAndServe(*listen))
+}
+
+// Advance production, yields and battery by elapsed.
+func (s *simulatedInverter) step(now time.Time, elapsed time.Duration) {
+	if now.YearDay() != s.day {
+		s.day = now.YearDay()
+		s.dailyYieldWh = 0
+	}
+
+	// Half a sine between 06:00 and 20:00 with a little noise from passing clouds
+	hour := float64(now.Hour()) + float64(now.Minute())/60 + float64(now.Second())/3600
+	s.powerW = 0
+	if hour > 6 && hour < 20 {
+		s.powerW = s.peakW * math.Sin((hour-6)/14*math.Pi) * (0.9 + 0.1*math.Sin(float64(now.Unix())/37))
+	}
+	s.dailyYieldWh += s.powerW * elapsed.Hours()
+	s.lifetimeYieldWh += s.powerW * elapsed.Hours()
+
+	// Charge with a third of production, discharge slowly at night
+	if s.battery {
+		s.batteryPowerW = s.powerW / 3
+		if s.powerW == 0 {
+			s.batteryPowerW = -300
+		}
+		s.socPercent = math.Max(5, math.Min(100, s.socPercent+s.batteryPowerW*elapsed.Hours()/5000*100))
+		if s.socPercent >= 100 || s.socPercent <= 5 {
+			s.batteryPowerW = 0
+		}
+	}
+}
+
+// All registers of a block read must exist.
+func (s *simulatedInverter) setupHuawei(server *modbusserver.Server) {
+	server.SetRegisters(30071, uint16(s.pvStrings))
+	server.SetRegisters(32000, make([]uint16, 64)...)
+	server.SetRegisters(32064, make([]uint16, 52)...)
+	if s.battery {
+		server.SetRegisters(37758, make([]uint16, 9)...)
+		server.SetUint32(37758, 5000) // Rated capacity
+	}
+}
+
+func (s *simulatedInverter) updateHuawei(server *modbusserver.Server) {
+	// PV strings
+	for i := range s.pvStrings {
+		voltage := 0.0
+		if s.powerW > 0 {
+			voltage = 380
+		}
+		server.SetRegisters(32016+uint16(i)*2,
+			uint16(voltage*10),
+			uint16(s.powerW/float64(s.pvStrings)/math.Max(voltage, 1)*100),
+		)
+	}
+
+	// Power, grid, temperature and yields
+	inputW := s.powerW / 0.97
+	server.SetUint32(32064, uint32(int32(inputW)))
+	for phase := range 3 {
+		server.SetRegisters(32066+uint16(phase), 4000)
+		server.SetRegisters(32069+uint16(phase), 2300)
+		server.SetUint32(32072+uint16(phase)*2, uint32(int32(s.powerW/3/230*1000)))
+	}
+	server.SetUint32(32080, uint32(int32(s.powerW)))
+	server.SetRegisters(32084, 1000)                            // Power factor
+	server.SetRegisters(32085, 5000)                            // 50 Hz
+	server.SetRegisters(32086, 9700)                            // Efficiency
+	server.SetRegisters(32087, uint16(int16(250+s.powerW/100))) // Temperature
+	server.SetRegisters(32088, 3000)                            // Insulation resistance
+	server.SetRegisters(32089, huaweiDeviceStatus(s.powerW))    // Device status
+	server.SetUint32(32106, uint32(s.lifetimeYieldWh/10))       // 0.01 kWh
+	server.SetUint32(32114, uint32(s.dailyYieldWh/10))          // 0.01 kWh
+
+	if s.battery {
+		server.SetRegisters(37760, uint16(s.socPercent*10))
+		server.SetRegisters(37762, 2) // Running
+		server.SetUint32(37765, uint32(int32(s.batteryPowerW)))
+	}
+}
+
+func huaweiDeviceStatus(powerW float64) uint16 {
+	if powerW > 0 {
+		return 0x0200 // On-grid
+	}
+	return 0xA000 // Standby: no irradiation
+}
+
+// SunSpec layout: marker, common model 1, inverter model 103, MPPT model 160, end marker.
+const (
+	sunspecBase          = 40000
+	sunspecCommonModel   = sunspecBase + 2
+	sunspecInverterModel = sunspecCommonModel + 2 + 66
+	sunspecMPPTModel     = sunspecInverterModel + 2 + 50
+)
+
+func (s *simulatedInverter) setupSunSpec(server *modbusserver.Server) {
+	server.SetUint32(sunspecBase, 0x53756e53) // "SunS"
+
+	server.SetRegisters(sunspecCommonModel, 1, 66)
+	server.SetRegisters(sunspecCommonModel+2, make([]uint16, 66)...)
+	server.SetString(sunspecCommonModel+2, 16, "European Smart Meter")
+	server.SetString(sunspecCommonModel+18, 16, "Simulated Inverter")
+
+	server.SetRegisters(sunspecInverterModel, 103, 50)
+	server.SetRegisters(sunspecInverterModel+2, make([]uint16, 50)...)
+
+	mpptLength := 8 + 20*s.pvStrings
+	server.SetRegisters(sunspecMPPTModel, 160, uint16(mpptLength))
+	server.SetRegisters(sunspecMPPTModel+2, make([]uint16, mpptLength)...)
+
+	server.SetRegisters(sunspecMPPTModel+2+uint16(mpptLength), 0xFFFF, 0)
+}
+
+func (s *simulatedInverter) updateSunSpec(server *modbusserver.Server) {
+	// Inverter model 103, offsets relative to the first data register
+	data := uint16(sunspecInverterModel + 2)
+	phaseCurrent := s.powerW / 3 / 230
+	server.SetRegisters(data+0, uint16(phaseCurrent*3*100), uint16(phaseCurrent*100), uint16(phaseCurrent*100), uint16(phaseCurrent*100))
+	server.SetRegisters(data+4, uint16(0xFFFE)) // A_SF -2
+	server.SetRegisters(data+5, 4000, 4000, 4000, 2300, 2300, 2300)
+	server.SetRegisters(data+11, 0xFFFF) // V_SF -1
+	server.SetRegisters(data+12, uint16(int16(s.powerW)), 0)
+	server.SetRegisters(data+14, 5000, 0xFFFE) // 50.00 Hz
+	server.SetRegisters(data+20, 100, 0)       // PF 100%
+	server.SetUint32(data+22, uint32(s.lifetimeYieldWh))
+	server.SetRegisters(data+24, 0)
+	server.SetRegisters(data+29, uint16(int16(s.powerW/0.97)), 0)
+	server.SetRegisters(data+31, uint16(int16(250+s.powerW/100)))
+	server.SetRegisters(data+35, 0xFFFF) // Tmp_SF -1
+	state := uint16(2)                   // Sleeping
+	if s.powerW > 0 {
+		state = 4 // MPPT
+	}
+	server.SetRegisters(data+36, state)
+
+	// MPPT model 160, one module per string
+	mppt := uint16(sunspecMPPTModel + 2)
+	server.SetRegisters(mppt, 0xFFFE, 0xFFFF, 0, 0) // DCA_SF -2, DCV_SF -1
+	server.SetRegisters(mppt+6, uint16(s.pvStrings))
+	for i := range s.pvStrings {
+		module := mppt + 8 + uint16(i)*20
+		voltage := 0.0
+		if s.powerW > 0 {
+			voltage = 380
+		}
+		server.SetRegisters(module, uint16(i+1))
+		server.SetRegisters(module+9, uint16(s.powerW/float64(s.pvStrings)/math.Max(voltage, 1)*100), uint16(voltage*10))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+// Totals at the start of the current balance interval.
+type balanceStart struct {
+	timestamp int64
+	segmentID int64
+	importWh  int64
+	exportWh  int64
+}
+
+// Store import, export and solar production once a balance interval has passed.
+// Uses the accepted totals, so quarantined readings do not end up in the balance.
+func (m *meterState) recordEnergyBalance(timestamp int64) {
+	if m.solar == nil {
+		return
+	}
+	for _, readingType := range powerReadingTypes {
+		if !m.powerCounters[readingType].Known() {
+			return
+		}
+	}
+
+	current := &balanceStart{
+		timestamp: timestamp,
+		segmentID: m.currentSegmentID(meterdb.MeterKindElectricity),
+		importWh: int64(m.powerCounters[meterdb.PowerConsumptionDay].Value()) +
+			int64(m.powerCounters[meterdb.PowerConsumptionNight].Value()),
+		exportWh: int64(m.powerCounters[meterdb.PowerProductionDay].Value()) +
+			int64(m.powerCounters[meterdb.PowerProductionNight].Value()),
+	}
+	start := m.balanceStart
+	if start == nil || start.segmentID != current.segmentID {
+		// Totals of another counter segment can not be compared
+		m.balanceStart = current
+		m.solar.take()
+		return
+	}
+
+	interval := int64(config.ActiveMeterCollectorConfig.EnergyBalanceIntervalSeconds)
+	if timestamp-start.timestamp < interval {
+		return
+	}
+
+	balance := &meterdb.MeterDbEnergyBalance{
+		MeterID:         m.meterID,
+		Timestamp:       start.timestamp,
+		DurationSeconds: timestamp - start.timestamp,
+		ImportWh:        current.importWh - start.importWh,
+		ExportWh:        current.exportWh - start.exportWh,
+	}
+	if solarWh, ok := m.solar.take(); ok {
+		balance.SolarWh = &solarWh
+	}
+	batchWriter.QueueEnergyBalance(balance)
+	m.balanceStart = current
+}
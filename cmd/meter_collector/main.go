@@ -3,28 +3,17 @@
 package main
 
 import (
-	"database/sql"
 	"log"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/NotCoffee418/european_smart_meter/pkg/config"
-	"github.com/NotCoffee418/european_smart_meter/pkg/esmutils"
 	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
 	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
 )
 
-var (
-	lastGasValueDM3             uint32    = 0
-	lastGasInsertedUtcTimestamp time.Time = time.Time{}
-	lastTotalConsumptionDayWh   uint32    = 0
-	lastTotalProductionDayWh    uint32    = 0
-	lastTotalConsumptionNightWh uint32    = 0
-	lastTotalProductionNightWh  uint32    = 0
-)
-
-const (
-	minGasSaveInsertInterval = 10 * time.Minute
-)
+var batchWriter *meterdb.BatchWriter
 
 func main() {
 	// Load config
@@ -32,129 +21,152 @@ func main() {
 		log.Fatalf("Failed to load meter collector config: %v", err)
 	}
 
+	// Timezone of the meter, used for price imports
+	if err := config.LoadTariffConfig(); err != nil {
+		log.Fatalf("Failed to load tariff config: %v", err)
+	}
+
 	// Initialize database
 	meterdb.InitializeDatabase()
 
-	// Set the host:port from env var INTERPRETER_API_HOST
-	host := config.ActiveMeterCollectorConfig.InterpreterAPIHost
-	tls := config.ActiveMeterCollectorConfig.TLSEnabled
+	// One-off import of a price file
+	if len(os.Args) > 1 && os.Args[1] == "import-prices" {
+		if err := importPrices(os.Args[2:]); err != nil {
+			log.Fatalf("Failed to import prices: %v", err)
+		}
+		return
+	}
 
-	// We only need total power on fresh start because:
-	// Gas: Rarely changes regadless but still inserts every 10 minutes
-	// Live power: Value changes constantly and is dependent on type
-	// Total power: Type changes throughout the day, we don't need to update night data during the day
-	loadLastTotalPowerReadings()
+	// Keep day-ahead prices up to date
+	if config.ActiveMeterCollectorConfig.PriceProviderURL != "" {
+		go fetchPrices()
+	}
 
-	// Subscribe to websocket with revive
-	interpreter.StartListener(host, tls, handleMeterReading)
-}
+	// TLS files of every API are loaded before collecting from any of them,
+	// so a broken file stops the collector before it stores anything
+	var collectors []*hostCollector
+	for i, api := range config.ActiveMeterCollectorConfig.GetInterpreterAPIs() {
+		tlsConfig, err := interpreter.LoadTLSConfig(api.TLSCAFile, api.TLSClientCertFile, api.TLSClientKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS files for %s: %v", api.Host, err)
+		}
+		collectors = append(collectors, &hostCollector{
+			api: &interpreter.Endpoint{
+				Host:      api.Host,
+				TLS:       api.TLSEnabled,
+				Token:     api.APIToken,
+				TLSConfig: tlsConfig,
+			},
+			adoptsLegacyRows: i == 0,
+		})
+	}
 
-// Handle meter reading data
-func handleMeterReading(reading *interpreter.RawMeterReading) {
-	// Parse as local time, but convert to UTC for storage
-	utcTime, err := time.Parse(time.RFC3339, reading.Timestamp)
-	if err != nil {
-		log.Printf("Failed to parse timestamp: %v", err)
-		return
+	// Buffer writes, committed in transactions
+	batchWriter = meterdb.NewBatchWriter(
+		time.Duration(config.ActiveMeterCollectorConfig.BatchFlushIntervalSeconds)*time.Second,
+		config.ActiveMeterCollectorConfig.BatchMaxRows,
+	)
+
+	// Subscribe to every interpreter API with revive
+	// Each returns on SIGINT/SIGTERM or when giving up on the connection
+	var wg sync.WaitGroup
+	for _, collector := range collectors {
+		wg.Add(1)
+		go func(collector *hostCollector) {
+			defer wg.Done()
+			if pollInterval := time.Duration(config.ActiveMeterCollectorConfig.SolarPollIntervalSeconds) * time.Second; pollInterval > 0 {
+				collector.solar = newSolarIntegrator(pollInterval)
+				go collector.pollSolarProduction(pollInterval)
+			}
+			interpreter.StartListener(collector.api, collector.handleMeterReading, collector.backfillMissedReadings)
+		}(collector)
 	}
-	unixTimestampInt := utcTime.Unix()
-
-	// Interpret type and live power reading
-	var liveKw float64 = 0
-	var readingType meterdb.MeterDbPowerReadingType = meterdb.PowerConsumptionDay
-	if reading.CurrentConsumptionKW > 0 {
-		liveKw = reading.CurrentConsumptionKW
-		if reading.CurrentTariff == 1 {
-			readingType = meterdb.PowerConsumptionDay
-		} else {
-			readingType = meterdb.PowerConsumptionNight
-		}
-	} else if reading.CurrentProductionKW > 0 {
-		liveKw = reading.CurrentProductionKW
-		if reading.CurrentTariff == 1 {
-			readingType = meterdb.PowerProductionDay
-		} else {
-			readingType = meterdb.PowerProductionNight
-		}
+	wg.Wait()
+
+	// Ensure buffered readings are not lost on shutdown
+	if err := batchWriter.Close(); err != nil {
+		log.Fatalf("Failed to flush buffered readings: %v", err)
 	}
+	log.Println("Buffered readings flushed, exiting")
+}
 
-	// Store gas if reading has changed or if interval has passed
-	currentGasValueDM3 := esmutils.M3ToDM3(reading.GasConsumptionM3)
-	if currentGasValueDM3 != lastGasValueDM3 || time.Since(lastGasInsertedUtcTimestamp) > minGasSaveInsertInterval {
-		err = meterdb.InsertTotalGasReading(&meterdb.MeterDbTotalGasReading{
-			Timestamp:           unixTimestampInt,
-			TotalConsumptionDM3: currentGasValueDM3,
-		})
+// Stores the readings of a single interpreter API.
+// Rows are tagged with the electricity meter serial, so a replaced meter
+// continues under its new serial.
+type hostCollector struct {
+	api   *interpreter.Endpoint
+	meter *meterState // nil until the serial is known
+	solar *solarIntegrator
+	// Only the primary interpreter API (interpreter_api_host) collects the meter
+	// that was installed before rows were tagged with their meter
+	adoptsLegacyRows bool
+}
+
+// Handle meter reading data
+func (c *hostCollector) handleMeterReading(reading *interpreter.RawMeterReading) {
+	c.selectMeter(c.meterID(reading))
+	c.meter.handleMeterReading(reading)
+}
+
+// Request readings missed since the last stored one from the interpreter API's buffer.
+// Runs before live readings are handled, so readings stay in order.
+func (c *hostCollector) backfillMissedReadings() {
+	// Learn which meter this is after a restart
+	if c.meter == nil {
+		latest, err := interpreter.FetchLatestReading(c.api)
 		if err != nil {
-			log.Printf("Failed to insert gas reading: %v", err)
-		} else {
-			lastGasInsertedUtcTimestamp = utcTime
-			lastGasValueDM3 = currentGasValueDM3
+			log.Printf("Failed to identify meter on %s, not backfilling: %v", c.api.Host, err)
+			return
 		}
+		c.selectMeter(c.meterID(latest))
+	}
+
+	// Nothing to catch up on for a meter without readings
+	since := c.meter.lastLiveTimestamp
+	if since == 0 {
+		return
 	}
 
-	// Store live power reading always
-	err = meterdb.InsertLivePowerReading(&meterdb.MeterDbLivePowerReading{
-		Timestamp:   unixTimestampInt,
-		Watt:        esmutils.KwToW(liveKw),
-		ReadingType: readingType,
-	})
+	readings, err := interpreter.FetchReadingsSince(c.api, since)
 	if err != nil {
-		log.Printf("Failed to insert live power reading: %v", err)
-	}
-
-	// Store total power if value changed for current type
-	var currentTotalPowerWh uint32 = 0
-	var totalPowerChanged bool = false
-	switch readingType {
-	case meterdb.PowerConsumptionDay:
-		currentTotalPowerWh = esmutils.KwToW(reading.TotalConsumptionDayKWH)
-		totalPowerChanged = currentTotalPowerWh != lastTotalConsumptionDayWh
-		lastTotalConsumptionDayWh = currentTotalPowerWh
-	case meterdb.PowerProductionDay:
-		currentTotalPowerWh = esmutils.KwToW(reading.TotalProductionDayKWH)
-		totalPowerChanged = currentTotalPowerWh != lastTotalProductionDayWh
-		lastTotalProductionDayWh = currentTotalPowerWh
-	case meterdb.PowerConsumptionNight:
-		currentTotalPowerWh = esmutils.KwToW(reading.TotalConsumptionNightKWH)
-		totalPowerChanged = currentTotalPowerWh != lastTotalConsumptionNightWh
-		lastTotalConsumptionNightWh = currentTotalPowerWh
-	case meterdb.PowerProductionNight:
-		currentTotalPowerWh = esmutils.KwToW(reading.TotalProductionNightKWH)
-		totalPowerChanged = currentTotalPowerWh != lastTotalProductionNightWh
-		lastTotalProductionNightWh = currentTotalPowerWh
-	}
-	if totalPowerChanged {
-		err = meterdb.InsertTotalPowerReading(&meterdb.MeterDbTotalPowerReading{
-			Timestamp:   unixTimestampInt,
-			Watthour:    currentTotalPowerWh,
-			ReadingType: readingType,
-		})
-		if err != nil {
-			log.Printf("Failed to insert total power reading: %v", err)
-		}
+		log.Printf("Failed to backfill readings of meter %s since %d: %v", c.meter.meterID, since, err)
+		return
+	}
+	if len(readings) > 0 {
+		log.Printf("Backfilling %d readings of meter %s since %d", len(readings), c.meter.meterID, since)
+	}
+	for _, reading := range readings {
+		c.handleMeterReading(reading)
 	}
 }
 
-// Load last total power readings from database
-func loadLastTotalPowerReadings() {
-	// Shortcut function to handle no rows (is valid for total power readings)
-	getLastTotalPower := func(meterDbReadingType meterdb.MeterDbPowerReadingType) uint32 {
-		lastTotalPowerReading, err := meterdb.GetLastTotalPowerReading(meterDbReadingType)
-		if err != nil {
-			// No rows is valid, fresh DB
-			if err == sql.ErrNoRows {
-				return 0
-			} else {
-				log.Fatalf("Failed to get last live power reading: %v", err)
-			}
-		}
-		return lastTotalPowerReading.Watthour
+// The electricity meter serial, or the API host for meters that do not report one.
+// Never meterdb.AllMeters, which would mix the rows into every meter.
+func (c *hostCollector) meterID(reading *interpreter.RawMeterReading) string {
+	if reading.MeterSerialElectricity == "" {
+		return c.api.Host
 	}
+	return reading.MeterSerialElectricity
+}
 
-	// Set last total consumption of each type
-	lastTotalConsumptionDayWh = getLastTotalPower(meterdb.PowerConsumptionDay)
-	lastTotalProductionDayWh = getLastTotalPower(meterdb.PowerProductionDay)
-	lastTotalConsumptionNightWh = getLastTotalPower(meterdb.PowerConsumptionNight)
-	lastTotalProductionNightWh = getLastTotalPower(meterdb.PowerProductionNight)
+// Load the state of a meter when it is first seen or replaced.
+// The first meter seen on the primary interpreter API adopts rows stored before meters were tagged.
+func (c *hostCollector) selectMeter(meterID string) {
+	if c.meter != nil && c.meter.meterID == meterID {
+		return
+	}
+	if c.meter != nil {
+		log.Printf("Meter %s on %s replaced by %s", c.meter.meterID, c.api.Host, meterID)
+	} else {
+		log.Printf("Collecting readings of meter %s from %s", meterID, c.api.Host)
+	}
+	if c.adoptsLegacyRows {
+		if adopted, err := meterdb.AdoptLegacyRows(meterID); err != nil {
+			log.Printf("Failed to assign earlier readings to meter %s: %v", meterID, err)
+		} else if adopted {
+			log.Printf("Assigned readings stored before meters were tagged to meter %s", meterID)
+		}
+	}
+	c.meter = loadMeterState(meterID)
+	c.meter.solar = c.solar
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/countercheck"
+	"github.com/NotCoffee418/european_smart_meter/pkg/esmutils"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+var powerReadingTypes = []meterdb.MeterDbPowerReadingType{
+	meterdb.PowerConsumptionDay,
+	meterdb.PowerConsumptionNight,
+	meterdb.PowerProductionDay,
+	meterdb.PowerProductionNight,
+}
+
+const (
+	minGasSaveInsertInterval = 10 * time.Minute
+	// Consecutive increasing non-zero totals below the last accepted one after which
+	// a counter is considered restarted at a new level without the meter serial changing.
+	counterRestartRejections = 10
+)
+
+// What was last stored for a single meter.
+type meterState struct {
+	meterID string
+
+	lastLiveTimestamp           int64
+	lastGasInsertedUtcTimestamp time.Time
+
+	// Last accepted totals, validated before storing new ones
+	powerCounters map[meterdb.MeterDbPowerReadingType]*countercheck.Counter
+	gasCounter    *countercheck.Counter
+
+	// Counter segments currently in use, nil before the first one starts
+	currentSegments map[meterdb.MeterDbMeterKind]*meterdb.MeterDbMeterSegment
+
+	// Solar production of the inverter behind this meter, nil when not polled
+	solar        *solarIntegrator
+	balanceStart *balanceStart
+}
+
+// Load the last stored state of a meter from the database.
+// We only need totals on fresh start because:
+// Gas: Rarely changes regadless but still inserts every 10 minutes
+// Live power: Value changes constantly and is always stored
+// Total power: Only registers that changed are stored
+func loadMeterState(meterID string) *meterState {
+	m := &meterState{
+		meterID:         meterID,
+		powerCounters:   map[meterdb.MeterDbPowerReadingType]*countercheck.Counter{},
+		currentSegments: map[meterdb.MeterDbMeterKind]*meterdb.MeterDbMeterSegment{},
+	}
+	m.loadMeterSegments()
+	m.loadLastTotalReadings()
+	m.loadLastLiveTimestamp()
+	return m
+}
+
+func (m *meterState) handleMeterReading(reading *interpreter.RawMeterReading) {
+	// Parse as local time, but convert to UTC for storage
+	utcTime, err := time.Parse(time.RFC3339, reading.Timestamp)
+	if err != nil {
+		log.Printf("Failed to parse timestamp: %v", err)
+		return
+	}
+	unixTimestampInt := utcTime.Unix()
+
+	// Already stored, eg. overlap between backfill and live stream
+	if unixTimestampInt <= m.lastLiveTimestamp {
+		return
+	}
+
+	// Anything still missing at this point could not be backfilled
+	gapThreshold := int64(config.ActiveMeterCollectorConfig.GapThresholdSeconds)
+	if m.lastLiveTimestamp != 0 && unixTimestampInt-m.lastLiveTimestamp > gapThreshold {
+		log.Printf("No readings of meter %s between %d and %d, recording data gap", m.meterID, m.lastLiveTimestamp, unixTimestampInt)
+		batchWriter.QueueDataGap(&meterdb.MeterDbDataGap{
+			MeterID:        m.meterID,
+			StartTimestamp: m.lastLiveTimestamp,
+			EndTimestamp:   unixTimestampInt,
+		})
+	}
+	m.lastLiveTimestamp = unixTimestampInt
+
+	// A replaced meter starts counting from its own totals
+	m.checkMeterChange(meterdb.MeterKindElectricity, reading.MeterSerialElectricity, unixTimestampInt)
+	m.checkMeterChange(meterdb.MeterKindGas, reading.MeterSerialGas, unixTimestampInt)
+
+	// Store gas if reading has changed or if interval has passed
+	currentGasValueDM3 := esmutils.M3ToDM3(reading.GasConsumptionM3)
+	if currentGasValueDM3 != m.gasCounter.Value() || time.Since(m.lastGasInsertedUtcTimestamp) > minGasSaveInsertInterval {
+		if m.acceptTotal(meterdb.MeterKindGas, 0, m.gasCounter, currentGasValueDM3, unixTimestampInt) {
+			batchWriter.QueueTotalGasReading(&meterdb.MeterDbTotalGasReading{
+				MeterID:             m.meterID,
+				Timestamp:           unixTimestampInt,
+				TotalConsumptionDM3: currentGasValueDM3,
+				SegmentID:           m.currentSegmentID(meterdb.MeterKindGas),
+			})
+			m.lastGasInsertedUtcTimestamp = utcTime
+		}
+	}
+
+	// Store live power reading always, both directions for every phase
+	batchWriter.QueueLivePhasePowerReading(&meterdb.MeterDbLivePhasePowerReading{
+		MeterID:      m.meterID,
+		Timestamp:    unixTimestampInt,
+		Tariff:       uint8(reading.CurrentTariff),
+		ImportWatt:   esmutils.KwToW(reading.CurrentConsumptionKW),
+		ExportWatt:   esmutils.KwToW(reading.CurrentProductionKW),
+		L1ImportWatt: esmutils.KwToW(reading.L1ConsumptionKW),
+		L1ExportWatt: esmutils.KwToW(reading.L1ProductionKW),
+		L2ImportWatt: esmutils.KwToW(reading.L2ConsumptionKW),
+		L2ExportWatt: esmutils.KwToW(reading.L2ProductionKW),
+		L3ImportWatt: esmutils.KwToW(reading.L3ConsumptionKW),
+		L3ExportWatt: esmutils.KwToW(reading.L3ProductionKW),
+	})
+
+	// Store each total power register whose value changed
+	totalsKWH := map[meterdb.MeterDbPowerReadingType]float64{
+		meterdb.PowerConsumptionDay:   reading.TotalConsumptionDayKWH,
+		meterdb.PowerConsumptionNight: reading.TotalConsumptionNightKWH,
+		meterdb.PowerProductionDay:    reading.TotalProductionDayKWH,
+		meterdb.PowerProductionNight:  reading.TotalProductionNightKWH,
+	}
+	for _, readingType := range powerReadingTypes {
+		counter := m.powerCounters[readingType]
+		currentTotalPowerWh := esmutils.KwToW(totalsKWH[readingType])
+		if counter.Known() && currentTotalPowerWh == counter.Value() {
+			continue
+		}
+		if !m.acceptTotal(meterdb.MeterKindElectricity, readingType, counter, currentTotalPowerWh, unixTimestampInt) {
+			continue
+		}
+		batchWriter.QueueTotalPowerReading(&meterdb.MeterDbTotalPowerReading{
+			MeterID:     m.meterID,
+			Timestamp:   unixTimestampInt,
+			Watthour:    currentTotalPowerWh,
+			ReadingType: readingType,
+			SegmentID:   m.currentSegmentID(meterdb.MeterKindElectricity),
+		})
+	}
+
+	m.storeSolarSamples()
+	m.recordEnergyBalance(unixTimestampInt)
+}
+
+// Validate a total against the last accepted one, quarantining it when implausible.
+// Returns true when the value may be stored.
+func (m *meterState) acceptTotal(
+	kind meterdb.MeterDbMeterKind,
+	readingType meterdb.MeterDbPowerReadingType,
+	counter *countercheck.Counter,
+	value uint32,
+	timestamp int64,
+) bool {
+	previousValue := counter.Value()
+	err := counter.Check(value, timestamp)
+	if err == nil {
+		return true
+	}
+
+	log.Printf("Quarantined total of meter %s (kind %d, type %d): %v", m.meterID, kind, readingType, err)
+	batchWriter.QueueQuarantinedReading(&meterdb.MeterDbQuarantinedReading{
+		MeterID:       m.meterID,
+		Timestamp:     timestamp,
+		Kind:          kind,
+		ReadingType:   readingType,
+		PreviousValue: previousValue,
+		Value:         value,
+		Reason:        err.Error(),
+	})
+
+	// The meter keeps reporting consistent values from a new level,
+	// so its counters restarted without the serial changing.
+	if counter.ConsistentRejections() >= counterRestartRejections {
+		log.Printf("Counters of meter %s (kind %d) restarted, starting new counter segment", m.meterID, kind)
+		serial := ""
+		if segment := m.currentSegments[kind]; segment != nil {
+			serial = segment.Serial
+		}
+		if m.startMeterSegment(kind, serial, timestamp) {
+			counter.Reset()
+			return counter.Check(value, timestamp) == nil
+		}
+	}
+	return false
+}
+
+// Start a new counter segment when the meter serial changes.
+// Readings without a serial never trigger a change.
+func (m *meterState) checkMeterChange(kind meterdb.MeterDbMeterKind, serial string, timestamp int64) {
+	current := m.currentSegments[kind]
+	if serial == "" || (current != nil && current.Serial == serial) {
+		return
+	}
+	if current != nil {
+		log.Printf("Meter %s replaced by %s, starting new counter segment", current.Serial, serial)
+	}
+	m.startMeterSegment(kind, serial, timestamp)
+}
+
+// Start a counter segment and reset the counters of that meter kind,
+// unless it is the first segment which continues the existing totals.
+func (m *meterState) startMeterSegment(kind meterdb.MeterDbMeterKind, serial string, timestamp int64) bool {
+	// Pending totals must be stored before the first segment adopts them
+	if err := batchWriter.Flush(); err != nil {
+		log.Printf("Failed to flush before starting counter segment: %v", err)
+	}
+
+	segment, err := meterdb.StartMeterSegment(m.meterID, kind, serial, timestamp)
+	if err != nil {
+		log.Printf("Failed to start counter segment for meter %s: %v", serial, err)
+		return false
+	}
+
+	if m.currentSegments[kind] != nil {
+		if kind == meterdb.MeterKindGas {
+			m.gasCounter.Reset()
+		} else {
+			for _, counter := range m.powerCounters {
+				counter.Reset()
+			}
+		}
+	}
+	m.currentSegments[kind] = segment
+	return true
+}
+
+func (m *meterState) currentSegmentID(kind meterdb.MeterDbMeterKind) int64 {
+	if segment := m.currentSegments[kind]; segment != nil {
+		return segment.ID
+	}
+	return 0
+}
+
+// Load timestamp of the last stored live reading to detect gaps after a restart
+func (m *meterState) loadLastLiveTimestamp() {
+	timestamp, err := meterdb.GetLastLivePowerTimestamp(m.meterID)
+	if err != nil {
+		// No rows is valid, fresh DB
+		if err == sql.ErrNoRows {
+			return
+		}
+		log.Fatalf("Failed to get last live power timestamp: %v", err)
+	}
+	m.lastLiveTimestamp = timestamp
+}
+
+// Load the counter segments of the currently installed meters
+func (m *meterState) loadMeterSegments() {
+	for _, kind := range []meterdb.MeterDbMeterKind{meterdb.MeterKindElectricity, meterdb.MeterKindGas} {
+		segment, err := meterdb.GetCurrentMeterSegment(m.meterID, kind)
+		if err != nil {
+			// No rows is valid, segment starts with the first reading
+			if err == sql.ErrNoRows {
+				continue
+			}
+			log.Fatalf("Failed to get current meter segment: %v", err)
+		}
+		m.currentSegments[kind] = segment
+	}
+}
+
+// Load last totals of the current segments from database
+func (m *meterState) loadLastTotalReadings() {
+	maxWattPerHour := config.ActiveMeterCollectorConfig.MaxPowerKW * 1000
+	for _, readingType := range powerReadingTypes {
+		counter := countercheck.NewCounter(maxWattPerHour)
+		lastTotalPowerReading, err := meterdb.GetLastTotalPowerReading(
+			m.meterID, readingType, m.currentSegmentID(meterdb.MeterKindElectricity),
+		)
+		if err == nil {
+			counter.Set(lastTotalPowerReading.Watthour, lastTotalPowerReading.Timestamp)
+		} else if err != sql.ErrNoRows {
+			// No rows is valid, fresh DB
+			log.Fatalf("Failed to get last total power reading: %v", err)
+		}
+		m.powerCounters[readingType] = counter
+	}
+
+	maxDM3PerHour := config.ActiveMeterCollectorConfig.MaxGasM3PerHour * 1000
+	m.gasCounter = countercheck.NewCounter(maxDM3PerHour)
+	lastTotalGasReading, err := meterdb.GetLastTotalGasReading(m.meterID, m.currentSegmentID(meterdb.MeterKindGas))
+	if err == nil {
+		m.gasCounter.Set(lastTotalGasReading.TotalConsumptionDM3, lastTotalGasReading.Timestamp)
+	} else if err != sql.ErrNoRows {
+		log.Fatalf("Failed to get last total gas reading: %v", err)
+	}
+}
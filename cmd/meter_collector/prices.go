@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/dayahead"
+)
+
+// Import a day-ahead price file into the meter database.
+// Usage: meter_collector import-prices FILE [entsoe_xml|csv]
+func importPrices(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: meter_collector import-prices FILE [%s|%s]", dayahead.FormatEntsoeXML, dayahead.FormatCSV)
+	}
+	path := args[0]
+
+	// Format defaults to the file extension
+	format := dayahead.FormatCSV
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		format = dayahead.FormatEntsoeXML
+	}
+	if len(args) > 1 {
+		format = args[1]
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	prices, err := dayahead.Parse(data, format, dayahead.LoadLocation(config.ActiveTariffConfig.Timezone))
+	if err != nil {
+		return err
+	}
+	if err := dayahead.StorePrices(prices, filepath.Base(path)); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d prices from %s to %s", len(prices),
+		prices[0].Start.Format(time.DateTime), prices[len(prices)-1].Start.Format(time.DateTime))
+	return nil
+}
+
+// Periodically fetch today's and tomorrow's prices from the configured price provider.
+// Day-ahead prices are published around noon, so tomorrow is retried every interval.
+func fetchPrices() {
+	loc := dayahead.LoadLocation(config.ActiveTariffConfig.Timezone)
+	provider := dayahead.NewHTTPProvider(
+		config.ActiveMeterCollectorConfig.PriceProviderURL,
+		config.ActiveMeterCollectorConfig.PriceProviderFormat,
+		loc,
+	)
+	interval := time.Duration(max(config.ActiveMeterCollectorConfig.PriceFetchIntervalMinutes, 1)) * time.Minute
+
+	for {
+		now := dayahead.LocalAsUTC(time.Now(), loc)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		prices, err := provider.GetPrices(today, today.AddDate(0, 0, 2))
+		if err != nil {
+			log.Printf("Failed to fetch day-ahead prices: %v", err)
+		} else if err := dayahead.StorePrices(prices, "http"); err != nil {
+			log.Printf("Failed to store day-ahead prices: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/dayahead"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+// The API keeps serving the last snapshot of an unreachable inverter,
+// which must not be stored or integrated as new samples
+var errSolarStale = errors.New("inverter snapshot is stale")
+
+// Solar production polled from an interpreter API.
+// Samples are kept until the reading loop stores them under the meter's id,
+// and integrated into energy between balance rows.
+type solarIntegrator struct {
+	mutex sync.Mutex
+	// Power samples further apart are not integrated, eg. when the inverter sleeps at night.
+	// The lifetime yield is exact across gaps, so it is preferred when reported.
+	maxSampleGap time.Duration
+
+	lastSample    *solarSample
+	accumulatedWh float64
+	integrated    bool
+	pending       []*solarSample
+}
+
+type solarSample struct {
+	at              time.Time
+	powerWatt       int32
+	lifetimeYieldWh int64 // 0 when not reported
+}
+
+func newSolarIntegrator(pollInterval time.Duration) *solarIntegrator {
+	return &solarIntegrator{maxSampleGap: 3 * pollInterval}
+}
+
+func (s *solarIntegrator) add(sample *solarSample) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if last := s.lastSample; last != nil {
+		if sample.lifetimeYieldWh > 0 && last.lifetimeYieldWh > 0 && sample.lifetimeYieldWh >= last.lifetimeYieldWh {
+			s.accumulatedWh += float64(sample.lifetimeYieldWh - last.lifetimeYieldWh)
+			s.integrated = true
+		} else if gap := sample.at.Sub(last.at); gap <= s.maxSampleGap {
+			s.accumulatedWh += float64(last.powerWatt+sample.powerWatt) / 2 * gap.Hours()
+			s.integrated = true
+		}
+	}
+	s.lastSample = sample
+	s.pending = append(s.pending, sample)
+}
+
+// Energy produced since the previous take, false when nothing could be integrated.
+func (s *solarIntegrator) take() (float64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wh, integrated := s.accumulatedWh, s.integrated
+	s.accumulatedWh = 0
+	s.integrated = false
+	return wh, integrated
+}
+
+// Samples polled since the previous call.
+func (s *solarIntegrator) drain() []*solarSample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
+// Poll solar production from the interpreter API until the process exits.
+func (c *hostCollector) pollSolarProduction(interval time.Duration) {
+	available := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		production, err := interpreter.FetchSolarProduction(c.api)
+		if err == nil && production.Stale {
+			err = errSolarStale
+		}
+		if err != nil {
+			// Only log changes, the inverter is unreachable every night on some models
+			if available {
+				log.Printf("Failed to read solar production from %s: %v", c.api.Host, err)
+				available = false
+			}
+			continue
+		}
+		if !available {
+			log.Printf("Reading solar production from %s again", c.api.Host)
+			available = true
+		}
+		c.solar.add(&solarSample{
+			at:              time.Now(),
+			powerWatt:       production.CurrentProductionW,
+			lifetimeYieldWh: production.LifetimeYieldWh,
+		})
+	}
+}
+
+// Store the solar samples polled since the previous reading.
+// Samples are taken on the system clock, stored in meter local time like everything else.
+func (m *meterState) storeSolarSamples() {
+	if m.solar == nil {
+		return
+	}
+
+	loc := dayahead.LoadLocation(config.ActiveTariffConfig.Timezone)
+	for _, sample := range m.solar.drain() {
+		reading := &meterdb.MeterDbSolarProductionReading{
+			MeterID:   m.meterID,
+			Timestamp: dayahead.LocalAsUTC(sample.at, loc).Unix(),
+			PowerWatt: sample.powerWatt,
+		}
+		if sample.lifetimeYieldWh > 0 {
+			yield := sample.lifetimeYieldWh
+			reading.LifetimeYieldWh = &yield
+		}
+		batchWriter.QueueSolarProductionReading(reading)
+	}
+}
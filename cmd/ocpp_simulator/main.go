@@ -0,0 +1,202 @@
+// Simulates an OCPP 1.6J wallbox with a car plugged in, for development without hardware.
+// The car charges at the limit of the last charging profile and stops below 6 A.
+//
+//	ocpp_simulator -url ws://127.0.0.1:9039/ocpp/SIM001 -phases 3 -max-current 16
+//
+// Enable ocpp_enabled in interpreter_api.toml, and set the load control actuator to ocpp.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/ocpp"
+	"github.com/gorilla/websocket"
+)
+
+// Charging stops below the minimum current of IEC 61851
+const minCurrentA = 6
+
+type simulatedCharger struct {
+	phases      int
+	maxCurrentA float64
+	idTag       string
+	password    string
+
+	mutex    sync.Mutex
+	limitA   float64 // Current allowed by the last charging profile
+	energyWh float64
+}
+
+func main() {
+	url := flag.String("url", "ws://127.0.0.1:9039/ocpp/SIM001", "central system URL ending with the charge point id")
+	phases := flag.Int("phases", 3, "phases the car charges on")
+	maxCurrent := flag.Float64("max-current", 16, "maximum charging current in amps")
+	interval := flag.Duration("interval", 10*time.Second, "meter values interval")
+	idTag := flag.String("id-tag", "SIMULATOR", "id tag used to start the transaction")
+	password := flag.String("password", "", "basic auth password of the charge point, sent with its id as username")
+	flag.Parse()
+
+	charger := &simulatedCharger{
+		phases:      *phases,
+		maxCurrentA: *maxCurrent,
+		idTag:       *idTag,
+		password:    *password,
+		limitA:      *maxCurrent,
+		energyWh:    1_000_000,
+	}
+	for {
+		if err := charger.run(*url, *interval); err != nil {
+			log.Printf("Connection to central system failed: %v", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// Connect, start a transaction and send meter values until the connection fails.
+func (s *simulatedCharger) run(url string, interval time.Duration) error {
+	dialer := websocket.Dialer{Subprotocols: []string{ocpp.Subprotocol}, HandshakeTimeout: 10 * time.Second}
+	header := http.Header{}
+	if s.password != "" {
+		id := url[strings.LastIndex(url, "/")+1:]
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(id+":"+s.password)))
+	}
+	ws, _, err := dialer.Dial(url, header)
+	if err != nil {
+		return err
+	}
+	conn := ocpp.NewConn(ws, s.handleCall)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- conn.Serve() }()
+	defer conn.Close()
+	log.Printf("Connected to %s", url)
+
+	var boot ocpp.BootNotificationResponse
+	if err := conn.Call("BootNotification", &ocpp.BootNotificationRequest{
+		ChargePointVendor: "European Smart Meter",
+		ChargePointModel:  "Simulated Wallbox",
+	}, &boot); err != nil {
+		return err
+	}
+	heartbeat := time.Duration(max(boot.Interval, 10)) * time.Second
+
+	var start ocpp.StartTransactionResponse
+	if err := conn.Call("StartTransaction", &ocpp.StartTransactionRequest{
+		ConnectorID: 1,
+		IdTag:       s.idTag,
+		MeterStart:  int(s.energy()),
+		Timestamp:   time.Now().UTC(),
+	}, &start); err != nil {
+		return err
+	}
+	log.Printf("Started transaction %d", start.TransactionID)
+
+	meterTicker := time.NewTicker(interval)
+	defer meterTicker.Stop()
+	heartbeatTicker := time.NewTicker(heartbeat)
+	defer heartbeatTicker.Stop()
+	lastStatus := ""
+	lastMeterValues := time.Now()
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case <-heartbeatTicker.C:
+			if err := conn.Call("Heartbeat", &ocpp.HeartbeatRequest{}, nil); err != nil {
+				return err
+			}
+		case now := <-meterTicker.C:
+			powerW, currentA := s.charge(now.Sub(lastMeterValues))
+			lastMeterValues = now
+
+			status := "Charging"
+			if powerW == 0 {
+				status = "SuspendedEVSE"
+			}
+			if status != lastStatus {
+				if err := conn.Call("StatusNotification", &ocpp.StatusNotificationRequest{
+					ConnectorID: 1,
+					ErrorCode:   "NoError",
+					Status:      status,
+				}, nil); err != nil {
+					return err
+				}
+				lastStatus = status
+			}
+
+			transactionID := start.TransactionID
+			if err := conn.Call("MeterValues", &ocpp.MeterValuesRequest{
+				ConnectorID:   1,
+				TransactionID: &transactionID,
+				MeterValue: []ocpp.MeterValue{{
+					Timestamp: now.UTC(),
+					SampledValue: []ocpp.SampledValue{
+						{Value: strconv.FormatFloat(powerW, 'f', 0, 64), Measurand: ocpp.MeasurandPowerActiveImport, Unit: "W"},
+						{Value: strconv.FormatFloat(currentA, 'f', 1, 64), Measurand: ocpp.MeasurandCurrentImport, Unit: "A"},
+						{Value: strconv.FormatFloat(s.energy(), 'f', 0, 64), Measurand: ocpp.MeasurandEnergyActiveImportRegister, Unit: "Wh"},
+					},
+				}},
+			}, nil); err != nil {
+				return err
+			}
+			log.Printf("Charging at %.0f W (%.1f A)", powerW, currentA)
+		}
+	}
+}
+
+func (s *simulatedCharger) handleCall(action string, payload json.RawMessage) (any, error) {
+	switch action {
+	case "SetChargingProfile":
+		var request ocpp.SetChargingProfileRequest
+		if err := ocpp.DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		schedule := request.CSChargingProfiles.ChargingSchedule
+		if len(schedule.ChargingSchedulePeriod) == 0 {
+			return &ocpp.SetChargingProfileResponse{Status: ocpp.ChargingProfileStatusRejected}, nil
+		}
+		limit := schedule.ChargingSchedulePeriod[0].Limit
+		if schedule.ChargingRateUnit == ocpp.ChargingRateUnitW {
+			limit /= 230 * float64(s.phases)
+		}
+		s.mutex.Lock()
+		s.limitA = limit
+		s.mutex.Unlock()
+		log.Printf("Charging profile limit %.1f %s", schedule.ChargingSchedulePeriod[0].Limit, schedule.ChargingRateUnit)
+		return &ocpp.SetChargingProfileResponse{Status: ocpp.ChargingProfileStatusAccepted}, nil
+
+	case "ClearChargingProfile":
+		s.mutex.Lock()
+		s.limitA = s.maxCurrentA
+		s.mutex.Unlock()
+		return map[string]string{"status": "Accepted"}, nil
+	}
+	return nil, &ocpp.CallError{Code: ocpp.ErrorCodeNotImplemented, Description: action + " is not simulated"}
+}
+
+// Charge for elapsed at the allowed current, returns the power and current.
+func (s *simulatedCharger) charge(elapsed time.Duration) (float64, float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	currentA := math.Min(s.limitA, s.maxCurrentA)
+	if currentA < minCurrentA {
+		return 0, 0
+	}
+	powerW := currentA * 230 * float64(s.phases)
+	s.energyWh += powerW * elapsed.Hours()
+	return powerW, currentA
+}
+
+func (s *simulatedCharger) energy() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.energyWh
+}
@@ -11,69 +11,221 @@ import (
 var (
 	ActiveInterpreterAPIConfig *InterpreterAPIConfig
 	ActiveMeterCollectorConfig *MeterCollectorConfig
+	ActiveTariffConfig         *TariffConfig
+	ActiveLoadControlConfig    *LoadControlConfig
+	ActiveRulesConfig          *RulesConfig
 )
 
 func LoadInterpreterAPIConfig() error {
 	configPath := filepath.Join(pathing.GetConfigDir(), "interpreter_api.toml")
-
-	// Create default if not exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		cfg := &InterpreterAPIConfig{
-			SerialDevice:            "/dev/ttyUSB0",
-			Baudrate:                115200,
-			ListenAddress:           "0.0.0.0",
-			ListenPort:              9039,
-			SolarInverterIp:         "192.168.200.1",
-			SolarInverterModbusPort: 502,
-			WlanConnectionId:        "preconfigured", // Check with `nmcli device status`
-		}
-		// Create file
-		cfgFile, err := os.Create(configPath)
-		if err != nil {
-			return err
-		}
-		defer cfgFile.Close()
-		toml.NewEncoder(cfgFile).Encode(cfg)
-		ActiveInterpreterAPIConfig = cfg
-		return nil
+	cfg := &InterpreterAPIConfig{
+		SerialDevice:              "/dev/ttyUSB0",
+		Baudrate:                  115200,
+		ListenAddress:             "0.0.0.0",
+		ListenPort:                9039,
+		TLSCertFile:               "",
+		TLSKeyFile:                "",
+		TLSClientCAFile:           "",
+		APITokens:                 []string{},
+		BasicAuthUsername:         "",
+		BasicAuthPassword:         "",
+		AllowedOrigins:            []string{},
+		SolarInverterDriver:       "huawei",
+		SolarInverterTransport:    "tcp",
+		SolarInverterIp:           "192.168.200.1",
+		SolarInverterModbusPort:   502,
+		SolarInverterSerialDevice: "",
+		SolarInverterBaudrate:     9600,
+		SolarInverterSlaveID:      0,
+		WlanConnectionId:          "preconfigured", // Check with `nmcli device status`
+		SolarPollIntervalSeconds:  30,
+		ReadingBufferSize:         3600,
+		PersistReadingBuffer:      false,
+		WebSocketMaxClients:       100,
+		WebSocketQueueSize:        16,
+		GRPCListenPort:            0,
+		VirtualMeterPort:          0,
+		VirtualMeterProfile:       "sdm630",
+		DeviceEmulationPort:       0,
+		DeviceEmulationMDNS:       true,
+		OCPPEnabled:               false,
+		OCPPChargePointIDs:        []string{},
+		OCPPChargePointPasswords:  map[string]string{},
 	}
-
-	// Load existing config
-	var config InterpreterAPIConfig
-	_, err := toml.DecodeFile(configPath, &config)
-	if err != nil {
+	if err := loadOrCreate(configPath, cfg); err != nil {
 		return err
 	}
-	ActiveInterpreterAPIConfig = &config
+	ActiveInterpreterAPIConfig = cfg
 	return nil
 }
 
 func LoadMeterCollectorConfig() error {
 	configPath := filepath.Join(pathing.GetConfigDir(), "meter_collector.toml")
+	cfg := &MeterCollectorConfig{
+		InterpreterAPIHost:           "localhost:9039",
+		TLSEnabled:                   false,
+		APIToken:                     "",
+		TLSCAFile:                    "",
+		TLSClientCertFile:            "",
+		TLSClientKeyFile:             "",
+		BatchFlushIntervalSeconds:    30,
+		BatchMaxRows:                 300,
+		GapThresholdSeconds:          15,
+		MaxPowerKW:                   50,
+		MaxGasM3PerHour:              10,
+		PriceProviderURL:             "",
+		PriceProviderFormat:          "entsoe_xml",
+		PriceFetchIntervalMinutes:    60,
+		SolarPollIntervalSeconds:     30,
+		EnergyBalanceIntervalSeconds: 300,
+	}
+	if err := loadOrCreate(configPath, cfg); err != nil {
+		return err
+	}
+	ActiveMeterCollectorConfig = cfg
+	return nil
+}
 
+// Example prices, adjust to your energy contract.
+func LoadTariffConfig() error {
+	configPath := filepath.Join(pathing.GetConfigDir(), "tariffs.toml")
+	cfg := &TariffConfig{
+		Timezone:   "Europe/Brussels",
+		Currency:   "EUR",
+		VATPercent: 6,
+		Electricity: ElectricityTariffConfig{
+			Type:                   "day_night",
+			PriceKWH:               0.30,
+			DayPriceKWH:            0.32,
+			NightPriceKWH:          0.26,
+			DynamicPriceMultiplier: 1,
+			DynamicPriceMarkupKWH:  0.02,
+			HourlyPricesKWH:        []float64{},
+			InjectionPriceKWH:      0.04,
+			CapacityPriceKWYear:    45,
+			CapacityMinimumKW:      2.5,
+			FixedMonthlyFee:        5,
+		},
+		Gas: GasTariffConfig{
+			PriceM3:         1.10,
+			FixedMonthlyFee: 5,
+		},
+	}
+	if err := loadOrCreate(configPath, cfg); err != nil {
+		return err
+	}
+	ActiveTariffConfig = cfg
+	return nil
+}
+
+// Disabled by default, the simulated actuator only logs its setpoint.
+func LoadLoadControlConfig() error {
+	configPath := filepath.Join(pathing.GetConfigDir(), "load_control.toml")
+	cfg := &LoadControlConfig{
+		Enabled:                     false,
+		Mode:                        "solar_surplus",
+		IntervalSeconds:             5,
+		MinPowerW:                   0,
+		MaxPowerW:                   11000,
+		HysteresisW:                 200,
+		ExportLimitW:                0,
+		StartPowerW:                 1380,
+		PeakLimitW:                  2500,
+		PeakLimitFromCapacityTariff: false,
+		MaxReadingAgeSeconds:        15,
+		Actuator: ActuatorConfig{
+			Type:                 "simulated",
+			ModbusAddress:        "",
+			ModbusSlaveID:        1,
+			ModbusRegister:       0,
+			ModbusRegisterType:   "int32",
+			ModbusScale:          1,
+			HTTPMethod:           "POST",
+			HTTPURL:              "",
+			HTTPBody:             `{"power_w": {power_w}}`,
+			HTTPContentType:      "application/json",
+			OCPPChargePointID:    "",
+			OCPPConnectorID:      0,
+			OCPPChargingRateUnit: "A",
+			OCPPPhases:           3,
+		},
+	}
+	if err := loadOrCreate(configPath, cfg); err != nil {
+		return err
+	}
+	ActiveLoadControlConfig = cfg
+	return nil
+}
+
+func GetRulesConfigPath() string {
+	return filepath.Join(pathing.GetConfigDir(), "rules.toml")
+}
+
+// Example rules, disabled until an action is configured.
+func LoadRulesConfig() error {
+	cfg := &RulesConfig{
+		Rules: []RuleConfig{
+			{
+				Name:           "High export",
+				Metric:         "export_kw",
+				Operator:       ">",
+				Value:          3,
+				ForSeconds:     600,
+				RecoverSeconds: 60,
+				NotifyRecovery: true,
+				Actions:        []string{"webhook"},
+			},
+			{
+				Name:           "No telegram",
+				Metric:         "telegram_age_seconds",
+				Operator:       ">",
+				Value:          60,
+				NotifyRecovery: true,
+				Actions:        []string{"webhook"},
+			},
+			{
+				Name:     "Electricity switched off",
+				Metric:   "switch_electricity",
+				Operator: "==",
+				Value:    0,
+				Actions:  []string{"webhook"},
+			},
+		},
+		Actions: []RuleActionConfig{
+			{
+				Name:   "webhook",
+				Type:   "webhook",
+				URL:    "http://localhost:8080/notify",
+				Method: "POST",
+			},
+		},
+	}
+	// Decoding over the examples would let rules inherit their values
+	if _, err := os.Stat(GetRulesConfigPath()); err == nil {
+		cfg = &RulesConfig{}
+	}
+	if err := loadOrCreate(GetRulesConfigPath(), cfg); err != nil {
+		return err
+	}
+	ActiveRulesConfig = cfg
+	return nil
+}
+
+// Write cfg as the default config if configPath does not exist yet,
+// otherwise decode the existing file over it.
+// Keys missing from older config files keep their default value.
+func loadOrCreate(configPath string, cfg any) error {
 	// Create default if not exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		cfg := &MeterCollectorConfig{
-			InterpreterAPIHost: "localhost:9039",
-			TLSEnabled:         false,
-		}
-		// Create file
 		cfgFile, err := os.Create(configPath)
 		if err != nil {
 			return err
 		}
 		defer cfgFile.Close()
-		toml.NewEncoder(cfgFile).Encode(cfg)
-		ActiveMeterCollectorConfig = cfg
-		return nil
+		return toml.NewEncoder(cfgFile).Encode(cfg)
 	}
 
 	// Load existing config
-	var config MeterCollectorConfig
-	_, err := toml.DecodeFile(configPath, &config)
-	if err != nil {
-		return err
-	}
-	ActiveMeterCollectorConfig = &config
-	return nil
+	_, err := toml.DecodeFile(configPath, cfg)
+	return err
 }
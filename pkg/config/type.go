@@ -3,16 +3,264 @@ package config
 type MeterCollectorConfig struct {
 	InterpreterAPIHost string `toml:"interpreter_api_host"`
 	TLSEnabled         bool   `toml:"tls_enabled"`
+	// Sent as a bearer token when the interpreter API requires one
+	APIToken string `toml:"api_token"`
+	// CA for self-signed interpreter API certificates, and a client certificate
+	// for interpreter APIs that require one. Leave empty when not needed.
+	TLSCAFile         string `toml:"tls_ca_file"`
+	TLSClientCertFile string `toml:"tls_client_cert_file"`
+	TLSClientKeyFile  string `toml:"tls_client_key_file"`
+	// Additional interpreter APIs, one per meter, eg. a second building.
+	AdditionalInterpreterAPIs []InterpreterAPIHostConfig `toml:"additional_interpreter_apis,omitempty"`
+	// Readings are buffered and committed in one transaction
+	// every interval or once this many rows are pending.
+	BatchFlushIntervalSeconds int `toml:"batch_flush_interval_seconds"`
+	BatchMaxRows              int `toml:"batch_max_rows"`
+	// Time between stored readings that is considered missing data.
+	// Missing readings are requested from the interpreter API on reconnect.
+	GapThresholdSeconds int `toml:"gap_threshold_seconds"`
+	// Physical limits of the connection, faster increasing totals are quarantined.
+	MaxPowerKW      float64 `toml:"max_power_kw"`
+	MaxGasM3PerHour float64 `toml:"max_gas_m3_per_hour"`
+	// Optional day-ahead price source, see dayahead.HTTPProvider.
+	// Format is "entsoe_xml" or "csv".
+	PriceProviderURL          string `toml:"price_provider_url"`
+	PriceProviderFormat       string `toml:"price_provider_format"`
+	PriceFetchIntervalMinutes int    `toml:"price_fetch_interval_minutes"`
+	// Solar production is polled from the interpreter API's /solar endpoint
+	// and combined with import and export into energy balance rows.
+	// Set the poll interval to 0 when no inverter is connected.
+	SolarPollIntervalSeconds     int `toml:"solar_poll_interval_seconds"`
+	EnergyBalanceIntervalSeconds int `toml:"energy_balance_interval_seconds"`
+}
+
+type InterpreterAPIHostConfig struct {
+	Host              string `toml:"host"`
+	TLSEnabled        bool   `toml:"tls_enabled"`
+	APIToken          string `toml:"api_token,omitempty"`
+	TLSCAFile         string `toml:"tls_ca_file,omitempty"`
+	TLSClientCertFile string `toml:"tls_client_cert_file,omitempty"`
+	TLSClientKeyFile  string `toml:"tls_client_key_file,omitempty"`
+}
+
+// All interpreter APIs to collect from, without duplicates.
+func (c *MeterCollectorConfig) GetInterpreterAPIs() []InterpreterAPIHostConfig {
+	apis := make([]InterpreterAPIHostConfig, 0, len(c.AdditionalInterpreterAPIs)+1)
+	seen := map[string]bool{}
+	add := func(api InterpreterAPIHostConfig) {
+		if api.Host == "" || seen[api.Host] {
+			return
+		}
+		seen[api.Host] = true
+		apis = append(apis, api)
+	}
+
+	add(InterpreterAPIHostConfig{
+		Host:              c.InterpreterAPIHost,
+		TLSEnabled:        c.TLSEnabled,
+		APIToken:          c.APIToken,
+		TLSCAFile:         c.TLSCAFile,
+		TLSClientCertFile: c.TLSClientCertFile,
+		TLSClientKeyFile:  c.TLSClientKeyFile,
+	})
+	for _, api := range c.AdditionalInterpreterAPIs {
+		add(api)
+	}
+	return apis
 }
 
 type InterpreterAPIConfig struct {
-	SerialDevice            string `toml:"serial_device"`
-	Baudrate                uint   `toml:"baudrate"`
-	ListenAddress           string `toml:"listen_address"`
-	ListenPort              int    `toml:"listen_port"`
-	SolarInverterIp         string `toml:"solar_inverter_ip"`
-	SolarInverterModbusPort int    `toml:"solar_inverter_modbus_port"`
-	// Should be named `preconfigured`
+	SerialDevice  string `toml:"serial_device"`
+	Baudrate      uint   `toml:"baudrate"`
+	ListenAddress string `toml:"listen_address"`
+	ListenPort    int    `toml:"listen_port"`
+	// Serve HTTPS and wss:// when both are set
+	TLSCertFile string `toml:"tls_cert_file"`
+	TLSKeyFile  string `toml:"tls_key_file"`
+	// Clients presenting a certificate signed by this CA are authenticated.
+	// Without tokens or basic auth, a client certificate is required.
+	TLSClientCAFile string `toml:"tls_client_ca_file"`
+	// Accepted as "Authorization: Bearer TOKEN" or ?token=TOKEN, for clients that cannot set headers.
+	// Without tokens, basic auth or a client CA, the API is open to the network.
+	APITokens         []string `toml:"api_tokens"`
+	BasicAuthUsername string   `toml:"basic_auth_username"`
+	BasicAuthPassword string   `toml:"basic_auth_password"`
+	// Browser origins allowed to use the API and websocket, eg. "https://dashboard.example.com".
+	// "*" allows any origin, when empty only pages served from the API's own host are allowed.
+	AllowedOrigins []string `toml:"allowed_origins"`
+	// Inverter driver, "huawei" or "sunspec" (SMA, Fronius, SolarEdge, ...)
+	SolarInverterDriver string `toml:"solar_inverter_driver"`
+	// "tcp" for Modbus TCP or "rtu" for Modbus RTU over a serial RS485 adapter
+	SolarInverterTransport    string `toml:"solar_inverter_transport"`
+	SolarInverterIp           string `toml:"solar_inverter_ip"`
+	SolarInverterModbusPort   int    `toml:"solar_inverter_modbus_port"`
+	SolarInverterSerialDevice string `toml:"solar_inverter_serial_device"`
+	SolarInverterBaudrate     int    `toml:"solar_inverter_baudrate"`
+	// Huawei uses 0 over the WLAN dongle, SunSpec inverters usually 1
+	SolarInverterSlaveID int `toml:"solar_inverter_slave_id"`
+	// Wi-Fi connection to the inverter's access point, reconnected when it drops.
+	// Should be named `preconfigured`, leave empty when the inverter is on the LAN
 	// Check with `nmcli device status`
 	WlanConnectionId string `toml:"wlan_connection_id"`
+	// The inverter is read in the background, /solar serves the latest reading
+	SolarPollIntervalSeconds int `toml:"solar_poll_interval_seconds"`
+	// Number of recent readings kept for /since, one per second on most meters.
+	ReadingBufferSize int `toml:"reading_buffer_size"`
+	// Save the recent readings to disk so they survive a restart
+	PersistReadingBuffer bool `toml:"persist_reading_buffer"`
+	// Websocket clients beyond this are refused with 503
+	WebSocketMaxClients int `toml:"websocket_max_clients"`
+	// Messages queued per websocket client, the oldest are dropped when a client falls behind
+	WebSocketQueueSize int `toml:"websocket_queue_size"`
+	// gRPC server on listen_address, disabled when 0. Uses the same TLS and authentication,
+	// tokens are sent as "authorization: Bearer TOKEN" metadata.
+	GRPCListenPort int `toml:"grpc_listen_port"`
+	// Modbus TCP energy meter on listen_address for inverters and batteries doing zero-export control,
+	// disabled when 0, usually 502. Profile is sdm630 (input registers) or sunspec (model 203 at 40000).
+	VirtualMeterPort    int    `toml:"virtual_meter_port"`
+	VirtualMeterProfile string `toml:"virtual_meter_profile"`
+	// Local APIs of a HomeWizard P1 meter (/api/v1/data) and a Shelly Pro 3EM (/rpc) on listen_address,
+	// disabled when 0, usually 80. Without authentication, like the real devices. With mDNS enabled
+	// both devices are advertised so apps and batteries discover them.
+	DeviceEmulationPort int  `toml:"device_emulation_port"`
+	DeviceEmulationMDNS bool `toml:"device_emulation_mdns"`
+	// OCPP 1.6J central system for wallboxes, connecting to ws://host:port/ocpp/{chargePointId}.
+	// Only the listed charge point ids may connect, any when empty.
+	// Charge points do not use the API authentication but basic auth with their id as username
+	// and the password by charge point id, required from every charge point once any is set.
+	OCPPEnabled              bool              `toml:"ocpp_enabled"`
+	OCPPChargePointIDs       []string          `toml:"ocpp_charge_point_ids"`
+	OCPPChargePointPasswords map[string]string `toml:"ocpp_charge_point_passwords"`
+}
+
+// Energy prices used to calculate costs. Prices exclude VAT.
+type TariffConfig struct {
+	// Timezone of the meter clock, used to align market prices with readings
+	Timezone    string                  `toml:"timezone"`
+	Currency    string                  `toml:"currency"`
+	VATPercent  float64                 `toml:"vat_percent"`
+	Electricity ElectricityTariffConfig `toml:"electricity"`
+	Gas         GasTariffConfig         `toml:"gas"`
+}
+
+type ElectricityTariffConfig struct {
+	// "fixed", "day_night" or "dynamic_hourly"
+	Type          string  `toml:"type"`
+	PriceKWH      float64 `toml:"price_kwh"`
+	DayPriceKWH   float64 `toml:"day_price_kwh"`
+	NightPriceKWH float64 `toml:"night_price_kwh"`
+	// dynamic_hourly: price = day-ahead price * multiplier + markup.
+	// The 24 prices by hour of the day are used when no day-ahead price is known.
+	DynamicPriceMultiplier float64   `toml:"dynamic_price_multiplier"`
+	DynamicPriceMarkupKWH  float64   `toml:"dynamic_price_markup_kwh"`
+	HourlyPricesKWH        []float64 `toml:"hourly_prices_kwh"`
+	// Compensation received per exported kWh
+	InjectionPriceKWH float64 `toml:"injection_price_kwh"`
+	// Capacity tariff on the highest 15 minute average import of each month
+	CapacityPriceKWYear float64 `toml:"capacity_price_kw_year"`
+	CapacityMinimumKW   float64 `toml:"capacity_minimum_kw"`
+	FixedMonthlyFee     float64 `toml:"fixed_monthly_fee"`
+}
+
+type GasTariffConfig struct {
+	PriceM3         float64 `toml:"price_m3"`
+	FixedMonthlyFee float64 `toml:"fixed_monthly_fee"`
+}
+
+// Control of a home battery or EV charger by the grid power measured by the meter.
+// Power is positive when the device consumes (charges) and negative when a battery discharges.
+type LoadControlConfig struct {
+	Enabled bool `toml:"enabled"`
+	// "zero_export", "solar_surplus" or "peak_shaving"
+	Mode            string `toml:"mode"`
+	IntervalSeconds int    `toml:"interval_seconds"`
+	// Limits of the setpoint, use a negative minimum to let a battery discharge
+	MinPowerW float64 `toml:"min_power_w"`
+	MaxPowerW float64 `toml:"max_power_w"`
+	// Setpoint changes smaller than this are not sent to the device
+	HysteresisW float64 `toml:"hysteresis_w"`
+	// zero_export: export that is allowed before the device starts consuming
+	ExportLimitW float64 `toml:"export_limit_w"`
+	// solar_surplus: charging starts once the surplus reaches this power
+	// and stops when it drops hysteresis_w below it, eg. 1380 W for 6 A on one phase
+	StartPowerW float64 `toml:"start_power_w"`
+	// peak_shaving: grid import is kept below this, eg. the capacity tariff peak
+	PeakLimitW float64 `toml:"peak_limit_w"`
+	// Raise the peak limit to the highest 15 minute import of this month,
+	// capacity below the peak that is already billed is free to use.
+	// Requires the Meter Collector database.
+	PeakLimitFromCapacityTariff bool `toml:"peak_limit_from_capacity_tariff"`
+	// The setpoint falls back to 0 when no reading was received for this long
+	MaxReadingAgeSeconds int            `toml:"max_reading_age_seconds"`
+	Actuator             ActuatorConfig `toml:"actuator"`
+}
+
+type ActuatorConfig struct {
+	// "simulated", "modbus", "http" or "ocpp"
+	Type string `toml:"type"`
+	// modbus: register written over Modbus TCP with function 16.
+	// Register type is "int16", "uint16", "int32" or "uint32", 32 bit values high word first.
+	// The register value is the power in watts times the scale, eg. 0.001 for kW.
+	ModbusAddress      string  `toml:"modbus_address"`
+	ModbusSlaveID      int     `toml:"modbus_slave_id"`
+	ModbusRegister     int     `toml:"modbus_register"`
+	ModbusRegisterType string  `toml:"modbus_register_type"`
+	ModbusScale        float64 `toml:"modbus_scale"`
+	// http: {power_w} and {power_kw} in the URL and body are replaced by the setpoint
+	HTTPMethod      string `toml:"http_method"`
+	HTTPURL         string `toml:"http_url"`
+	HTTPBody        string `toml:"http_body"`
+	HTTPContentType string `toml:"http_content_type"`
+	// ocpp: charge point connected to the interpreter API's OCPP central system.
+	// An empty id selects the only connected charge point, connector 0 limits all connectors.
+	// The charging rate unit is "W" or "A", amps are calculated at 230 V per phase.
+	OCPPChargePointID    string `toml:"ocpp_charge_point_id"`
+	OCPPConnectorID      int    `toml:"ocpp_connector_id"`
+	OCPPChargingRateUnit string `toml:"ocpp_charging_rate_unit"`
+	OCPPPhases           int    `toml:"ocpp_phases"`
+}
+
+// Notification rules evaluated against the live readings, reloaded when the file changes.
+type RulesConfig struct {
+	Rules   []RuleConfig       `toml:"rules"`
+	Actions []RuleActionConfig `toml:"actions"`
+}
+
+// Fires when metric compared to value holds for for_seconds,
+// and recovers once it no longer holds for recover_seconds.
+type RuleConfig struct {
+	Name    string `toml:"name"`
+	Enabled bool   `toml:"enabled"`
+	// A reading field such as l1_voltage_v, or one of export_kw, import_kw, net_kw,
+	// max_voltage_v, min_voltage_v, max_current_a, gas_m3_per_hour and telegram_age_seconds
+	Metric string `toml:"metric"`
+	// ">", ">=", "<", "<=", "==" or "!="
+	Operator       string  `toml:"operator"`
+	Value          float64 `toml:"value"`
+	ForSeconds     int     `toml:"for_seconds"`
+	RecoverSeconds int     `toml:"recover_seconds"`
+	NotifyRecovery bool    `toml:"notify_recovery"`
+	// Names of the actions to run
+	Actions []string `toml:"actions"`
+}
+
+// Templates may contain {rule}, {state}, {metric}, {operator}, {threshold}, {value} and {timestamp}.
+type RuleActionConfig struct {
+	Name string `toml:"name"`
+	// "webhook", "mqtt" or "exec"
+	Type string `toml:"type"`
+	// webhook: the event is posted as JSON unless a body is set
+	URL         string `toml:"url,omitempty"`
+	Method      string `toml:"method,omitempty"`
+	Body        string `toml:"body,omitempty"`
+	ContentType string `toml:"content_type,omitempty"`
+	// mqtt: the event is published as JSON unless a body is set,
+	// broker is tcp://host:1883 or tls://host:8883
+	Broker   string `toml:"broker,omitempty"`
+	Topic    string `toml:"topic,omitempty"`
+	Username string `toml:"username,omitempty"`
+	Password string `toml:"password,omitempty"`
+	Retain   bool   `toml:"retain,omitempty"`
+	// exec: command and arguments, run without a shell
+	Command []string `toml:"command,omitempty"`
 }
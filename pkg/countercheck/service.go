@@ -0,0 +1,116 @@
+// Sanity checks for cumulative meter registers.
+// Totals reported by a meter may only increase, and only as fast as
+// the connection physically allows. Anything else is a bad parse,
+// a glitch or a replaced meter and should not be stored as a delta.
+package countercheck
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrZeroValue       = errors.New("counter dropped to zero")
+	ErrCounterDecrease = errors.New("counter decreased")
+	ErrImplausibleJump = errors.New("counter increased faster than physically possible")
+)
+
+// Allow a few units over the max rate, totals are rounded by the meter.
+const roundingSlack = 10
+
+// Counter tracks the last accepted value of a single register.
+type Counter struct {
+	maxIncreasePerHour float64
+
+	known     bool
+	value     uint32
+	timestamp int64
+
+	// Consecutive non-zero values below the last accepted one that were increasing among themselves.
+	// A long streak means the counter really restarted at a new level.
+	consistentRejections int
+	lastRejected         uint32
+}
+
+// Create a counter allowing at most maxIncreasePerHour units per hour.
+// Eg. Wh per hour for electricity equals the max power in W.
+func NewCounter(maxIncreasePerHour float64) *Counter {
+	return &Counter{maxIncreasePerHour: maxIncreasePerHour}
+}
+
+// Set the last known value, eg. from the database on startup.
+func (c *Counter) Set(value uint32, timestamp int64) {
+	c.known = true
+	c.value = value
+	c.timestamp = timestamp
+	c.consistentRejections = 0
+}
+
+// Forget the last known value, the next value is accepted as is.
+// Used when a meter is replaced and its counters start over.
+func (c *Counter) Reset() {
+	c.known = false
+	c.value = 0
+	c.timestamp = 0
+	c.consistentRejections = 0
+}
+
+func (c *Counter) Value() uint32 {
+	return c.value
+}
+
+func (c *Counter) Known() bool {
+	return c.known
+}
+
+// Number of consecutive rejections that were consistent with each other.
+func (c *Counter) ConsistentRejections() int {
+	return c.consistentRejections
+}
+
+// Validate value against the last accepted one.
+// Accepted values become the new reference, rejected values are only tracked.
+// Zero values, eg. from a dropped M-Bus link or a garbled telegram, never count toward a restart
+// and do not interrupt a streak. Values jumping above the last accepted one end the streak.
+func (c *Counter) Check(value uint32, timestamp int64) error {
+	err := c.validate(value, timestamp)
+	if err != nil {
+		switch {
+		case value == 0:
+		case !errors.Is(err, ErrCounterDecrease):
+			c.consistentRejections = 0
+		case c.consistentRejections > 0 && value >= c.lastRejected:
+			c.consistentRejections++
+			c.lastRejected = value
+		default:
+			c.consistentRejections = 1
+			c.lastRejected = value
+		}
+		return err
+	}
+
+	c.Set(value, timestamp)
+	return nil
+}
+
+func (c *Counter) validate(value uint32, timestamp int64) error {
+	if !c.known {
+		return nil
+	}
+	if value == 0 && c.value > 0 {
+		return ErrZeroValue
+	}
+	if value < c.value {
+		return fmt.Errorf("%w: %d to %d", ErrCounterDecrease, c.value, value)
+	}
+
+	elapsedHours := float64(timestamp-c.timestamp) / 3600
+	if elapsedHours < 0 {
+		elapsedHours = 0
+	}
+	maxIncrease := c.maxIncreasePerHour*elapsedHours + roundingSlack
+	if float64(value-c.value) > maxIncrease {
+		return fmt.Errorf("%w: %d to %d in %.0fs", ErrImplausibleJump, c.value, value, elapsedHours*3600)
+	}
+	return nil
+}
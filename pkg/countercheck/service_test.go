@@ -0,0 +1,137 @@
+package countercheck
+
+import (
+	"errors"
+	"testing"
+)
+
+// Max power of 10 kW, in Wh per hour
+const testMaxIncreasePerHour = 10000
+
+// Collector restarts the counter after this many consistent rejections
+const testRestartRejections = 10
+
+type step struct {
+	// reset and set run before the check of value
+	reset bool
+	set   bool
+
+	value   uint32
+	at      int64
+	wantErr error
+	// Consistent rejections after the step
+	wantStreak int
+}
+
+func TestCounterCheck(t *testing.T) {
+	restart := []step{{set: true, value: 500_000, at: 0}}
+	for i := range testRestartRejections {
+		restart = append(restart, step{value: 1_000 + uint32(i)*10, at: int64(i+1) * 10, wantErr: ErrCounterDecrease, wantStreak: i + 1})
+	}
+	// The collector resets a counter once the streak reaches the threshold
+	restart = append(restart, step{reset: true, value: 1_100, at: 110})
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first value is accepted", []step{
+			{value: 123_456, at: 0},
+		}},
+		{"normal increase", []step{
+			{set: true, value: 100_000, at: 0},
+			// 1 kW for an hour
+			{value: 101_000, at: 3600},
+			// Unchanged
+			{value: 101_000, at: 3610},
+			// Within the rounding slack without time passing
+			{value: 101_010, at: 3610},
+		}},
+		{"implausible jump", []step{
+			{set: true, value: 100_000, at: 0},
+			// 20 kWh in an hour with a 10 kW connection
+			{value: 120_000, at: 3600, wantErr: ErrImplausibleJump},
+			// Still compared to the last accepted value
+			{value: 101_000, at: 3600},
+		}},
+		{"small decrease", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 99_999, at: 10, wantErr: ErrCounterDecrease, wantStreak: 1},
+			{value: 100_001, at: 20},
+		}},
+		{"large decrease", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 5, at: 10, wantErr: ErrCounterDecrease, wantStreak: 1},
+			// Decreasing among themselves starts a new streak
+			{value: 3, at: 20, wantErr: ErrCounterDecrease, wantStreak: 1},
+		}},
+		{"zero value", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 0, at: 10, wantErr: ErrZeroValue},
+		}},
+		{"restart streak reaches the threshold", restart},
+		{"zeros and jumps within a streak", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 1_000, at: 10, wantErr: ErrCounterDecrease, wantStreak: 1},
+			{value: 0, at: 20, wantErr: ErrZeroValue, wantStreak: 1},
+			{value: 1_010, at: 30, wantErr: ErrCounterDecrease, wantStreak: 2},
+			{value: 200_000, at: 40, wantErr: ErrImplausibleJump, wantStreak: 0},
+		}},
+		{"streak broken by a valid reading", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 1_000, at: 10, wantErr: ErrCounterDecrease, wantStreak: 1},
+			{value: 1_010, at: 20, wantErr: ErrCounterDecrease, wantStreak: 2},
+			{value: 100_005, at: 30},
+			{value: 1_020, at: 40, wantErr: ErrCounterDecrease, wantStreak: 1},
+		}},
+		{"set clears the streak", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 1_000, at: 10, wantErr: ErrCounterDecrease, wantStreak: 1},
+			{set: true, value: 1_000, at: 20},
+			{value: 1_005, at: 30},
+		}},
+		{"reset accepts any value", []step{
+			{set: true, value: 100_000, at: 0},
+			{value: 1_000, at: 10, wantErr: ErrCounterDecrease, wantStreak: 1},
+			{reset: true, value: 50, at: 20},
+			{value: 40, at: 30, wantErr: ErrCounterDecrease, wantStreak: 1},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter := NewCounter(testMaxIncreasePerHour)
+			for i, step := range test.steps {
+				if step.reset {
+					counter.Reset()
+					if counter.Known() || counter.Value() != 0 || counter.ConsistentRejections() != 0 {
+						t.Fatalf("step %d: counter not cleared by Reset", i)
+					}
+				}
+				if step.set {
+					counter.Set(step.value, step.at)
+					if !counter.Known() || counter.Value() != step.value || counter.ConsistentRejections() != 0 {
+						t.Fatalf("step %d: counter at %d after Set(%d)", i, counter.Value(), step.value)
+					}
+					continue
+				}
+
+				previous := counter.Value()
+				err := counter.Check(step.value, step.at)
+				if !errors.Is(err, step.wantErr) || (err == nil) != (step.wantErr == nil) {
+					t.Fatalf("step %d: Check(%d) returned %v, want %v", i, step.value, err, step.wantErr)
+				}
+				wantValue := step.value
+				if step.wantErr != nil {
+					wantValue = previous
+				}
+				if counter.Value() != wantValue {
+					t.Errorf("step %d: value %d after Check(%d), want %d", i, counter.Value(), step.value, wantValue)
+				}
+				if counter.ConsistentRejections() != step.wantStreak {
+					t.Errorf("step %d: %d consistent rejections, want %d", i, counter.ConsistentRejections(), step.wantStreak)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package dayahead
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamps without an offset are interpreted in the meter's timezone.
+var csvTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+}
+
+// Parse a CSV price file with the interval start in the first column
+// and the price in the second, eg. a Belpex export:
+//
+//	"Date";"Euro"
+//	"14/10/2025 00:00:00";"€ 82,56"
+//
+// Prices are in EUR/MWh unless the header mentions kWh.
+// The interval duration is derived from the spacing of the timestamps.
+func ParseCSV(data []byte, loc *time.Location) ([]*Price, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if bytes.Contains(firstLine, []byte(";")) {
+		reader.Comma = ';'
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price CSV: %w", err)
+	}
+
+	unitDivider := 1000.0 // MWh
+	byStart := map[time.Time]*Price{}
+	for i, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		start, err := parseCSVTime(record[0], loc)
+		if err != nil {
+			if i == 0 {
+				// Header
+				if strings.Contains(strings.ToLower(strings.Join(record, " ")), "kwh") {
+					unitDivider = 1
+				}
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		price, err := parseCSVPrice(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		byStart[start] = &Price{Start: start, PriceKWH: price / unitDivider}
+	}
+
+	if len(byStart) == 0 {
+		return nil, ErrNoPrices
+	}
+
+	prices := sortedPrices(byStart)
+	duration := time.Hour
+	for i := 1; i < len(prices); i++ {
+		if diff := prices[i].Start.Sub(prices[i-1].Start); diff > 0 && (i == 1 || diff < duration) {
+			duration = diff
+		}
+	}
+	for _, price := range prices {
+		price.Duration = duration
+	}
+	return prices, nil
+}
+
+func parseCSVTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return LocalAsUTC(t, loc), nil
+	}
+	for _, layout := range csvTimeLayouts[1:] {
+		// Already meter local wall time
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// Accepts currency symbols and both decimal separators, eg. "€ 1.082,56"
+func parseCSVPrice(value string) (float64, error) {
+	cleaned := strings.NewReplacer("€", "", "EUR", "", " ", "", " ", "").Replace(value)
+	if strings.Contains(cleaned, ",") {
+		cleaned = strings.ReplaceAll(cleaned, ".", "")
+		cleaned = strings.ReplaceAll(cleaned, ",", ".")
+	}
+	price, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", value)
+	}
+	return price, nil
+}
@@ -0,0 +1,126 @@
+package dayahead
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNoPrices = errors.New("no prices found")
+
+// Subset of the ENTSO-E Publication_MarketDocument (document type A44).
+type entsoeDocument struct {
+	TimeSeries []struct {
+		PriceUnit string `xml:"price_Measure_Unit.name"`
+		Periods   []struct {
+			TimeInterval struct {
+				Start string `xml:"start"`
+				End   string `xml:"end"`
+			} `xml:"timeInterval"`
+			Resolution string `xml:"resolution"`
+			Points     []struct {
+				Position int     `xml:"position"`
+				Price    float64 `xml:"price.amount"`
+			} `xml:"Point"`
+		} `xml:"Period"`
+	} `xml:"TimeSeries"`
+}
+
+// Parse an ENTSO-E transparency platform day-ahead price document.
+// Positions omitted by the curve type A03 repeat the previous price.
+func ParseEntsoeXML(data []byte, loc *time.Location) ([]*Price, error) {
+	var document entsoeDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse ENTSO-E document: %w", err)
+	}
+
+	byStart := map[time.Time]*Price{}
+	for _, series := range document.TimeSeries {
+		unitDivider := 1000.0 // MWh
+		if strings.EqualFold(series.PriceUnit, "KWH") {
+			unitDivider = 1
+		}
+
+		for _, period := range series.Periods {
+			start, err := parseEntsoeTime(period.TimeInterval.Start)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseEntsoeTime(period.TimeInterval.End)
+			if err != nil {
+				return nil, err
+			}
+			resolution, err := parseResolution(period.Resolution)
+			if err != nil {
+				return nil, err
+			}
+
+			pricesByPosition := map[int]float64{}
+			for _, point := range period.Points {
+				pricesByPosition[point.Position] = point.Price / unitDivider
+			}
+
+			var lastPrice float64
+			position := 1
+			for intervalStart := start; intervalStart.Before(end); intervalStart = intervalStart.Add(resolution) {
+				price, ok := pricesByPosition[position]
+				if ok {
+					lastPrice = price
+				} else if position == 1 {
+					return nil, fmt.Errorf("ENTSO-E period starting %s has no first position", start)
+				}
+				localStart := LocalAsUTC(intervalStart, loc)
+				byStart[localStart] = &Price{
+					Start:    localStart,
+					Duration: resolution,
+					PriceKWH: lastPrice,
+				}
+				position++
+			}
+		}
+	}
+
+	if len(byStart) == 0 {
+		return nil, ErrNoPrices
+	}
+	return sortedPrices(byStart), nil
+}
+
+// ENTSO-E uses UTC times without seconds, eg. 2024-01-01T23:00Z
+func parseEntsoeTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04Z", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid ENTSO-E time %q", value)
+}
+
+// ISO 8601 durations as used by ENTSO-E, eg. PT60M, PT15M or P1D
+func parseResolution(value string) (time.Duration, error) {
+	switch value {
+	case "PT15M":
+		return 15 * time.Minute, nil
+	case "PT30M":
+		return 30 * time.Minute, nil
+	case "PT60M", "PT1H":
+		return time.Hour, nil
+	case "P1D":
+		return 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("unsupported resolution %q", value)
+}
+
+func sortedPrices(byStart map[time.Time]*Price) []*Price {
+	prices := make([]*Price, 0, len(byStart))
+	for _, price := range byStart {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Start.Before(prices[j].Start)
+	})
+	return prices
+}
@@ -0,0 +1,76 @@
+package dayahead
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fetches price files over HTTP, eg. from the ENTSO-E transparency API
+// or any local service serving the same XML or CSV format.
+// {start} and {end} in the URL are replaced with the requested period
+// in UTC as yyyyMMddHHmm, the format the ENTSO-E API expects:
+//
+//	https://web-api.tp.entsoe.eu/api?securityToken=TOKEN&documentType=A44&in_Domain=10YBE----------2&out_Domain=10YBE----------2&periodStart={start}&periodEnd={end}
+type HTTPProvider struct {
+	URLTemplate string
+	Format      string
+	Location    *time.Location
+	Client      *http.Client
+}
+
+func NewHTTPProvider(urlTemplate string, format string, loc *time.Location) *HTTPProvider {
+	return &HTTPProvider{
+		URLTemplate: urlTemplate,
+		Format:      format,
+		Location:    loc,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// from and to are meter local times, like all prices.
+func (p *HTTPProvider) GetPrices(from time.Time, to time.Time) ([]*Price, error) {
+	u := strings.NewReplacer(
+		"{start}", localToUTC(from, p.Location).Format("200601021504"),
+		"{end}", localToUTC(to, p.Location).Format("200601021504"),
+	).Replace(p.URLTemplate)
+
+	resp, err := p.Client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from price provider: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := Parse(data, p.Format, p.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers may return whole days, only keep what was asked for
+	filtered := make([]*Price, 0, len(prices))
+	for _, price := range prices {
+		if price.Start.Add(price.Duration).After(from) && price.Start.Before(to) {
+			filtered = append(filtered, price)
+		}
+	}
+	return filtered, nil
+}
+
+// Inverse of LocalAsUTC.
+func localToUTC(t time.Time, loc *time.Location) time.Time {
+	return time.Date(
+		t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), 0,
+		loc,
+	).UTC()
+}
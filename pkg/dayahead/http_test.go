@@ -0,0 +1,64 @@
+package dayahead
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPProviderGetPrices(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.RawQuery
+		// Whole days around the requested period, in EUR/MWh
+		var body strings.Builder
+		body.WriteString("\"Date\";\"Euro\"\n")
+		for hour := range 72 {
+			start := time.Date(2025, 10, 13, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+			fmt.Fprintf(&body, "\"%s\";\"€ %d,50\"\n", start.Format("02/01/2006 15:04:05"), 50+hour)
+		}
+		w.Write([]byte(body.String()))
+	}))
+	defer server.Close()
+
+	loc, err := time.LoadLocation("Europe/Brussels")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+	provider := NewHTTPProvider(server.URL+"/?periodStart={start}&periodEnd={end}", FormatCSV, loc)
+	from := time.Date(2025, 10, 14, 0, 0, 0, 0, time.UTC)
+	prices, err := provider.GetPrices(from, from.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetPrices: %v", err)
+	}
+
+	// Meter local midnight is 22:00 UTC the day before in summer time
+	if want := "periodStart=202510132200&periodEnd=202510142200"; requested != want {
+		t.Errorf("query = %q, want %q", requested, want)
+	}
+	if len(prices) != 24 {
+		t.Fatalf("got %d prices, want 24", len(prices))
+	}
+	if !prices[0].Start.Equal(from) || prices[0].Duration != time.Hour {
+		t.Errorf("first price starts at %s for %s, want %s for 1h", prices[0].Start, prices[0].Duration, from)
+	}
+	if prices[0].PriceKWH != 0.0745 {
+		t.Errorf("first price = %v EUR/kWh, want 0.0745", prices[0].PriceKWH)
+	}
+}
+
+func TestHTTPProviderStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	provider := NewHTTPProvider(server.URL, FormatCSV, time.UTC)
+	from := time.Date(2025, 10, 14, 0, 0, 0, 0, time.UTC)
+	if _, err := provider.GetPrices(from, from.AddDate(0, 0, 1)); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("err = %v, want unexpected status 401", err)
+	}
+}
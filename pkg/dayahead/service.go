@@ -0,0 +1,98 @@
+// Day-ahead electricity prices for dynamic contracts.
+// Prices are imported from ENTSO-E transparency XML or CSV price files
+// and stored in meter local time so they line up with meter readings.
+package dayahead
+
+import (
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+const (
+	FormatEntsoeXML = "entsoe_xml"
+	FormatCSV       = "csv"
+)
+
+// Market price of a single interval, excluding VAT and contract markup.
+// Start is the meter local wall time expressed as UTC.
+type Price struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"-"`
+	PriceKWH float64       `json:"price_kwh"`
+}
+
+// Source of day-ahead prices.
+type Provider interface {
+	// Prices of intervals overlapping from and to.
+	GetPrices(from time.Time, to time.Time) ([]*Price, error)
+}
+
+// Serves prices stored in the meter database.
+type DatabaseProvider struct{}
+
+func (DatabaseProvider) GetPrices(from time.Time, to time.Time) ([]*Price, error) {
+	stored, err := meterdb.GetPrices(from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make([]*Price, 0, len(stored))
+	for _, price := range stored {
+		prices = append(prices, &Price{
+			Start:    time.Unix(price.Timestamp, 0).UTC(),
+			Duration: time.Duration(price.DurationSeconds) * time.Second,
+			PriceKWH: price.PriceKWH,
+		})
+	}
+	return prices, nil
+}
+
+// Store prices from any provider in the meter database.
+func StorePrices(prices []*Price, source string) error {
+	stored := make([]*meterdb.MeterDbPrice, 0, len(prices))
+	for _, price := range prices {
+		stored = append(stored, &meterdb.MeterDbPrice{
+			Timestamp:       price.Start.Unix(),
+			DurationSeconds: int64(price.Duration.Seconds()),
+			PriceKWH:        price.PriceKWH,
+			Source:          source,
+		})
+	}
+	return meterdb.InsertPrices(stored)
+}
+
+// Parse a price file in the given format.
+// loc is the meter's timezone, used to convert UTC market times to meter local time
+// and to interpret CSV timestamps without an offset.
+func Parse(data []byte, format string, loc *time.Location) ([]*Price, error) {
+	switch format {
+	case FormatEntsoeXML:
+		return ParseEntsoeXML(data, loc)
+	default:
+		return ParseCSV(data, loc)
+	}
+}
+
+// Express t as the wall time in loc, labelled as UTC.
+// Meter timestamps carry no offset, so this is how they are stored.
+func LocalAsUTC(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(
+		local.Year(), local.Month(), local.Day(),
+		local.Hour(), local.Minute(), local.Second(), 0,
+		time.UTC,
+	)
+}
+
+// Load the timezone by name, falling back to the system timezone.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
@@ -0,0 +1,140 @@
+// Local APIs of a HomeWizard P1 meter and a Shelly Pro 3EM serving the P1 values,
+// for apps and batteries that integrate natively with those devices.
+// Like the real devices the APIs are read-only and without authentication.
+package deviceemulation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/mdns"
+)
+
+// Without a reading for this long requests fail, so devices switch to
+// their fail-safe instead of regulating on outdated values
+const staleAfter = 10 * time.Second
+
+type Emulator struct {
+	mux *http.ServeMux
+	// Lowercase hex MAC address without separators, the real devices derive their ids from it
+	mac string
+
+	mutex     sync.RWMutex
+	reading   *interpreter.RawMeterReading
+	updatedAt time.Time
+}
+
+func New() *Emulator {
+	e := &Emulator{mux: http.NewServeMux(), mac: macAddress()}
+	e.mux.HandleFunc("GET /api", e.serveHomeWizardInfo)
+	e.mux.HandleFunc("GET /api/v1/data", e.serveHomeWizardData)
+	e.mux.HandleFunc("GET /shelly", e.serveShellyInfo)
+	e.mux.HandleFunc("GET /rpc/{method}", e.serveShellyGet)
+	e.mux.HandleFunc("POST /rpc", e.serveShellyPost)
+	return e
+}
+
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+// Set the reading served by both APIs.
+func (e *Emulator) Update(reading *interpreter.RawMeterReading) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.reading = reading
+	e.updatedAt = time.Now()
+}
+
+// Latest reading, nil when there is none or it is stale.
+func (e *Emulator) latest() *interpreter.RawMeterReading {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.reading == nil || time.Since(e.updatedAt) > staleAfter {
+		return nil
+	}
+	return e.reading
+}
+
+// mDNS services of both devices for an API served on port.
+func (e *Emulator) Services(port int) []*mdns.Service {
+	homeWizardName := "p1meter-" + e.mac[len(e.mac)-6:]
+	shellyID := shellyIDPrefix + e.mac
+	shellyTXT := []string{"gen=2", "app=" + shellyApp, "ver=" + shellyVersion}
+	return []*mdns.Service{
+		{
+			Instance: homeWizardName,
+			Type:     "_hwenergy._tcp",
+			Host:     homeWizardName,
+			Port:     port,
+			TXT: []string{
+				"api_enabled=1",
+				"path=/api/v1",
+				"serial=" + e.mac,
+				"product_name=" + homeWizardProductName,
+				"product_type=" + homeWizardProductType,
+			},
+		},
+		{Instance: shellyID, Type: "_shelly._tcp", Host: shellyID, Port: port, TXT: shellyTXT},
+		{Instance: shellyID, Type: "_http._tcp", Host: shellyID, Port: port, TXT: shellyTXT},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// Power per phase in W, positive when importing, and currents following from power and voltage
+// as the P1 port only reports whole amps.
+func phaseValues(reading *interpreter.RawMeterReading) (powerW [3]float64, voltageV [3]float64, currentA [3]float64) {
+	powerW = [3]float64{
+		math.Round((reading.L1ConsumptionKW - reading.L1ProductionKW) * 1000),
+		math.Round((reading.L2ConsumptionKW - reading.L2ProductionKW) * 1000),
+		math.Round((reading.L3ConsumptionKW - reading.L3ProductionKW) * 1000),
+	}
+	voltageV = [3]float64{reading.L1VoltageV, reading.L2VoltageV, reading.L3VoltageV}
+	currentA = [3]float64{reading.L1CurrentA, reading.L2CurrentA, reading.L3CurrentA}
+	for phase := range 3 {
+		if voltageV[phase] > 0 {
+			currentA[phase] = roundTo(math.Abs(powerW[phase])/voltageV[phase], 3)
+		}
+	}
+	return powerW, voltageV, currentA
+}
+
+// Net power in W, positive when importing.
+func totalPowerW(reading *interpreter.RawMeterReading) float64 {
+	return math.Round((reading.CurrentConsumptionKW - reading.CurrentProductionKW) * 1000)
+}
+
+// Rounded to decimals, so sums of meter values carry no float noise.
+func roundTo(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// MAC address of the first network interface, or one derived from the host name
+// with the locally administered bit set when there is none.
+func macAddress() string {
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			if iface.Flags&net.FlagLoopback == 0 && len(iface.HardwareAddr) == 6 {
+				return hex.EncodeToString(iface.HardwareAddr)
+			}
+		}
+	}
+	hostname, _ := os.Hostname()
+	sum := sha256.Sum256([]byte(hostname))
+	sum[0] = sum[0]&^0x01 | 0x02
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,102 @@
+package deviceemulation
+
+import (
+	"encoding/hex"
+	"net/http"
+)
+
+// Identity of the HomeWizard P1 meter, responses follow its local API v1
+const (
+	homeWizardProductType     = "HWE-P1"
+	homeWizardProductName     = "P1 meter"
+	homeWizardFirmwareVersion = "4.19"
+	homeWizardAPIVersion      = "v1"
+)
+
+type homeWizardInfo struct {
+	ProductType     string `json:"product_type"`
+	ProductName     string `json:"product_name"`
+	Serial          string `json:"serial"`
+	FirmwareVersion string `json:"firmware_version"`
+	APIVersion      string `json:"api_version"`
+}
+
+// Values the P1 port does not report, such as the wifi signal and the DSMR version, are left out.
+type homeWizardData struct {
+	UniqueID              string   `json:"unique_id"`
+	ActiveTariff          int      `json:"active_tariff"`
+	TotalPowerImportKWH   float64  `json:"total_power_import_kwh"`
+	TotalPowerImportT1KWH float64  `json:"total_power_import_t1_kwh"`
+	TotalPowerImportT2KWH float64  `json:"total_power_import_t2_kwh"`
+	TotalPowerExportKWH   float64  `json:"total_power_export_kwh"`
+	TotalPowerExportT1KWH float64  `json:"total_power_export_t1_kwh"`
+	TotalPowerExportT2KWH float64  `json:"total_power_export_t2_kwh"`
+	ActivePowerW          float64  `json:"active_power_w"`
+	ActivePowerL1W        float64  `json:"active_power_l1_w"`
+	ActivePowerL2W        float64  `json:"active_power_l2_w"`
+	ActivePowerL3W        float64  `json:"active_power_l3_w"`
+	ActiveVoltageL1V      float64  `json:"active_voltage_l1_v"`
+	ActiveVoltageL2V      float64  `json:"active_voltage_l2_v"`
+	ActiveVoltageL3V      float64  `json:"active_voltage_l3_v"`
+	ActiveCurrentL1A      float64  `json:"active_current_l1_a"`
+	ActiveCurrentL2A      float64  `json:"active_current_l2_a"`
+	ActiveCurrentL3A      float64  `json:"active_current_l3_a"`
+	TotalGasM3            *float64 `json:"total_gas_m3,omitempty"`
+	GasUniqueID           string   `json:"gas_unique_id,omitempty"`
+}
+
+type homeWizardError struct {
+	Error struct {
+		ID          int    `json:"id"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func (e *Emulator) serveHomeWizardInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, homeWizardInfo{
+		ProductType:     homeWizardProductType,
+		ProductName:     homeWizardProductName,
+		Serial:          e.mac,
+		FirmwareVersion: homeWizardFirmwareVersion,
+		APIVersion:      homeWizardAPIVersion,
+	})
+}
+
+// Tariff 1 is the day tariff of RawMeterReading, both follow the OBIS codes of the meter.
+func (e *Emulator) serveHomeWizardData(w http.ResponseWriter, r *http.Request) {
+	reading := e.latest()
+	if reading == nil {
+		var response homeWizardError
+		response.Error.ID = http.StatusServiceUnavailable
+		response.Error.Description = "No recent reading from the meter"
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+
+	powerW, voltageV, currentA := phaseValues(reading)
+	data := homeWizardData{
+		UniqueID:              hex.EncodeToString([]byte(reading.MeterSerialElectricity)),
+		ActiveTariff:          reading.CurrentTariff,
+		TotalPowerImportKWH:   roundTo(reading.TotalConsumptionDayKWH+reading.TotalConsumptionNightKWH, 3),
+		TotalPowerImportT1KWH: reading.TotalConsumptionDayKWH,
+		TotalPowerImportT2KWH: reading.TotalConsumptionNightKWH,
+		TotalPowerExportKWH:   roundTo(reading.TotalProductionDayKWH+reading.TotalProductionNightKWH, 3),
+		TotalPowerExportT1KWH: reading.TotalProductionDayKWH,
+		TotalPowerExportT2KWH: reading.TotalProductionNightKWH,
+		ActivePowerW:          totalPowerW(reading),
+		ActivePowerL1W:        powerW[0],
+		ActivePowerL2W:        powerW[1],
+		ActivePowerL3W:        powerW[2],
+		ActiveVoltageL1V:      voltageV[0],
+		ActiveVoltageL2V:      voltageV[1],
+		ActiveVoltageL3V:      voltageV[2],
+		ActiveCurrentL1A:      currentA[0],
+		ActiveCurrentL2A:      currentA[1],
+		ActiveCurrentL3A:      currentA[2],
+	}
+	if reading.MeterSerialGas != "" {
+		data.TotalGasM3 = &reading.GasConsumptionM3
+		data.GasUniqueID = hex.EncodeToString([]byte(reading.MeterSerialGas))
+	}
+	writeJSON(w, http.StatusOK, data)
+}
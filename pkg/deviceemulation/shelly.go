@@ -0,0 +1,235 @@
+package deviceemulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Identity of the Shelly Pro 3EM, responses follow its Gen2 RPC API in the triphase profile
+const (
+	shellyIDPrefix = "shellypro3em-"
+	shellyModel    = "SPEM-003CEBEU"
+	shellyApp      = "Pro3EM"
+	shellyVersion  = "1.4.4"
+	shellyFirmware = "20241011-114455/1.4.4-g6d2a586"
+)
+
+// Error codes of Shelly RPC
+const (
+	shellyErrorInvalidArgument = -103
+	shellyErrorNotFound        = -105
+	shellyErrorUnavailable     = -114
+	shellyErrorNoHandler       = 404
+)
+
+type shellyInfo struct {
+	Name       *string `json:"name"`
+	ID         string  `json:"id"`
+	MAC        string  `json:"mac"`
+	Slot       int     `json:"slot"`
+	Model      string  `json:"model"`
+	Gen        int     `json:"gen"`
+	FirmwareID string  `json:"fw_id"`
+	Version    string  `json:"ver"`
+	App        string  `json:"app"`
+	AuthEnable bool    `json:"auth_en"`
+	AuthDomain *string `json:"auth_domain"`
+	Profile    string  `json:"profile"`
+}
+
+// Status of the EM component, power is positive when importing.
+// The P1 port reports no power factor, so it is always 1 and apparent power equals active power.
+type shellyEMStatus struct {
+	ID                  int      `json:"id"`
+	ACurrent            float64  `json:"a_current"`
+	AVoltage            float64  `json:"a_voltage"`
+	AActivePower        float64  `json:"a_act_power"`
+	AApparentPower      float64  `json:"a_aprt_power"`
+	APowerFactor        float64  `json:"a_pf"`
+	AFrequency          float64  `json:"a_freq"`
+	BCurrent            float64  `json:"b_current"`
+	BVoltage            float64  `json:"b_voltage"`
+	BActivePower        float64  `json:"b_act_power"`
+	BApparentPower      float64  `json:"b_aprt_power"`
+	BPowerFactor        float64  `json:"b_pf"`
+	BFrequency          float64  `json:"b_freq"`
+	CCurrent            float64  `json:"c_current"`
+	CVoltage            float64  `json:"c_voltage"`
+	CActivePower        float64  `json:"c_act_power"`
+	CApparentPower      float64  `json:"c_aprt_power"`
+	CPowerFactor        float64  `json:"c_pf"`
+	CFrequency          float64  `json:"c_freq"`
+	NCurrent            *float64 `json:"n_current"`
+	TotalCurrent        float64  `json:"total_current"`
+	TotalActivePower    float64  `json:"total_act_power"`
+	TotalApparentPower  float64  `json:"total_aprt_power"`
+	UserCalibratedPhase []string `json:"user_calibrated_phase"`
+}
+
+// Energy counters of the EMData component in Wh. The P1 port only reports totals, so the phases are 0.
+type shellyEMDataStatus struct {
+	ID                    int     `json:"id"`
+	ATotalActiveEnergy    float64 `json:"a_total_act_energy"`
+	ATotalActiveRetEnergy float64 `json:"a_total_act_ret_energy"`
+	BTotalActiveEnergy    float64 `json:"b_total_act_energy"`
+	BTotalActiveRetEnergy float64 `json:"b_total_act_ret_energy"`
+	CTotalActiveEnergy    float64 `json:"c_total_act_energy"`
+	CTotalActiveRetEnergy float64 `json:"c_total_act_ret_energy"`
+	TotalActive           float64 `json:"total_act"`
+	TotalActiveRet        float64 `json:"total_act_ret"`
+}
+
+type shellyRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Source string          `json:"src"`
+	Method string          `json:"method"`
+	Params struct {
+		ID *int `json:"id"`
+	} `json:"params"`
+}
+
+type shellyResponse struct {
+	ID          json.RawMessage `json:"id"`
+	Source      string          `json:"src"`
+	Destination string          `json:"dst,omitempty"`
+	Result      any             `json:"result,omitempty"`
+	Error       *shellyError    `json:"error,omitempty"`
+}
+
+type shellyError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// HTTP status of the error when called with GET.
+func (e *shellyError) status() int {
+	switch e.Code {
+	case shellyErrorNoHandler:
+		return http.StatusNotFound
+	case shellyErrorInvalidArgument:
+		return http.StatusBadRequest
+	case shellyErrorUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+var shellyMethods = []string{"Shelly.GetDeviceInfo", "Shelly.GetStatus", "Shelly.ListMethods", "EM.GetStatus", "EMData.GetStatus"}
+
+func (e *Emulator) serveShellyInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, e.shellyInfo())
+}
+
+// RPC over GET, eg. /rpc/EM.GetStatus?id=0, the response is the result itself.
+func (e *Emulator) serveShellyGet(w http.ResponseWriter, r *http.Request) {
+	var id *int
+	if value := r.URL.Query().Get("id"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			rpcErr := &shellyError{Code: shellyErrorInvalidArgument, Message: "Argument 'id', value type is invalid!"}
+			writeJSON(w, rpcErr.status(), rpcErr)
+			return
+		}
+		id = &parsed
+	}
+	result, rpcErr := e.callShelly(r.PathValue("method"), id)
+	if rpcErr != nil {
+		writeJSON(w, rpcErr.status(), rpcErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// JSON-RPC frame posted to /rpc, errors are returned in the frame with status 200.
+func (e *Emulator) serveShellyPost(w http.ResponseWriter, r *http.Request) {
+	var request shellyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&request); err != nil {
+		rpcErr := &shellyError{Code: shellyErrorInvalidArgument, Message: "Invalid request frame"}
+		writeJSON(w, rpcErr.status(), rpcErr)
+		return
+	}
+	response := shellyResponse{ID: request.ID, Source: shellyIDPrefix + e.mac, Destination: request.Source}
+	response.Result, response.Error = e.callShelly(request.Method, request.Params.ID)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Method names are case insensitive like on the device.
+func (e *Emulator) callShelly(name string, id *int) (any, *shellyError) {
+	method := strings.ToLower(name)
+	if method == "shelly.getdeviceinfo" {
+		return e.shellyInfo(), nil
+	}
+	if method == "shelly.listmethods" {
+		return map[string][]string{"methods": shellyMethods}, nil
+	}
+	if method != "shelly.getstatus" && method != "em.getstatus" && method != "emdata.getstatus" {
+		return nil, &shellyError{Code: shellyErrorNoHandler, Message: fmt.Sprintf("No handler for %s", name)}
+	}
+	if method != "shelly.getstatus" {
+		if id == nil {
+			return nil, &shellyError{Code: shellyErrorInvalidArgument, Message: "Argument 'id', value type is invalid!"}
+		}
+		if *id != 0 {
+			return nil, &shellyError{Code: shellyErrorNotFound, Message: fmt.Sprintf("Argument 'id', value %d not found!", *id)}
+		}
+	}
+
+	reading := e.latest()
+	if reading == nil {
+		return nil, &shellyError{Code: shellyErrorUnavailable, Message: "No recent reading from the meter"}
+	}
+	powerW, voltageV, currentA := phaseValues(reading)
+	em := &shellyEMStatus{
+		ACurrent:            currentA[0],
+		AVoltage:            voltageV[0],
+		AActivePower:        powerW[0],
+		AApparentPower:      math.Abs(powerW[0]),
+		APowerFactor:        1,
+		AFrequency:          50,
+		BCurrent:            currentA[1],
+		BVoltage:            voltageV[1],
+		BActivePower:        powerW[1],
+		BApparentPower:      math.Abs(powerW[1]),
+		BPowerFactor:        1,
+		BFrequency:          50,
+		CCurrent:            currentA[2],
+		CVoltage:            voltageV[2],
+		CActivePower:        powerW[2],
+		CApparentPower:      math.Abs(powerW[2]),
+		CPowerFactor:        1,
+		CFrequency:          50,
+		TotalCurrent:        roundTo(currentA[0]+currentA[1]+currentA[2], 3),
+		TotalActivePower:    totalPowerW(reading),
+		TotalApparentPower:  math.Abs(powerW[0]) + math.Abs(powerW[1]) + math.Abs(powerW[2]),
+		UserCalibratedPhase: []string{},
+	}
+	emData := &shellyEMDataStatus{
+		TotalActive:    math.Round((reading.TotalConsumptionDayKWH + reading.TotalConsumptionNightKWH) * 1000),
+		TotalActiveRet: math.Round((reading.TotalProductionDayKWH + reading.TotalProductionNightKWH) * 1000),
+	}
+
+	switch method {
+	case "em.getstatus":
+		return em, nil
+	case "emdata.getstatus":
+		return emData, nil
+	}
+	return map[string]any{"em:0": em, "emdata:0": emData}, nil
+}
+
+func (e *Emulator) shellyInfo() *shellyInfo {
+	return &shellyInfo{
+		ID:         shellyIDPrefix + e.mac,
+		MAC:        strings.ToUpper(e.mac),
+		Model:      shellyModel,
+		Gen:        2,
+		FirmwareID: shellyFirmware,
+		Version:    shellyVersion,
+		App:        shellyApp,
+		Profile:    "triphase",
+	}
+}
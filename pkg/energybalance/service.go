@@ -0,0 +1,138 @@
+// Combines grid import and export from the meter with solar production
+// into house consumption, self-consumption and self-sufficiency.
+//
+//	consumption      = import + solar - export
+//	self consumed    = solar - export
+//	self-consumption = self consumed / solar
+//	self-sufficiency = self consumed / consumption
+package energybalance
+
+import (
+	"math"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+// Current power flows of the house.
+type LiveBalance struct {
+	Timestamp            string  `json:"timestamp"`
+	ImportKW             float64 `json:"import_kw"`
+	ExportKW             float64 `json:"export_kw"`
+	SolarKW              float64 `json:"solar_kw"`
+	ConsumptionKW        float64 `json:"consumption_kw"`
+	SelfConsumedKW       float64 `json:"self_consumed_kw"`
+	SelfConsumptionRatio float64 `json:"self_consumption_ratio"`
+	SelfSufficiencyRatio float64 `json:"self_sufficiency_ratio"`
+}
+
+// Energy flows of the house over a period.
+type PeriodBalance struct {
+	MeterID              string  `json:"meter_id"`
+	From                 string  `json:"from"`
+	To                   string  `json:"to"`
+	ImportKWH            float64 `json:"import_kwh"`
+	ExportKWH            float64 `json:"export_kwh"`
+	SolarKWH             float64 `json:"solar_kwh"`
+	ConsumptionKWH       float64 `json:"consumption_kwh"`
+	SelfConsumedKWH      float64 `json:"self_consumed_kwh"`
+	SelfConsumptionRatio float64 `json:"self_consumption_ratio"`
+	SelfSufficiencyRatio float64 `json:"self_sufficiency_ratio"`
+	// Part of the period with stored balance rows, and with known solar production
+	Coverage      float64 `json:"coverage"`
+	SolarCoverage float64 `json:"solar_coverage"`
+}
+
+// Balance of a meter reading and the current solar production in watts.
+func CalculateLive(reading *interpreter.RawMeterReading, solarWatt int32) *LiveBalance {
+	balance := &LiveBalance{
+		Timestamp: reading.Timestamp,
+		ImportKW:  reading.CurrentConsumptionKW,
+		ExportKW:  reading.CurrentProductionKW,
+		SolarKW:   float64(solarWatt) / 1000,
+	}
+	flows := calculate(balance.ImportKW, balance.ExportKW, balance.SolarKW)
+	balance.ConsumptionKW = round(flows.consumption)
+	balance.SelfConsumedKW = round(flows.selfConsumed)
+	balance.SelfConsumptionRatio = round(flows.selfConsumptionRatio)
+	balance.SelfSufficiencyRatio = round(flows.selfSufficiencyRatio)
+	return balance
+}
+
+// Balance of a single day, day is truncated to midnight.
+func DailyBalance(meterID string, day time.Time) (*PeriodBalance, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return CalculatePeriod(meterID, from, from.AddDate(0, 0, 1))
+}
+
+// Balance of the month day falls in.
+func MonthlyBalance(meterID string, month time.Time) (*PeriodBalance, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return CalculatePeriod(meterID, from, from.AddDate(0, 1, 0))
+}
+
+// Balance for the period from (inclusive) to (exclusive) from the stored balance rows.
+func CalculatePeriod(meterID string, from time.Time, to time.Time) (*PeriodBalance, error) {
+	totals, err := meterdb.GetEnergyBalanceTotals(meterID, from.Unix(), to.Unix()-1)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &PeriodBalance{
+		MeterID:   meterID,
+		From:      from.Format(time.RFC3339),
+		To:        to.Format(time.RFC3339),
+		ImportKWH: round(totals.ImportWh / 1000),
+		ExportKWH: round(totals.ExportWh / 1000),
+		SolarKWH:  round(totals.SolarWh / 1000),
+	}
+	flows := calculate(totals.ImportWh/1000, totals.ExportWh/1000, totals.SolarWh/1000)
+	balance.ConsumptionKWH = round(flows.consumption)
+	balance.SelfConsumedKWH = round(flows.selfConsumed)
+	balance.SelfConsumptionRatio = round(flows.selfConsumptionRatio)
+	balance.SelfSufficiencyRatio = round(flows.selfSufficiencyRatio)
+
+	// Rows are per meter, so all meters can cover the period more than once
+	if seconds := to.Sub(from).Seconds(); seconds > 0 {
+		meters := 1
+		if meterID == meterdb.AllMeters {
+			meterIDs, err := meterdb.GetMeterIDs()
+			if err != nil {
+				return nil, err
+			}
+			meters = max(len(meterIDs), 1)
+		}
+		balance.Coverage = round(float64(totals.CoveredSeconds) / seconds / float64(meters))
+		balance.SolarCoverage = round(float64(totals.SolarCoveredSeconds) / seconds / float64(meters))
+	}
+	return balance, nil
+}
+
+type flows struct {
+	consumption          float64
+	selfConsumed         float64
+	selfConsumptionRatio float64
+	selfSufficiencyRatio float64
+}
+
+// Works the same for power and energy.
+// Solar readings can lag behind the meter, so export may briefly exceed production.
+func calculate(imported float64, exported float64, solar float64) flows {
+	selfConsumed := math.Max(solar-exported, 0)
+	f := flows{
+		consumption:  imported + selfConsumed,
+		selfConsumed: selfConsumed,
+	}
+	if solar > 0 {
+		f.selfConsumptionRatio = selfConsumed / solar
+	}
+	if f.consumption > 0 {
+		f.selfSufficiencyRatio = selfConsumed / f.consumption
+	}
+	return f
+}
+
+func round(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
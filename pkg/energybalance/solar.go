@@ -0,0 +1,67 @@
+package energybalance
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+// Solar production over a period, split into hours for a day or days for a month.
+type SolarHistory struct {
+	MeterID       string           `json:"meter_id"`
+	From          string           `json:"from"`
+	To            string           `json:"to"`
+	ProductionKWH float64          `json:"production_kwh"`
+	PeakW         int32            `json:"peak_w"`
+	Intervals     []*SolarInterval `json:"intervals"`
+}
+
+type SolarInterval struct {
+	Start         string  `json:"start"`
+	ProductionKWH float64 `json:"production_kwh"`
+}
+
+// Solar production of a single day per hour, day is truncated to midnight.
+func DailySolarHistory(meterID string, day time.Time) (*SolarHistory, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return solarHistory(meterID, from, from.AddDate(0, 0, 1), time.Hour)
+}
+
+// Solar production of the month day falls in, per day.
+func MonthlySolarHistory(meterID string, month time.Time) (*SolarHistory, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return solarHistory(meterID, from, from.AddDate(0, 1, 0), 24*time.Hour)
+}
+
+func solarHistory(meterID string, from time.Time, to time.Time, bucket time.Duration) (*SolarHistory, error) {
+	production, err := meterdb.GetSolarProductionByBucket(meterID, from.Unix(), to.Unix()-1, int64(bucket.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	peak, err := meterdb.GetSolarPeakWatt(meterID, from.Unix(), to.Unix()-1)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &SolarHistory{
+		MeterID:   meterID,
+		From:      from.Format(time.RFC3339),
+		To:        to.Format(time.RFC3339),
+		PeakW:     peak,
+		Intervals: make([]*SolarInterval, 0, len(production)),
+	}
+	var totalWh float64
+	for start, wh := range production {
+		totalWh += wh
+		history.Intervals = append(history.Intervals, &SolarInterval{
+			Start:         time.Unix(start, 0).UTC().Format(time.RFC3339),
+			ProductionKWH: round(wh / 1000),
+		})
+	}
+	sort.Slice(history.Intervals, func(i, j int) bool {
+		return history.Intervals[i].Start < history.Intervals[j].Start
+	})
+	history.ProductionKWH = round(totalWh / 1000)
+	return history, nil
+}
@@ -0,0 +1,166 @@
+package energycost
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/dayahead"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+// Capacity tariffs bill the highest 15 minute average import of the month
+const (
+	quarterHour = 15 * time.Minute
+	// Readings further apart are not integrated, eg. after the meter was disconnected
+	maxReadingGap = time.Minute
+)
+
+// Live capacity tariff peak, as sent on /peak and to websocket subscribers.
+type PeakStatus struct {
+	QuarterStart time.Time `json:"quarter_start"`
+	// Average import since the start of the quarter hour
+	AverageW float64 `json:"average_w"`
+	// Average of the quarter hour if the current import continues
+	ProjectedW float64 `json:"projected_w"`
+	// Highest quarter hour of the month, at least the capacity minimum
+	MonthPeakW float64 `json:"month_peak_w"`
+	CurrentW   float64 `json:"current_w"`
+}
+
+// Tracks the import of the current quarter hour from the live readings.
+// The month peak comes from the Meter Collector database when available and the meter
+// reports its serial, raised by the quarter hours completed since startup.
+type PeakTracker struct {
+	mutex sync.Mutex
+
+	quarterStart time.Time
+	// Start of the readings in this quarter, later than quarterStart after startup or a gap
+	seenFrom      time.Time
+	energyWh      float64
+	lastReadingAt time.Time
+	currentW      float64
+
+	month      time.Month
+	liveMonthW float64
+	dbMonthW   float64
+	meterID    string
+}
+
+func NewPeakTracker() *PeakTracker {
+	return &PeakTracker{}
+}
+
+// Integrate a reading and return the updated status.
+func (p *PeakTracker) Update(reading *interpreter.RawMeterReading, now time.Time) PeakStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	quarterStart := now.Truncate(quarterHour)
+	if !quarterStart.Equal(p.quarterStart) {
+		// Quarters that were only partly seen are not counted towards the peak
+		if p.seenFrom.Equal(p.quarterStart) && p.quarterStart.Add(quarterHour).Equal(quarterStart) {
+			p.liveMonthW = math.Max(p.liveMonthW, p.energyWh*float64(time.Hour/quarterHour))
+		}
+		meterNow := dayahead.LocalAsUTC(now, dayahead.LoadLocation(config.ActiveTariffConfig.Timezone))
+		if meterNow.Month() != p.month {
+			p.month, p.liveMonthW, p.dbMonthW = meterNow.Month(), 0, 0
+		}
+		p.quarterStart, p.energyWh = quarterStart, 0
+		p.seenFrom = now
+		if !p.lastReadingAt.IsZero() && now.Sub(p.lastReadingAt) <= maxReadingGap {
+			p.seenFrom = quarterStart
+		}
+		p.meterID = reading.MeterSerialElectricity
+		go p.refreshMonthPeak(meterNow)
+	}
+
+	// Power since the previous reading, which may have been in the previous quarter
+	if gap := now.Sub(p.lastReadingAt); !p.lastReadingAt.IsZero() && gap <= maxReadingGap {
+		integrated := min(gap, now.Sub(p.quarterStart))
+		p.energyWh += p.currentW * integrated.Hours()
+	}
+	p.currentW = reading.CurrentConsumptionKW * 1000
+	p.lastReadingAt = now
+	return p.status(now)
+}
+
+// Status without a new reading, eg. for /peak.
+func (p *PeakTracker) Status(now time.Time) PeakStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.status(now)
+}
+
+func (p *PeakTracker) status(now time.Time) PeakStatus {
+	status := PeakStatus{
+		QuarterStart: p.quarterStart,
+		CurrentW:     math.Round(p.currentW),
+		MonthPeakW: math.Max(config.ActiveTariffConfig.Electricity.CapacityMinimumKW*1000,
+			math.Round(math.Max(p.liveMonthW, p.dbMonthW))),
+	}
+	if p.quarterStart.IsZero() {
+		return status
+	}
+	energyWh := p.energyWh
+	if gap := now.Sub(p.lastReadingAt); gap > 0 && gap <= maxReadingGap {
+		energyWh += p.currentW * gap.Hours()
+	}
+	averageW := p.currentW
+	if seen := now.Sub(p.seenFrom); seen > 0 {
+		averageW = energyWh / seen.Hours()
+	}
+	// The part of the quarter before the first reading is assumed to be at the average
+	elapsed := min(now.Sub(p.quarterStart), quarterHour)
+	remaining := quarterHour - elapsed
+	status.AverageW = math.Round(averageW)
+	status.ProjectedW = math.Round((averageW*elapsed.Hours() + p.currentW*remaining.Hours()) * float64(time.Hour/quarterHour))
+	return status
+}
+
+func (p *PeakTracker) refreshMonthPeak(meterNow time.Time) {
+	if !meterdb.IsAvailable() {
+		return
+	}
+	p.mutex.Lock()
+	meterID := p.meterID
+	p.mutex.Unlock()
+	// Meters without a serial only have the peaks seen live
+	if meterID == "" {
+		return
+	}
+
+	peakW, err := MonthPeakW(meterID, meterNow)
+	if err != nil {
+		log.Printf("Failed to read capacity tariff peak: %v", err)
+		return
+	}
+
+	p.mutex.Lock()
+	if p.month == meterNow.Month() {
+		p.dbMonthW = peakW
+	}
+	p.mutex.Unlock()
+}
+
+// Highest 15 minute average import stored for meterID this month, up to meterNow.
+// Stored timestamps are meter time, so meterNow must be too.
+// The capacity tariff is billed per meter, so meterID must be a meter and not meterdb.AllMeters.
+func MonthPeakW(meterID string, meterNow time.Time) (float64, error) {
+	if meterID == meterdb.AllMeters {
+		return 0, errors.New("capacity peak requires a meter id")
+	}
+	monthStart := time.Date(meterNow.Year(), meterNow.Month(), 1, 0, 0, 0, 0, time.UTC)
+	peaks, err := meterdb.GetQuarterHourImportPeaks(meterID, monthStart.Unix(), meterNow.Unix())
+	if err != nil {
+		return 0, err
+	}
+	peakW := 0.0
+	for _, peak := range peaks {
+		peakW = math.Max(peakW, float64(peak))
+	}
+	return peakW, nil
+}
@@ -0,0 +1,299 @@
+// Calculates energy costs from stored meter totals and the configured tariffs.
+// Timestamps are the meter's local time, so days and months follow the meter clock.
+package energycost
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/dayahead"
+	"github.com/NotCoffee418/european_smart_meter/pkg/esmutils"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+const (
+	TariffTypeFixed         = "fixed"
+	TariffTypeDayNight      = "day_night"
+	TariffTypeDynamicHourly = "dynamic_hourly"
+)
+
+var (
+	ErrUnknownTariffType  = errors.New("unknown electricity tariff type")
+	ErrMissingHourlyPrice = errors.New("no hourly price configured")
+)
+
+// Costs over a period. All amounts include VAT except the *ExclVAT fields.
+type Bill struct {
+	MeterID  string `json:"meter_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Currency string `json:"currency"`
+
+	ImportKWH float64 `json:"import_kwh"`
+	ExportKWH float64 `json:"export_kwh"`
+	GasM3     float64 `json:"gas_m3"`
+	PeakKW    float64 `json:"peak_kw"`
+
+	ElectricityCostExclVAT float64 `json:"electricity_cost_excl_vat"`
+	CapacityCostExclVAT    float64 `json:"capacity_cost_excl_vat"`
+	GasCostExclVAT         float64 `json:"gas_cost_excl_vat"`
+	FixedFeesExclVAT       float64 `json:"fixed_fees_excl_vat"`
+	VAT                    float64 `json:"vat"`
+	InjectionCompensation  float64 `json:"injection_compensation"`
+	Total                  float64 `json:"total"`
+}
+
+// Day-ahead price of an interval, times in meter local time.
+type ContractPrice struct {
+	Start           string  `json:"start"`
+	End             string  `json:"end"`
+	MarketPriceKWH  float64 `json:"market_price_kwh"`
+	PriceKWH        float64 `json:"price_kwh"`
+	PriceKWHInclVAT float64 `json:"price_kwh_incl_vat"`
+}
+
+// Cost of the current power flow if it were sustained for an hour.
+type LiveCost struct {
+	Timestamp         string  `json:"timestamp"`
+	Currency          string  `json:"currency"`
+	ImportPriceKWH    float64 `json:"import_price_kwh"`
+	InjectionPriceKWH float64 `json:"injection_price_kwh"`
+	// Including VAT, negative when injection compensation outweighs the cost
+	CostPerHour float64 `json:"cost_per_hour"`
+}
+
+// Price per imported kWh excluding VAT.
+// meterTariff is the tariff register of the meter, 1 = Day, 2 = Night.
+func ImportPriceKWH(tariff *config.TariffConfig, at time.Time, meterTariff int) (float64, error) {
+	return importPriceKWH(tariff, at, at.Add(time.Second), meterTariff)
+}
+
+// Average import price over from (inclusive) to (exclusive).
+func importPriceKWH(tariff *config.TariffConfig, from time.Time, to time.Time, meterTariff int) (float64, error) {
+	electricity := tariff.Electricity
+	switch electricity.Type {
+	case TariffTypeFixed:
+		return electricity.PriceKWH, nil
+	case TariffTypeDayNight:
+		if meterTariff == 2 {
+			return electricity.NightPriceKWH, nil
+		}
+		return electricity.DayPriceKWH, nil
+	case TariffTypeDynamicHourly:
+		if meterdb.IsAvailable() {
+			marketPrice, err := meterdb.GetAveragePriceKWH(from.Unix(), to.Unix())
+			if err == nil {
+				return ContractPriceKWH(tariff, marketPrice), nil
+			}
+			if err != sql.ErrNoRows {
+				return 0, err
+			}
+		}
+
+		// No day-ahead price known, use the configured price for this hour
+		hour := from.Hour()
+		if hour >= len(electricity.HourlyPricesKWH) {
+			return 0, fmt.Errorf("%w for hour %d", ErrMissingHourlyPrice, hour)
+		}
+		return electricity.HourlyPricesKWH[hour], nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownTariffType, electricity.Type)
+	}
+}
+
+// Price paid under a dynamic contract for a day-ahead market price, excluding VAT.
+func ContractPriceKWH(tariff *config.TariffConfig, marketPriceKWH float64) float64 {
+	return marketPriceKWH*tariff.Electricity.DynamicPriceMultiplier + tariff.Electricity.DynamicPriceMarkupKWH
+}
+
+// Day-ahead prices as paid under the configured dynamic contract.
+func ContractPrices(tariff *config.TariffConfig, prices []*dayahead.Price) []*ContractPrice {
+	contractPrices := make([]*ContractPrice, 0, len(prices))
+	for _, price := range prices {
+		contractPrice := ContractPriceKWH(tariff, price.PriceKWH)
+		contractPrices = append(contractPrices, &ContractPrice{
+			Start:           price.Start.Format(time.RFC3339),
+			End:             price.Start.Add(price.Duration).Format(time.RFC3339),
+			MarketPriceKWH:  roundAmount(price.PriceKWH),
+			PriceKWH:        roundAmount(contractPrice),
+			PriceKWHInclVAT: roundAmount(contractPrice * vatMultiplier(tariff)),
+		})
+	}
+	return contractPrices
+}
+
+func CalculateLiveCost(tariff *config.TariffConfig, reading *interpreter.RawMeterReading) (*LiveCost, error) {
+	at, err := time.Parse(time.RFC3339, reading.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	importPrice, err := ImportPriceKWH(tariff, at, reading.CurrentTariff)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := reading.CurrentConsumptionKW * importPrice * vatMultiplier(tariff)
+	compensation := reading.CurrentProductionKW * tariff.Electricity.InjectionPriceKWH
+	return &LiveCost{
+		Timestamp:         reading.Timestamp,
+		Currency:          tariff.Currency,
+		ImportPriceKWH:    importPrice,
+		InjectionPriceKWH: tariff.Electricity.InjectionPriceKWH,
+		CostPerHour:       roundAmount(cost - compensation),
+	}, nil
+}
+
+// Bill for a single day, day is truncated to midnight.
+func DailyBill(tariff *config.TariffConfig, meterID string, day time.Time) (*Bill, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return CalculateBill(tariff, meterID, from, from.AddDate(0, 0, 1))
+}
+
+// Bill for the month day falls in.
+func MonthlyBill(tariff *config.TariffConfig, meterID string, month time.Time) (*Bill, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return CalculateBill(tariff, meterID, from, from.AddDate(0, 1, 0))
+}
+
+// Bill for the period from (inclusive) to (exclusive).
+// Monthly fees and capacity costs are prorated by the part of each month covered.
+func CalculateBill(tariff *config.TariffConfig, meterID string, from time.Time, to time.Time) (*Bill, error) {
+	fromUnix := from.Unix()
+	toUnix := to.Unix() - 1
+	bill := &Bill{
+		MeterID:  meterID,
+		From:     from.Format(time.RFC3339),
+		To:       to.Format(time.RFC3339),
+		Currency: tariff.Currency,
+	}
+
+	// Imported energy, priced per hour and register
+	for _, readingType := range []meterdb.MeterDbPowerReadingType{meterdb.PowerConsumptionDay, meterdb.PowerConsumptionNight} {
+		meterTariff := 1
+		if readingType == meterdb.PowerConsumptionNight {
+			meterTariff = 2
+		}
+		usage, err := meterdb.GetPowerUsageByHour(meterID, readingType, fromUnix, toUnix)
+		if err != nil {
+			return nil, err
+		}
+		for hour, wh := range usage {
+			hourStart := time.Unix(hour, 0).UTC()
+			price, err := importPriceKWH(tariff, hourStart, hourStart.Add(time.Hour), meterTariff)
+			if err != nil {
+				return nil, err
+			}
+			kwh := esmutils.WToKw(wh)
+			bill.ImportKWH += kwh
+			bill.ElectricityCostExclVAT += kwh * price
+		}
+	}
+
+	// Exported energy
+	for _, readingType := range []meterdb.MeterDbPowerReadingType{meterdb.PowerProductionDay, meterdb.PowerProductionNight} {
+		wh, err := meterdb.GetTotalPowerUsageWh(meterID, readingType, fromUnix, toUnix)
+		if err != nil {
+			return nil, err
+		}
+		bill.ExportKWH += esmutils.WToKw(wh)
+	}
+	bill.InjectionCompensation = bill.ExportKWH * tariff.Electricity.InjectionPriceKWH
+
+	// Gas
+	dm3, err := meterdb.GetTotalGasUsageDM3(meterID, fromUnix, toUnix)
+	if err != nil {
+		return nil, err
+	}
+	bill.GasM3 = esmutils.DM3ToM3(dm3)
+	bill.GasCostExclVAT = bill.GasM3 * tariff.Gas.PriceM3
+
+	// Monthly components, per meter
+	meterIDs := []string{meterID}
+	if meterID == meterdb.AllMeters {
+		if meterIDs, err = meterdb.GetMeterIDs(); err != nil {
+			return nil, err
+		}
+	}
+	monthlyFee := tariff.Electricity.FixedMonthlyFee + tariff.Gas.FixedMonthlyFee
+	for _, month := range monthsBetween(from, to) {
+		bill.FixedFeesExclVAT += monthlyFee * month.fraction * float64(len(meterIDs))
+
+		// Peak of the month so far, capacity is charged on the full month
+		peaks, err := meterdb.GetQuarterHourImportPeaks(meterID, month.start.Unix(), toUnix)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range meterIDs {
+			peakKW := esmutils.WToKw(peaks[id])
+			bill.PeakKW = math.Max(bill.PeakKW, peakKW)
+			billedKW := math.Max(peakKW, tariff.Electricity.CapacityMinimumKW)
+			bill.CapacityCostExclVAT += tariff.Electricity.CapacityPriceKWYear / 12 * billedKW * month.fraction
+		}
+	}
+
+	costsExclVAT := bill.ElectricityCostExclVAT + bill.CapacityCostExclVAT + bill.GasCostExclVAT + bill.FixedFeesExclVAT
+	bill.VAT = costsExclVAT * tariff.VATPercent / 100
+	bill.Total = costsExclVAT + bill.VAT - bill.InjectionCompensation
+
+	bill.roundAmounts()
+	return bill, nil
+}
+
+type monthPart struct {
+	start    time.Time
+	fraction float64
+}
+
+// Months overlapping from and to, with the fraction of each month covered.
+func monthsBetween(from time.Time, to time.Time) []monthPart {
+	parts := make([]monthPart, 0)
+	monthStart := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for monthStart.Before(to) {
+		monthEnd := monthStart.AddDate(0, 1, 0)
+		overlapStart := maxTime(monthStart, from)
+		overlapEnd := minTime(monthEnd, to)
+		parts = append(parts, monthPart{
+			start:    monthStart,
+			fraction: overlapEnd.Sub(overlapStart).Seconds() / monthEnd.Sub(monthStart).Seconds(),
+		})
+		monthStart = monthEnd
+	}
+	return parts
+}
+
+func (b *Bill) roundAmounts() {
+	for _, amount := range []*float64{
+		&b.ImportKWH, &b.ExportKWH, &b.GasM3, &b.PeakKW,
+		&b.ElectricityCostExclVAT, &b.CapacityCostExclVAT, &b.GasCostExclVAT, &b.FixedFeesExclVAT,
+		&b.VAT, &b.InjectionCompensation, &b.Total,
+	} {
+		*amount = roundAmount(*amount)
+	}
+}
+
+func vatMultiplier(tariff *config.TariffConfig) float64 {
+	return 1 + tariff.VATPercent/100
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*10000) / 10000
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Request the most recent reading from the interpreter API.
+func FetchLatestReading(endpoint *Endpoint) (*RawMeterReading, error) {
+	var reading RawMeterReading
+	if err := getJson(endpoint, "/latest", nil, &reading); err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// Request readings after since (unix seconds) from the interpreter API's
+// recent readings buffer. Readings older than the buffer are not returned.
+func FetchReadingsSince(endpoint *Endpoint, since int64) ([]*RawMeterReading, error) {
+	query := url.Values{"ts": {strconv.FormatInt(since, 10)}}
+	var readings []*RawMeterReading
+	if err := getJson(endpoint, "/since", query, &readings); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// Request the current solar production from the interpreter API.
+// Fails when no inverter is configured or it cannot be reached.
+func FetchSolarProduction(endpoint *Endpoint) (*SolarProduction, error) {
+	var solar SolarProduction
+	if err := getJson(endpoint, "/solar", nil, &solar); err != nil {
+		return nil, err
+	}
+	return &solar, nil
+}
+
+func getJson(endpoint *Endpoint, path string, query url.Values, target any) error {
+	u := endpoint.URL("http", path, query)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = endpoint.Header()
+	resp, err := endpoint.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from %s: %s", u, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", u, err)
+	}
+	return nil
+}
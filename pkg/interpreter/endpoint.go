@@ -0,0 +1,85 @@
+package interpreter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// An interpreter API and how to authenticate with it.
+type Endpoint struct {
+	Host string
+	TLS  bool
+	// Sent as a bearer token when set
+	Token string
+	// Custom CA or client certificate, nil for the system defaults
+	TLSConfig *tls.Config
+
+	clientOnce sync.Once
+	client     *http.Client
+}
+
+// TLS config trusting caFile and presenting a client certificate, each optional.
+// Returns nil when no files are given.
+func LoadTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// URL of path on the API, scheme is http or ws and gets an s with TLS.
+func (e *Endpoint) URL(scheme string, path string, query url.Values) string {
+	if e.TLS {
+		scheme += "s"
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     e.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Authorization header for the token, empty without one.
+func (e *Endpoint) Header() http.Header {
+	header := http.Header{}
+	if e.Token != "" {
+		header.Set("Authorization", "Bearer "+e.Token)
+	}
+	return header
+}
+
+// Shared client using TLSConfig, requests time out after 30 seconds.
+func (e *Endpoint) HTTPClient() *http.Client {
+	e.clientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = e.TLSConfig
+		e.client = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	})
+	return e.client
+}
@@ -2,16 +2,22 @@ package interpreter
 
 import (
 	"log"
-	"net/url"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // Manage websocket connection and call handleMeterReading for each reading
-func StartListener(host string, tls bool, funcToCall func(reading *RawMeterReading)) {
+// onConnected is optional and runs after every (re)connect, before live readings are handled.
+func StartListener(
+	endpoint *Endpoint,
+	funcToCall func(reading *RawMeterReading),
+	onConnected func(),
+) {
 	const (
 		maxRetries     = 10
 		baseRetryDelay = 2 * time.Second
@@ -19,15 +25,11 @@ func StartListener(host string, tls bool, funcToCall func(reading *RawMeterReadi
 	)
 
 	// WebSocket server URL
-	scheme := "ws"
-	if tls {
-		scheme = "wss"
-	}
-	u := url.URL{Scheme: scheme, Host: host, Path: "/ws"}
+	wsURL := endpoint.URL("ws", "/ws", nil)
 
 	// Channel to handle interrupt signal
 	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
 	retryCount := 0
 
@@ -53,12 +55,15 @@ func StartListener(host string, tls bool, funcToCall func(reading *RawMeterReadi
 				}
 			}
 
-			log.Printf("Connecting to %s", u.String())
+			log.Printf("Connecting to %s", wsURL)
 
 			// Create a simple dialer with timeout
-			dialer := websocket.DefaultDialer
-			dialer.HandshakeTimeout = 10 * time.Second
-			c, _, err := dialer.Dial(u.String(), nil)
+			dialer := websocket.Dialer{
+				Proxy:            http.ProxyFromEnvironment,
+				HandshakeTimeout: 10 * time.Second,
+				TLSClientConfig:  endpoint.TLSConfig,
+			}
+			c, _, err := dialer.Dial(wsURL, endpoint.Header())
 			if err != nil {
 				log.Printf("Connection failed: %v", err)
 				retryCount++
@@ -74,6 +79,11 @@ func StartListener(host string, tls bool, funcToCall func(reading *RawMeterReadi
 			// Reset retry count on successful connection
 			retryCount = 0
 
+			// Eg. catch up on readings missed while disconnected
+			if onConnected != nil {
+				onConnected()
+			}
+
 			// Handle the connection until it breaks or we're interrupted
 			connectionBroken := handleConnection(c, interrupt, funcToCall)
 
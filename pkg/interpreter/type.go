@@ -2,6 +2,15 @@ package interpreter
 
 import "encoding/json"
 
+// Response of the interpreter API's /solar endpoint.
+// LifetimeYieldWh is 0 for interpreter APIs that do not report it yet.
+// Stale is true when the values are the last snapshot of an inverter that can no longer be read.
+type SolarProduction struct {
+	CurrentProductionW int32 `json:"currentProduction"`
+	LifetimeYieldWh    int64 `json:"lifetimeYieldWh"`
+	Stale              bool  `json:"stale"`
+}
+
 type RawMeterReading struct {
 	Timestamp string `json:"timestamp"`
 
@@ -0,0 +1,132 @@
+// Typed client for the /api/v1 endpoints of the interpreter API.
+package interpreterclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+const apiPrefix = "/api/v1"
+
+// Client of one interpreter API, safe for concurrent use.
+type Client struct {
+	endpoint *interpreter.Endpoint
+	// Without a timeout, for the event stream
+	streamClient *http.Client
+}
+
+func New(endpoint *interpreter.Endpoint) *Client {
+	return &Client{
+		endpoint:     endpoint,
+		streamClient: &http.Client{Transport: endpoint.HTTPClient().Transport},
+	}
+}
+
+// Error returned by the API, eg. 503 when the meter database or a feature is not available.
+type APIError struct {
+	StatusCode int
+	Code       string // eg. not_found, unavailable
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("interpreter API returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Period of the history endpoints.
+type Period string
+
+const (
+	Day   Period = "day"
+	Month Period = "month"
+)
+
+// Day or month to query, in meter local time.
+type HistoryQuery struct {
+	Period Period    // Defaults to Day
+	Date   time.Time // Any day in the period, today when zero
+	Meter  string    // Meter serial, all meters when empty
+}
+
+func (q HistoryQuery) values() url.Values {
+	query := url.Values{"period": {string(Day)}}
+	if q.Period != "" {
+		query.Set("period", string(q.Period))
+	}
+	if !q.Date.IsZero() {
+		query.Set("date", q.Date.Format(time.DateOnly))
+	}
+	if q.Meter != "" {
+		query.Set("meter", q.Meter)
+	}
+	return query
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, target any) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, target)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, target any) error {
+	resp, err := c.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return decode(resp, target)
+}
+
+func (c *Client) request(ctx context.Context, method string, path string, query url.Values, body any) (*http.Response, error) {
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		requestBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint.URL("http", apiPrefix+path, query), requestBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.endpoint.Header()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.endpoint.HTTPClient().Do(req)
+}
+
+func decode(resp *http.Response, target any) error {
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", resp.Request.URL, err)
+	}
+	return nil
+}
+
+// APIError from the error envelope, or the status for responses without one.
+func responseError(resp *http.Response) error {
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&envelope); err == nil && envelope.Error.Message != "" {
+		apiErr.Code = envelope.Error.Code
+		apiErr.Message = envelope.Error.Message
+	}
+	return apiErr
+}
@@ -0,0 +1,157 @@
+package interpreterclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+// Client of a test server that requires the token "secret".
+func newTestClient(t *testing.T, mux *http.ServeMux) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return New(&interpreter.Endpoint{Host: strings.TrimPrefix(server.URL, "http://"), Token: "secret"})
+}
+
+func TestClientEndpoints(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/latest", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"timestamp":"2026-10-18T12:00:00Z","current_consumption_kw":1.25,"meter_serial_electricity":"E0001"}`)
+	})
+	mux.HandleFunc("GET /api/v1/bill", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.RawQuery; got != "date=2026-10-01&meter=E0001&period=month" {
+			t.Errorf("bill query %q", got)
+		}
+		io.WriteString(w, `{"meter_id":"E0001","currency":"EUR","import_kwh":312.5,"peak_kw":4.2,"total":98.76}`)
+	})
+	mux.HandleFunc("GET /api/v1/solar", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"age_seconds":4,"stale":false,"driver":"huawei","active_power_w":2300,"battery":{"state_of_charge_percent":81.5}}`)
+	})
+	mux.HandleFunc("POST /api/v1/control", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"mode":"zero_export","max_power_w":3000}` {
+			t.Errorf("control body %s", body)
+		}
+		io.WriteString(w, `{"mode":"zero_export","max_power_w":3000,"setpoint_w":1200,"device_power_w":null}`)
+	})
+	mux.HandleFunc("GET /api/v1/rules", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"error":{"status":503,"code":"unavailable","message":"Rules are disabled"}}`)
+	})
+	client := newTestClient(t, mux)
+	ctx := context.Background()
+
+	reading, err := client.Latest(ctx)
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if reading.CurrentConsumptionKW != 1.25 || reading.MeterSerialElectricity != "E0001" {
+		t.Errorf("Latest returned %+v", reading)
+	}
+
+	bill, err := client.Bill(ctx, HistoryQuery{Period: Month, Date: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Meter: "E0001"})
+	if err != nil {
+		t.Fatalf("Bill: %v", err)
+	}
+	if bill.ImportKWH != 312.5 || bill.PeakKW != 4.2 || bill.Total != 98.76 {
+		t.Errorf("Bill returned %+v", bill)
+	}
+
+	solar, err := client.Solar(ctx)
+	if err != nil {
+		t.Fatalf("Solar: %v", err)
+	}
+	if solar.ActivePowerW != 2300 || solar.Battery == nil || solar.Battery.StateOfCharge != 81.5 {
+		t.Errorf("Solar returned %+v", solar)
+	}
+
+	mode, maxPowerW := "zero_export", 3000.0
+	status, err := client.SetControl(ctx, &ControlSettings{Mode: &mode, MaxPowerW: &maxPowerW})
+	if err != nil {
+		t.Fatalf("SetControl: %v", err)
+	}
+	if status.SetpointW != 1200 || status.DevicePowerW != nil {
+		t.Errorf("SetControl returned %+v", status)
+	}
+
+	_, err = client.Rules(ctx)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Code != "unavailable" || apiErr.Message != "Rules are disabled" {
+		t.Errorf("Rules returned error %v, want the APIError of the envelope", err)
+	}
+}
+
+func TestClientSubscribeResumes(t *testing.T) {
+	connections := make(chan string, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("types"); got != "readings,peak,events" {
+			t.Errorf("types %q", got)
+		}
+		lastEventID := r.Header.Get("Last-Event-ID")
+		connections <- lastEventID
+		w.Header().Set("Content-Type", "text/event-stream")
+		if lastEventID == "" {
+			// The stream ends after a reading, the client resumes after it
+			io.WriteString(w, ": keepalive\n\n")
+			io.WriteString(w, "id: 100\nevent: readings\ndata: {\"current_consumption_kw\":0.5}\n\n")
+			io.WriteString(w, "event: peak\ndata: {\"month_peak_w\":4200}\n\n")
+			return
+		}
+		fmt.Fprintf(w, "event: events\ndata: %s\n\n", `{"rule":"export","state":"firing","value":3.2}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	client := newTestClient(t, mux)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := client.Subscribe(ctx, Subscription{Types: []string{TypeReadings, TypePeak, TypeEvents}})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	var received []*Message
+	for message := range messages {
+		received = append(received, message)
+		if len(received) == 3 {
+			cancel()
+		}
+	}
+	if len(received) != 3 {
+		t.Fatalf("received %d messages, want 3", len(received))
+	}
+
+	if m := received[0]; m.Type != TypeReadings || m.ID != 100 || m.Reading == nil || m.Reading.CurrentConsumptionKW != 0.5 {
+		t.Errorf("first message %+v, want the reading", m)
+	}
+	if m := received[1]; m.Type != TypePeak || m.Peak == nil || m.Peak.MonthPeakW != 4200 {
+		t.Errorf("second message %+v, want the peak", m)
+	}
+	if m := received[2]; m.Type != TypeEvents || m.Event == nil || m.Event.Rule != "export" || m.Event.Value != 3.2 {
+		t.Errorf("third message %+v, want the rule event", m)
+	}
+	var event map[string]any
+	if err := json.Unmarshal(received[2].Data, &event); err != nil || event["state"] != "firing" {
+		t.Errorf("raw data %s", received[2].Data)
+	}
+
+	if first, second := <-connections, <-connections; first != "" || second != "100" {
+		t.Errorf("Last-Event-ID %q then %q, want none then 100", first, second)
+	}
+}
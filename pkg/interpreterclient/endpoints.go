@@ -0,0 +1,209 @@
+package interpreterclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+// Response of Health, Status is ok or degraded when no reading arrived for 30 seconds.
+type Health struct {
+	Status        string  `json:"status"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	// Meter timestamp of the latest reading, empty and nil before the first reading
+	LastReading           string   `json:"last_reading"`
+	LastReadingAgeSeconds *float64 `json:"last_reading_age_seconds"`
+	SolarConfigured       bool     `json:"solar_configured"`
+	SolarStale            bool     `json:"solar_stale"`
+	MeterDatabase         bool     `json:"meter_database"`
+	WebSocketClients      int      `json:"websocket_clients"`
+}
+
+// Response of Solar, Stale is true when the inverter could not be read for three poll intervals.
+type SolarStatus struct {
+	AgeSeconds float64 `json:"age_seconds"`
+	Stale      bool    `json:"stale"`
+	LastError  string  `json:"last_error,omitempty"`
+	*InverterSnapshot
+}
+
+// Response of Prices, in meter local time. Current is nil when no price covers the current hour.
+type Prices struct {
+	Currency string           `json:"currency"`
+	Current  *ContractPrice   `json:"current"`
+	Upcoming []*ContractPrice `json:"upcoming"`
+}
+
+// Whether readings are arriving from the meter.
+// A degraded API is returned without error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	resp, err := c.request(ctx, http.MethodGet, "/health", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, responseError(resp)
+	}
+	var health Health
+	if err := decode(resp, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Latest reading from the smart meter.
+func (c *Client) Latest(ctx context.Context) (*interpreter.RawMeterReading, error) {
+	var reading interpreter.RawMeterReading
+	if err := c.get(ctx, "/latest", nil, &reading); err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// Readings after since (unix seconds of the meter timestamp) still held in the API's buffer, oldest first.
+func (c *Client) ReadingsSince(ctx context.Context, since int64) ([]*interpreter.RawMeterReading, error) {
+	query := url.Values{"ts": {strconv.FormatInt(since, 10)}}
+	var readings []*interpreter.RawMeterReading
+	if err := c.get(ctx, "/since", query, &readings); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// Latest inverter snapshot, an APIError with status 503 when no inverter is configured or read yet.
+func (c *Client) Solar(ctx context.Context) (*SolarStatus, error) {
+	var solar SolarStatus
+	if err := c.get(ctx, "/solar", nil, &solar); err != nil {
+		return nil, err
+	}
+	if solar.InverterSnapshot == nil {
+		return nil, errors.New("interpreter API returned no inverter snapshot")
+	}
+	return &solar, nil
+}
+
+// Solar production per hour of a day or day of a month.
+func (c *Client) SolarHistory(ctx context.Context, q HistoryQuery) (*SolarHistory, error) {
+	var history SolarHistory
+	if err := c.get(ctx, "/solar/history", q.values(), &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// Stored solar readings from (unix seconds) up to to, at most a day after from.
+// to and meter are optional.
+func (c *Client) SolarReadings(ctx context.Context, from int64, to int64, meter string) ([]*SolarReading, error) {
+	query := url.Values{"from": {strconv.FormatInt(from, 10)}}
+	if to > 0 {
+		query.Set("to", strconv.FormatInt(to, 10))
+	}
+	if meter != "" {
+		query.Set("meter", meter)
+	}
+	var readings []*SolarReading
+	if err := c.get(ctx, "/solar/readings", query, &readings); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// Average import of the current quarter hour, its projection and the month peak.
+func (c *Client) Peak(ctx context.Context) (*PeakStatus, error) {
+	var peak PeakStatus
+	if err := c.get(ctx, "/peak", nil, &peak); err != nil {
+		return nil, err
+	}
+	return &peak, nil
+}
+
+// Cost per hour of the current power flow.
+func (c *Client) Cost(ctx context.Context) (*LiveCost, error) {
+	var cost LiveCost
+	if err := c.get(ctx, "/cost", nil, &cost); err != nil {
+		return nil, err
+	}
+	return &cost, nil
+}
+
+// Bill over a day or month.
+func (c *Client) Bill(ctx context.Context, q HistoryQuery) (*Bill, error) {
+	var bill Bill
+	if err := c.get(ctx, "/bill", q.values(), &bill); err != nil {
+		return nil, err
+	}
+	return &bill, nil
+}
+
+// Current house consumption, self-consumption and self-sufficiency.
+func (c *Client) LiveBalance(ctx context.Context) (*LiveBalance, error) {
+	var balance LiveBalance
+	if err := c.get(ctx, "/balance", nil, &balance); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// Energy balance over a day or month.
+func (c *Client) Balance(ctx context.Context, q HistoryQuery) (*PeriodBalance, error) {
+	var balance PeriodBalance
+	if err := c.get(ctx, "/balance", q.values(), &balance); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// Current and upcoming day-ahead prices for the next hours, 48 when 0.
+func (c *Client) Prices(ctx context.Context, hours int) (*Prices, error) {
+	query := url.Values{}
+	if hours > 0 {
+		query.Set("hours", strconv.Itoa(hours))
+	}
+	var prices Prices
+	if err := c.get(ctx, "/prices", query, &prices); err != nil {
+		return nil, err
+	}
+	return &prices, nil
+}
+
+// Load control mode, limits and setpoint.
+func (c *Client) Control(ctx context.Context) (*ControlStatus, error) {
+	var status ControlStatus
+	if err := c.get(ctx, "/control", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Change the load control settings that are set, returns the new status.
+func (c *Client) SetControl(ctx context.Context, settings *ControlSettings) (*ControlStatus, error) {
+	var status ControlStatus
+	if err := c.do(ctx, http.MethodPost, "/control", nil, settings, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Enabled notification rules and whether they are firing.
+func (c *Client) Rules(ctx context.Context) ([]*RuleStatus, error) {
+	var statuses []*RuleStatus
+	if err := c.get(ctx, "/rules", nil, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// Connected OCPP charge points.
+func (c *Client) ChargePoints(ctx context.Context) ([]*ChargePointStatus, error) {
+	var chargePoints []*ChargePointStatus
+	if err := c.get(ctx, "/ocpp", nil, &chargePoints); err != nil {
+		return nil, err
+	}
+	return chargePoints, nil
+}
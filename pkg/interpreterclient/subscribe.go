@@ -0,0 +1,233 @@
+package interpreterclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+// Message types of Subscribe
+const (
+	TypeReadings = "readings"
+	TypeSolar    = "solar"
+	TypePeak     = "peak"
+	TypeEvents   = "events"
+)
+
+const (
+	subscribeBaseRetryDelay = 2 * time.Second
+	subscribeMaxRetryDelay  = 60 * time.Second
+	// The API sends a keepalive every 30 seconds, silence for longer means the connection is gone
+	subscribeIdleTimeout = 75 * time.Second
+)
+
+// What to receive from Subscribe, all readings when empty.
+type Subscription struct {
+	Types  []string // TypeReadings, TypeSolar, TypePeak and TypeEvents, readings when empty
+	Fields []string // JSON names of the reading fields to receive, all when empty
+	// Minimum time between messages of a type, events are always sent
+	Interval time.Duration
+	// Only send messages in which a value changed by more than Deadband
+	ChangeOnly bool
+	Deadband   float64
+}
+
+func (s Subscription) values() url.Values {
+	query := url.Values{}
+	if len(s.Types) > 0 {
+		query.Set("types", strings.Join(s.Types, ","))
+	}
+	if len(s.Fields) > 0 {
+		query.Set("fields", strings.Join(s.Fields, ","))
+	}
+	if s.Interval > 0 {
+		query.Set("interval", strconv.FormatFloat(s.Interval.Seconds(), 'f', -1, 64))
+	}
+	if s.ChangeOnly {
+		query.Set("change_only", "true")
+	}
+	if s.Deadband > 0 {
+		query.Set("deadband", strconv.FormatFloat(s.Deadband, 'f', -1, 64))
+	}
+	return query
+}
+
+// Solar production sent after each inverter read.
+type SolarProduction struct {
+	CurrentProductionW int32     `json:"current_production_w"`
+	LifetimeYieldWh    int64     `json:"lifetime_yield_wh"`
+	ReadAt             time.Time `json:"read_at"`
+	AgeSeconds         float64   `json:"age_seconds"`
+	Stale              bool      `json:"stale"`
+}
+
+// Message from Subscribe, the field matching Type is set.
+type Message struct {
+	Type string
+	// Unix timestamp of the meter reading, 0 for other types
+	ID   int64
+	Data json.RawMessage
+
+	// Only the subscribed fields are set
+	Reading *interpreter.RawMeterReading
+	Solar   *SolarProduction
+	Peak    *PeakStatus
+	Event   *Event
+}
+
+// Stream messages from /events until ctx is done, then the channel is closed.
+// Only the first connection fails with an error, afterwards the client reconnects
+// with backoff and resumes after the last reading it received.
+func (c *Client) Subscribe(ctx context.Context, sub Subscription) (<-chan *Message, error) {
+	resp, err := c.openStream(ctx, sub, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(chan *Message, 16)
+	go func() {
+		defer close(messages)
+		var lastID int64
+		retryCount := 0
+		for {
+			if resp != nil {
+				retryCount = 0
+				err = c.readStream(ctx, resp, messages, &lastID)
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Event stream from %s lost: %v", c.endpoint.Host, err)
+			}
+
+			retryDelay := min(time.Duration(1<<retryCount)*subscribeBaseRetryDelay, subscribeMaxRetryDelay)
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+				return
+			}
+			if resp, err = c.openStream(ctx, sub, lastID); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Failed to reconnect event stream to %s: %v", c.endpoint.Host, err)
+				retryCount = min(retryCount+1, 5)
+			}
+		}
+	}()
+	return messages, nil
+}
+
+func (c *Client) openStream(ctx context.Context, sub Subscription, lastID int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint.URL("http", apiPrefix+"/events", sub.values()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.endpoint.Header()
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(lastID, 10))
+	}
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// Parse server-sent events until the stream ends, always returns an error.
+func (c *Client) readStream(ctx context.Context, resp *http.Response, messages chan<- *Message, lastID *int64) error {
+	defer resp.Body.Close()
+	idle := time.AfterFunc(subscribeIdleTimeout, func() { resp.Body.Close() })
+	defer idle.Stop()
+
+	reader := bufio.NewReader(resp.Body)
+	var eventType, id string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		idle.Reset(subscribeIdleTimeout)
+
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				eventType = value
+			case "data":
+				data = append(data, value)
+			case "id":
+				id = value
+			}
+			// Comments are keepalives
+			continue
+		}
+
+		// A blank line ends the event
+		if len(data) > 0 {
+			message, err := parseMessage(eventType, id, strings.Join(data, "\n"))
+			if err != nil {
+				log.Printf("Failed to parse %s event: %v", eventType, err)
+			} else {
+				if message.ID > 0 {
+					*lastID = message.ID
+				}
+				select {
+				case messages <- message:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		eventType, id, data = "", "", nil
+	}
+}
+
+func parseMessage(eventType string, id string, data string) (*Message, error) {
+	if eventType == "" {
+		eventType = TypeReadings
+	}
+	message := &Message{Type: eventType, Data: json.RawMessage(data)}
+	if id != "" {
+		message.ID, _ = strconv.ParseInt(id, 10, 64)
+	}
+
+	var target any
+	switch eventType {
+	case TypeReadings:
+		message.Reading = &interpreter.RawMeterReading{}
+		target = message.Reading
+	case TypeSolar:
+		message.Solar = &SolarProduction{}
+		target = message.Solar
+	case TypePeak:
+		message.Peak = &PeakStatus{}
+		target = message.Peak
+	case TypeEvents:
+		message.Event = &Event{}
+		target = message.Event
+	default:
+		// Newer types are passed on as raw data
+		return message, nil
+	}
+	return message, json.Unmarshal(message.Data, target)
+}
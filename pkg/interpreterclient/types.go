@@ -0,0 +1,246 @@
+package interpreterclient
+
+import "time"
+
+// Responses of the API, declared here so the client does not pull in the packages
+// behind the API (databases, configuration, device drivers).
+// Timestamps in strings are meter local time.
+
+// Stored solar reading, LifetimeYieldWh is nil when the inverter does not report it.
+type SolarReading struct {
+	MeterID         string `json:"meter_id"`
+	Timestamp       int64  `json:"timestamp"`
+	PowerWatt       int32  `json:"power_watt"`
+	LifetimeYieldWh *int64 `json:"lifetime_yield_wh"`
+}
+
+// Response of SolarHistory, intervals are hours of a day or days of a month.
+type SolarHistory struct {
+	MeterID       string           `json:"meter_id"`
+	From          string           `json:"from"`
+	To            string           `json:"to"`
+	ProductionKWH float64          `json:"production_kwh"`
+	PeakW         int32            `json:"peak_w"`
+	Intervals     []*SolarInterval `json:"intervals"`
+}
+
+type SolarInterval struct {
+	Start         string  `json:"start"`
+	ProductionKWH float64 `json:"production_kwh"`
+}
+
+// Latest values read from the inverter.
+type InverterSnapshot struct {
+	ReadAt time.Time `json:"read_at"`
+	Driver string    `json:"driver"`
+
+	ActivePowerW          int32   `json:"active_power_w"`
+	InputPowerW           int32   `json:"input_power_w"`
+	ReactivePowerVar      int32   `json:"reactive_power_var"`
+	PeakActivePowerTodayW int32   `json:"peak_active_power_today_w"`
+	PowerFactor           float64 `json:"power_factor"`
+	EfficiencyPercent     float64 `json:"efficiency_percent"`
+
+	DailyYieldWh    int64 `json:"daily_yield_wh"`
+	LifetimeYieldWh int64 `json:"lifetime_yield_wh"`
+
+	GridFrequencyHz float64    `json:"grid_frequency_hz"`
+	PhaseVoltagesV  [3]float64 `json:"phase_voltages_v"`
+	PhaseCurrentsA  [3]float64 `json:"phase_currents_a"`
+	LineVoltagesV   [3]float64 `json:"line_voltages_v"` // A-B, B-C, C-A
+
+	InternalTemperatureC     float64 `json:"internal_temperature_c"`
+	InsulationResistanceMOhm float64 `json:"insulation_resistance_mohm"`
+
+	PVStrings []PVString `json:"pv_strings"`
+
+	// Status and alarm codes are vendor specific, the texts describe them
+	DeviceStatus     uint16    `json:"device_status"`
+	DeviceStatusText string    `json:"device_status_text"`
+	FaultCode        uint16    `json:"fault_code"`
+	StateCodes       [3]uint32 `json:"state_codes"`
+	AlarmCodes       [3]uint16 `json:"alarm_codes"`
+	Alarms           []string  `json:"alarms"`
+
+	// nil when no battery is connected
+	Battery *BatterySnapshot `json:"battery"`
+}
+
+type PVString struct {
+	VoltageV float64 `json:"voltage_v"`
+	CurrentA float64 `json:"current_a"`
+}
+
+type BatterySnapshot struct {
+	RunningStatus     uint16  `json:"running_status"`
+	RunningStatusText string  `json:"running_status_text"`
+	StateOfCharge     float64 `json:"state_of_charge_percent"`
+	RatedCapacityWh   uint32  `json:"rated_capacity_wh"`
+	ChargePowerW      int32   `json:"charge_power_w"` // Negative when discharging
+}
+
+// Response of Peak, also sent to TypePeak subscribers.
+type PeakStatus struct {
+	QuarterStart time.Time `json:"quarter_start"`
+	// Average import since the start of the quarter hour
+	AverageW float64 `json:"average_w"`
+	// Average of the quarter hour if the current import continues
+	ProjectedW float64 `json:"projected_w"`
+	// Highest quarter hour of the month, at least the capacity minimum
+	MonthPeakW float64 `json:"month_peak_w"`
+	CurrentW   float64 `json:"current_w"`
+}
+
+// Price of an hour under the contract, excluding VAT unless stated otherwise.
+type ContractPrice struct {
+	Start           string  `json:"start"`
+	End             string  `json:"end"`
+	MarketPriceKWH  float64 `json:"market_price_kwh"`
+	PriceKWH        float64 `json:"price_kwh"`
+	PriceKWHInclVAT float64 `json:"price_kwh_incl_vat"`
+}
+
+// Response of Cost.
+type LiveCost struct {
+	Timestamp         string  `json:"timestamp"`
+	Currency          string  `json:"currency"`
+	ImportPriceKWH    float64 `json:"import_price_kwh"`
+	InjectionPriceKWH float64 `json:"injection_price_kwh"`
+	// Including VAT, negative when injection compensation outweighs the cost
+	CostPerHour float64 `json:"cost_per_hour"`
+}
+
+// Response of Bill.
+type Bill struct {
+	MeterID  string `json:"meter_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Currency string `json:"currency"`
+
+	ImportKWH float64 `json:"import_kwh"`
+	ExportKWH float64 `json:"export_kwh"`
+	GasM3     float64 `json:"gas_m3"`
+	PeakKW    float64 `json:"peak_kw"`
+
+	ElectricityCostExclVAT float64 `json:"electricity_cost_excl_vat"`
+	CapacityCostExclVAT    float64 `json:"capacity_cost_excl_vat"`
+	GasCostExclVAT         float64 `json:"gas_cost_excl_vat"`
+	FixedFeesExclVAT       float64 `json:"fixed_fees_excl_vat"`
+	VAT                    float64 `json:"vat"`
+	InjectionCompensation  float64 `json:"injection_compensation"`
+	Total                  float64 `json:"total"`
+}
+
+// Response of LiveBalance.
+type LiveBalance struct {
+	Timestamp            string  `json:"timestamp"`
+	ImportKW             float64 `json:"import_kw"`
+	ExportKW             float64 `json:"export_kw"`
+	SolarKW              float64 `json:"solar_kw"`
+	ConsumptionKW        float64 `json:"consumption_kw"`
+	SelfConsumedKW       float64 `json:"self_consumed_kw"`
+	SelfConsumptionRatio float64 `json:"self_consumption_ratio"`
+	SelfSufficiencyRatio float64 `json:"self_sufficiency_ratio"`
+}
+
+// Response of Balance.
+type PeriodBalance struct {
+	MeterID              string  `json:"meter_id"`
+	From                 string  `json:"from"`
+	To                   string  `json:"to"`
+	ImportKWH            float64 `json:"import_kwh"`
+	ExportKWH            float64 `json:"export_kwh"`
+	SolarKWH             float64 `json:"solar_kwh"`
+	ConsumptionKWH       float64 `json:"consumption_kwh"`
+	SelfConsumedKWH      float64 `json:"self_consumed_kwh"`
+	SelfConsumptionRatio float64 `json:"self_consumption_ratio"`
+	SelfSufficiencyRatio float64 `json:"self_sufficiency_ratio"`
+	// Part of the period with stored balance rows, and with known solar production
+	Coverage      float64 `json:"coverage"`
+	SolarCoverage float64 `json:"solar_coverage"`
+}
+
+// Settings of SetControl, nil fields are left unchanged.
+type ControlSettings struct {
+	Mode         *string  `json:"mode,omitempty"`
+	MinPowerW    *float64 `json:"min_power_w,omitempty"`
+	MaxPowerW    *float64 `json:"max_power_w,omitempty"`
+	HysteresisW  *float64 `json:"hysteresis_w,omitempty"`
+	ExportLimitW *float64 `json:"export_limit_w,omitempty"`
+	StartPowerW  *float64 `json:"start_power_w,omitempty"`
+	PeakLimitW   *float64 `json:"peak_limit_w,omitempty"`
+
+	PeakLimitFromCapacityTariff *bool `json:"peak_limit_from_capacity_tariff,omitempty"`
+}
+
+// Response of Control and SetControl.
+type ControlStatus struct {
+	Mode         string  `json:"mode"`
+	MinPowerW    float64 `json:"min_power_w"`
+	MaxPowerW    float64 `json:"max_power_w"`
+	HysteresisW  float64 `json:"hysteresis_w"`
+	ExportLimitW float64 `json:"export_limit_w"`
+	StartPowerW  float64 `json:"start_power_w"`
+	PeakLimitW   float64 `json:"peak_limit_w"`
+
+	PeakLimitFromCapacityTariff bool `json:"peak_limit_from_capacity_tariff"`
+	// Highest 15 minute import of this month, when the peak limit follows the capacity tariff
+	CapacityPeakW float64 `json:"capacity_peak_w"`
+
+	// Measured grid power, positive when importing
+	GridPowerW float64 `json:"grid_power_w"`
+	// Last setpoint sent to the device
+	SetpointW float64 `json:"setpoint_w"`
+	// Power reported by the device itself, nil when it does not measure it
+	DevicePowerW *float64 `json:"device_power_w"`
+	// nil until the device was set for the first time
+	SetpointAt *time.Time `json:"setpoint_at"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// Notification rule, as returned by Rules.
+type RuleStatus struct {
+	Name     string     `json:"name"`
+	Metric   string     `json:"metric"`
+	Operator string     `json:"operator"`
+	Value    float64    `json:"value"`
+	State    string     `json:"state"`
+	Current  *float64   `json:"current"` // nil while the metric is unknown
+	Since    *time.Time `json:"since"`   // When the rule fired, nil when ok
+}
+
+// Rule that fired or recovered, sent to TypeEvents subscribers.
+type Event struct {
+	Rule      string    `json:"rule"`
+	State     string    `json:"state"`
+	Metric    string    `json:"metric"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Since     time.Time `json:"since"` // When the condition started or stopped holding
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Connected OCPP charge point, as returned by ChargePoints.
+type ChargePointStatus struct {
+	ID          string             `json:"id"`
+	Vendor      string             `json:"vendor"`
+	Model       string             `json:"model"`
+	ConnectedAt time.Time          `json:"connected_at"`
+	LastSeenAt  time.Time          `json:"last_seen_at"`
+	Connectors  []*ConnectorStatus `json:"connectors"`
+}
+
+type ConnectorStatus struct {
+	ConnectorID   int    `json:"connector_id"`
+	Status        string `json:"status"`
+	ErrorCode     string `json:"error_code"`
+	TransactionID *int   `json:"transaction_id"`
+	IdTag         string `json:"id_tag,omitempty"`
+	// From MeterValues, nil when the charge point does not report them
+	PowerW           *float64   `json:"power_w"`
+	EnergyWh         *float64   `json:"energy_wh"`
+	MeterValuesAt    *time.Time `json:"meter_values_at"`
+	ChargingLimit    *float64   `json:"charging_limit"`
+	ChargingRateUnit string     `json:"charging_rate_unit,omitempty"`
+}
@@ -0,0 +1,107 @@
+package interpreterclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/energybalance"
+	"github.com/NotCoffee418/european_smart_meter/pkg/energycost"
+	"github.com/NotCoffee418/european_smart_meter/pkg/loadcontrol"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+	"github.com/NotCoffee418/european_smart_meter/pkg/ocpp"
+	"github.com/NotCoffee418/european_smart_meter/pkg/rules"
+	"github.com/NotCoffee418/european_smart_meter/pkg/solarinverter"
+)
+
+// The client declares its own copies of the response types,
+// this keeps them in line with the types the API encodes.
+func TestTypesMatchServer(t *testing.T) {
+	tests := []struct {
+		server any
+		client any
+	}{
+		{&meterdb.MeterDbSolarProductionReading{}, &SolarReading{}},
+		{&energybalance.SolarHistory{}, &SolarHistory{}},
+		{&solarinverter.InverterSnapshot{}, &InverterSnapshot{}},
+		{&energycost.PeakStatus{}, &PeakStatus{}},
+		{&energycost.ContractPrice{}, &ContractPrice{}},
+		{&energycost.LiveCost{}, &LiveCost{}},
+		{&energycost.Bill{}, &Bill{}},
+		{&energybalance.LiveBalance{}, &LiveBalance{}},
+		{&energybalance.PeriodBalance{}, &PeriodBalance{}},
+		{&loadcontrol.Settings{}, &ControlSettings{}},
+		{&loadcontrol.Status{}, &ControlStatus{}},
+		{&rules.RuleStatus{}, &RuleStatus{}},
+		{&rules.Event{}, &Event{}},
+		{&ocpp.ChargePointStatus{}, &ChargePointStatus{}},
+	}
+
+	for _, test := range tests {
+		name := reflect.TypeOf(test.client).Elem().Name()
+		t.Run(name, func(t *testing.T) {
+			// Every field set, so none is left out of the encoding
+			fill(reflect.ValueOf(test.server).Elem())
+			encoded, err := json.Marshal(test.server)
+			if err != nil {
+				t.Fatalf("encoding %T: %v", test.server, err)
+			}
+
+			decoder := json.NewDecoder(bytes.NewReader(encoded))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(test.client); err != nil {
+				t.Fatalf("decoding %s into %T: %v", encoded, test.client, err)
+			}
+
+			// Fields only the client declares are caught by encoding it again
+			reencoded, err := json.Marshal(test.client)
+			if err != nil {
+				t.Fatalf("encoding %T: %v", test.client, err)
+			}
+			var want, got any
+			json.Unmarshal(encoded, &want)
+			json.Unmarshal(reencoded, &got)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("%T encodes as\n%s\nwant\n%s", test.client, reencoded, encoded)
+			}
+		})
+	}
+}
+
+// Set every field to a non-zero value, with one element in slices.
+func fill(v reflect.Value) {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Array:
+		for i := range v.Len() {
+			fill(v.Index(i))
+		}
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	}
+}
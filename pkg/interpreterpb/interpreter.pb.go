@@ -0,0 +1,643 @@
+// gRPC interface of the interpreter API, served next to the HTTP API when grpc_listen_port is set.
+// Regenerate with: protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative interpreter.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: interpreter.proto
+
+package interpreterpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetLatestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLatestRequest) Reset() {
+	*x = GetLatestRequest{}
+	mi := &file_interpreter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLatestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLatestRequest) ProtoMessage() {}
+
+func (x *GetLatestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_interpreter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLatestRequest.ProtoReflect.Descriptor instead.
+func (*GetLatestRequest) Descriptor() ([]byte, []int) {
+	return file_interpreter_proto_rawDescGZIP(), []int{0}
+}
+
+type StreamReadingsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Minimum seconds between readings, every reading when 0
+	IntervalSeconds float64 `protobuf:"fixed64,1,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+	// Only send readings in which a value changed by more than deadband
+	ChangeOnly bool    `protobuf:"varint,2,opt,name=change_only,json=changeOnly,proto3" json:"change_only,omitempty"`
+	Deadband   float64 `protobuf:"fixed64,3,opt,name=deadband,proto3" json:"deadband,omitempty"`
+	// Unix timestamp of the last reading received, the buffered readings after it are sent first
+	ResumeAfter   int64 `protobuf:"varint,4,opt,name=resume_after,json=resumeAfter,proto3" json:"resume_after,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamReadingsRequest) Reset() {
+	*x = StreamReadingsRequest{}
+	mi := &file_interpreter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamReadingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamReadingsRequest) ProtoMessage() {}
+
+func (x *StreamReadingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_interpreter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamReadingsRequest.ProtoReflect.Descriptor instead.
+func (*StreamReadingsRequest) Descriptor() ([]byte, []int) {
+	return file_interpreter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamReadingsRequest) GetIntervalSeconds() float64 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+func (x *StreamReadingsRequest) GetChangeOnly() bool {
+	if x != nil {
+		return x.ChangeOnly
+	}
+	return false
+}
+
+func (x *StreamReadingsRequest) GetDeadband() float64 {
+	if x != nil {
+		return x.Deadband
+	}
+	return 0
+}
+
+func (x *StreamReadingsRequest) GetResumeAfter() int64 {
+	if x != nil {
+		return x.ResumeAfter
+	}
+	return 0
+}
+
+// Reading from the P1 port, same fields as the JSON API.
+type Reading struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Meter local time, RFC 3339 labelled as UTC
+	Timestamp string `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Unix timestamp of the reading, for resume_after
+	Id                       int64   `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	CurrentConsumptionKw     float64 `protobuf:"fixed64,3,opt,name=current_consumption_kw,json=currentConsumptionKw,proto3" json:"current_consumption_kw,omitempty"`
+	CurrentProductionKw      float64 `protobuf:"fixed64,4,opt,name=current_production_kw,json=currentProductionKw,proto3" json:"current_production_kw,omitempty"`
+	L1ConsumptionKw          float64 `protobuf:"fixed64,5,opt,name=l1_consumption_kw,json=l1ConsumptionKw,proto3" json:"l1_consumption_kw,omitempty"`
+	L2ConsumptionKw          float64 `protobuf:"fixed64,6,opt,name=l2_consumption_kw,json=l2ConsumptionKw,proto3" json:"l2_consumption_kw,omitempty"`
+	L3ConsumptionKw          float64 `protobuf:"fixed64,7,opt,name=l3_consumption_kw,json=l3ConsumptionKw,proto3" json:"l3_consumption_kw,omitempty"`
+	L1ProductionKw           float64 `protobuf:"fixed64,8,opt,name=l1_production_kw,json=l1ProductionKw,proto3" json:"l1_production_kw,omitempty"`
+	L2ProductionKw           float64 `protobuf:"fixed64,9,opt,name=l2_production_kw,json=l2ProductionKw,proto3" json:"l2_production_kw,omitempty"`
+	L3ProductionKw           float64 `protobuf:"fixed64,10,opt,name=l3_production_kw,json=l3ProductionKw,proto3" json:"l3_production_kw,omitempty"`
+	TotalConsumptionDayKwh   float64 `protobuf:"fixed64,11,opt,name=total_consumption_day_kwh,json=totalConsumptionDayKwh,proto3" json:"total_consumption_day_kwh,omitempty"`
+	TotalConsumptionNightKwh float64 `protobuf:"fixed64,12,opt,name=total_consumption_night_kwh,json=totalConsumptionNightKwh,proto3" json:"total_consumption_night_kwh,omitempty"`
+	TotalProductionDayKwh    float64 `protobuf:"fixed64,13,opt,name=total_production_day_kwh,json=totalProductionDayKwh,proto3" json:"total_production_day_kwh,omitempty"`
+	TotalProductionNightKwh  float64 `protobuf:"fixed64,14,opt,name=total_production_night_kwh,json=totalProductionNightKwh,proto3" json:"total_production_night_kwh,omitempty"`
+	// 1 = day, 2 = night
+	CurrentTariff          int32   `protobuf:"varint,15,opt,name=current_tariff,json=currentTariff,proto3" json:"current_tariff,omitempty"`
+	L1VoltageV             float64 `protobuf:"fixed64,16,opt,name=l1_voltage_v,json=l1VoltageV,proto3" json:"l1_voltage_v,omitempty"`
+	L2VoltageV             float64 `protobuf:"fixed64,17,opt,name=l2_voltage_v,json=l2VoltageV,proto3" json:"l2_voltage_v,omitempty"`
+	L3VoltageV             float64 `protobuf:"fixed64,18,opt,name=l3_voltage_v,json=l3VoltageV,proto3" json:"l3_voltage_v,omitempty"`
+	L1CurrentA             float64 `protobuf:"fixed64,19,opt,name=l1_current_a,json=l1CurrentA,proto3" json:"l1_current_a,omitempty"`
+	L2CurrentA             float64 `protobuf:"fixed64,20,opt,name=l2_current_a,json=l2CurrentA,proto3" json:"l2_current_a,omitempty"`
+	L3CurrentA             float64 `protobuf:"fixed64,21,opt,name=l3_current_a,json=l3CurrentA,proto3" json:"l3_current_a,omitempty"`
+	SwitchElectricity      int32   `protobuf:"varint,22,opt,name=switch_electricity,json=switchElectricity,proto3" json:"switch_electricity,omitempty"`
+	SwitchGas              int32   `protobuf:"varint,23,opt,name=switch_gas,json=switchGas,proto3" json:"switch_gas,omitempty"`
+	MeterSerialElectricity string  `protobuf:"bytes,24,opt,name=meter_serial_electricity,json=meterSerialElectricity,proto3" json:"meter_serial_electricity,omitempty"`
+	MeterSerialGas         string  `protobuf:"bytes,25,opt,name=meter_serial_gas,json=meterSerialGas,proto3" json:"meter_serial_gas,omitempty"`
+	GasConsumptionM3       float64 `protobuf:"fixed64,26,opt,name=gas_consumption_m3,json=gasConsumptionM3,proto3" json:"gas_consumption_m3,omitempty"`
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *Reading) Reset() {
+	*x = Reading{}
+	mi := &file_interpreter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reading) ProtoMessage() {}
+
+func (x *Reading) ProtoReflect() protoreflect.Message {
+	mi := &file_interpreter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reading.ProtoReflect.Descriptor instead.
+func (*Reading) Descriptor() ([]byte, []int) {
+	return file_interpreter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Reading) GetTimestamp() string {
+	if x != nil {
+		return x.Timestamp
+	}
+	return ""
+}
+
+func (x *Reading) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Reading) GetCurrentConsumptionKw() float64 {
+	if x != nil {
+		return x.CurrentConsumptionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetCurrentProductionKw() float64 {
+	if x != nil {
+		return x.CurrentProductionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetL1ConsumptionKw() float64 {
+	if x != nil {
+		return x.L1ConsumptionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetL2ConsumptionKw() float64 {
+	if x != nil {
+		return x.L2ConsumptionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetL3ConsumptionKw() float64 {
+	if x != nil {
+		return x.L3ConsumptionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetL1ProductionKw() float64 {
+	if x != nil {
+		return x.L1ProductionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetL2ProductionKw() float64 {
+	if x != nil {
+		return x.L2ProductionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetL3ProductionKw() float64 {
+	if x != nil {
+		return x.L3ProductionKw
+	}
+	return 0
+}
+
+func (x *Reading) GetTotalConsumptionDayKwh() float64 {
+	if x != nil {
+		return x.TotalConsumptionDayKwh
+	}
+	return 0
+}
+
+func (x *Reading) GetTotalConsumptionNightKwh() float64 {
+	if x != nil {
+		return x.TotalConsumptionNightKwh
+	}
+	return 0
+}
+
+func (x *Reading) GetTotalProductionDayKwh() float64 {
+	if x != nil {
+		return x.TotalProductionDayKwh
+	}
+	return 0
+}
+
+func (x *Reading) GetTotalProductionNightKwh() float64 {
+	if x != nil {
+		return x.TotalProductionNightKwh
+	}
+	return 0
+}
+
+func (x *Reading) GetCurrentTariff() int32 {
+	if x != nil {
+		return x.CurrentTariff
+	}
+	return 0
+}
+
+func (x *Reading) GetL1VoltageV() float64 {
+	if x != nil {
+		return x.L1VoltageV
+	}
+	return 0
+}
+
+func (x *Reading) GetL2VoltageV() float64 {
+	if x != nil {
+		return x.L2VoltageV
+	}
+	return 0
+}
+
+func (x *Reading) GetL3VoltageV() float64 {
+	if x != nil {
+		return x.L3VoltageV
+	}
+	return 0
+}
+
+func (x *Reading) GetL1CurrentA() float64 {
+	if x != nil {
+		return x.L1CurrentA
+	}
+	return 0
+}
+
+func (x *Reading) GetL2CurrentA() float64 {
+	if x != nil {
+		return x.L2CurrentA
+	}
+	return 0
+}
+
+func (x *Reading) GetL3CurrentA() float64 {
+	if x != nil {
+		return x.L3CurrentA
+	}
+	return 0
+}
+
+func (x *Reading) GetSwitchElectricity() int32 {
+	if x != nil {
+		return x.SwitchElectricity
+	}
+	return 0
+}
+
+func (x *Reading) GetSwitchGas() int32 {
+	if x != nil {
+		return x.SwitchGas
+	}
+	return 0
+}
+
+func (x *Reading) GetMeterSerialElectricity() string {
+	if x != nil {
+		return x.MeterSerialElectricity
+	}
+	return ""
+}
+
+func (x *Reading) GetMeterSerialGas() string {
+	if x != nil {
+		return x.MeterSerialGas
+	}
+	return ""
+}
+
+func (x *Reading) GetGasConsumptionM3() float64 {
+	if x != nil {
+		return x.GasConsumptionM3
+	}
+	return 0
+}
+
+type GetSolarRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSolarRequest) Reset() {
+	*x = GetSolarRequest{}
+	mi := &file_interpreter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSolarRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSolarRequest) ProtoMessage() {}
+
+func (x *GetSolarRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_interpreter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSolarRequest.ProtoReflect.Descriptor instead.
+func (*GetSolarRequest) Descriptor() ([]byte, []int) {
+	return file_interpreter_proto_rawDescGZIP(), []int{3}
+}
+
+type Solar struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ActivePowerW    int32                  `protobuf:"varint,1,opt,name=active_power_w,json=activePowerW,proto3" json:"active_power_w,omitempty"`
+	DailyYieldWh    int64                  `protobuf:"varint,2,opt,name=daily_yield_wh,json=dailyYieldWh,proto3" json:"daily_yield_wh,omitempty"`
+	LifetimeYieldWh int64                  `protobuf:"varint,3,opt,name=lifetime_yield_wh,json=lifetimeYieldWh,proto3" json:"lifetime_yield_wh,omitempty"`
+	ReadAt          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=read_at,json=readAt,proto3" json:"read_at,omitempty"`
+	AgeSeconds      float64                `protobuf:"fixed64,5,opt,name=age_seconds,json=ageSeconds,proto3" json:"age_seconds,omitempty"`
+	// No successful read for three poll intervals
+	Stale bool `protobuf:"varint,6,opt,name=stale,proto3" json:"stale,omitempty"`
+	// Error of the most recent poll, empty when it succeeded
+	LastError        string `protobuf:"bytes,7,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	DeviceStatusText string `protobuf:"bytes,8,opt,name=device_status_text,json=deviceStatusText,proto3" json:"device_status_text,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Solar) Reset() {
+	*x = Solar{}
+	mi := &file_interpreter_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Solar) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Solar) ProtoMessage() {}
+
+func (x *Solar) ProtoReflect() protoreflect.Message {
+	mi := &file_interpreter_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Solar.ProtoReflect.Descriptor instead.
+func (*Solar) Descriptor() ([]byte, []int) {
+	return file_interpreter_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Solar) GetActivePowerW() int32 {
+	if x != nil {
+		return x.ActivePowerW
+	}
+	return 0
+}
+
+func (x *Solar) GetDailyYieldWh() int64 {
+	if x != nil {
+		return x.DailyYieldWh
+	}
+	return 0
+}
+
+func (x *Solar) GetLifetimeYieldWh() int64 {
+	if x != nil {
+		return x.LifetimeYieldWh
+	}
+	return 0
+}
+
+func (x *Solar) GetReadAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReadAt
+	}
+	return nil
+}
+
+func (x *Solar) GetAgeSeconds() float64 {
+	if x != nil {
+		return x.AgeSeconds
+	}
+	return 0
+}
+
+func (x *Solar) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+func (x *Solar) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *Solar) GetDeviceStatusText() string {
+	if x != nil {
+		return x.DeviceStatusText
+	}
+	return ""
+}
+
+var File_interpreter_proto protoreflect.FileDescriptor
+
+const file_interpreter_proto_rawDesc = "" +
+	"\n" +
+	"\x11interpreter.proto\x12#european_smart_meter.interpreter.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x12\n" +
+	"\x10GetLatestRequest\"\xa2\x01\n" +
+	"\x15StreamReadingsRequest\x12)\n" +
+	"\x10interval_seconds\x18\x01 \x01(\x01R\x0fintervalSeconds\x12\x1f\n" +
+	"\vchange_only\x18\x02 \x01(\bR\n" +
+	"changeOnly\x12\x1a\n" +
+	"\bdeadband\x18\x03 \x01(\x01R\bdeadband\x12!\n" +
+	"\fresume_after\x18\x04 \x01(\x03R\vresumeAfter\"\xe6\b\n" +
+	"\aReading\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\tR\ttimestamp\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\x124\n" +
+	"\x16current_consumption_kw\x18\x03 \x01(\x01R\x14currentConsumptionKw\x122\n" +
+	"\x15current_production_kw\x18\x04 \x01(\x01R\x13currentProductionKw\x12*\n" +
+	"\x11l1_consumption_kw\x18\x05 \x01(\x01R\x0fl1ConsumptionKw\x12*\n" +
+	"\x11l2_consumption_kw\x18\x06 \x01(\x01R\x0fl2ConsumptionKw\x12*\n" +
+	"\x11l3_consumption_kw\x18\a \x01(\x01R\x0fl3ConsumptionKw\x12(\n" +
+	"\x10l1_production_kw\x18\b \x01(\x01R\x0el1ProductionKw\x12(\n" +
+	"\x10l2_production_kw\x18\t \x01(\x01R\x0el2ProductionKw\x12(\n" +
+	"\x10l3_production_kw\x18\n" +
+	" \x01(\x01R\x0el3ProductionKw\x129\n" +
+	"\x19total_consumption_day_kwh\x18\v \x01(\x01R\x16totalConsumptionDayKwh\x12=\n" +
+	"\x1btotal_consumption_night_kwh\x18\f \x01(\x01R\x18totalConsumptionNightKwh\x127\n" +
+	"\x18total_production_day_kwh\x18\r \x01(\x01R\x15totalProductionDayKwh\x12;\n" +
+	"\x1atotal_production_night_kwh\x18\x0e \x01(\x01R\x17totalProductionNightKwh\x12%\n" +
+	"\x0ecurrent_tariff\x18\x0f \x01(\x05R\rcurrentTariff\x12 \n" +
+	"\fl1_voltage_v\x18\x10 \x01(\x01R\n" +
+	"l1VoltageV\x12 \n" +
+	"\fl2_voltage_v\x18\x11 \x01(\x01R\n" +
+	"l2VoltageV\x12 \n" +
+	"\fl3_voltage_v\x18\x12 \x01(\x01R\n" +
+	"l3VoltageV\x12 \n" +
+	"\fl1_current_a\x18\x13 \x01(\x01R\n" +
+	"l1CurrentA\x12 \n" +
+	"\fl2_current_a\x18\x14 \x01(\x01R\n" +
+	"l2CurrentA\x12 \n" +
+	"\fl3_current_a\x18\x15 \x01(\x01R\n" +
+	"l3CurrentA\x12-\n" +
+	"\x12switch_electricity\x18\x16 \x01(\x05R\x11switchElectricity\x12\x1d\n" +
+	"\n" +
+	"switch_gas\x18\x17 \x01(\x05R\tswitchGas\x128\n" +
+	"\x18meter_serial_electricity\x18\x18 \x01(\tR\x16meterSerialElectricity\x12(\n" +
+	"\x10meter_serial_gas\x18\x19 \x01(\tR\x0emeterSerialGas\x12,\n" +
+	"\x12gas_consumption_m3\x18\x1a \x01(\x01R\x10gasConsumptionM3\"\x11\n" +
+	"\x0fGetSolarRequest\"\xb8\x02\n" +
+	"\x05Solar\x12$\n" +
+	"\x0eactive_power_w\x18\x01 \x01(\x05R\factivePowerW\x12$\n" +
+	"\x0edaily_yield_wh\x18\x02 \x01(\x03R\fdailyYieldWh\x12*\n" +
+	"\x11lifetime_yield_wh\x18\x03 \x01(\x03R\x0flifetimeYieldWh\x123\n" +
+	"\aread_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x06readAt\x12\x1f\n" +
+	"\vage_seconds\x18\x05 \x01(\x01R\n" +
+	"ageSeconds\x12\x14\n" +
+	"\x05stale\x18\x06 \x01(\bR\x05stale\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\a \x01(\tR\tlastError\x12,\n" +
+	"\x12device_status_text\x18\b \x01(\tR\x10deviceStatusText2\xeb\x02\n" +
+	"\vInterpreter\x12p\n" +
+	"\tGetLatest\x125.european_smart_meter.interpreter.v1.GetLatestRequest\x1a,.european_smart_meter.interpreter.v1.Reading\x12|\n" +
+	"\x0eStreamReadings\x12:.european_smart_meter.interpreter.v1.StreamReadingsRequest\x1a,.european_smart_meter.interpreter.v1.Reading0\x01\x12l\n" +
+	"\bGetSolar\x124.european_smart_meter.interpreter.v1.GetSolarRequest\x1a*.european_smart_meter.interpreter.v1.SolarB@Z>github.com/NotCoffee418/european_smart_meter/pkg/interpreterpbb\x06proto3"
+
+var (
+	file_interpreter_proto_rawDescOnce sync.Once
+	file_interpreter_proto_rawDescData []byte
+)
+
+func file_interpreter_proto_rawDescGZIP() []byte {
+	file_interpreter_proto_rawDescOnce.Do(func() {
+		file_interpreter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_interpreter_proto_rawDesc), len(file_interpreter_proto_rawDesc)))
+	})
+	return file_interpreter_proto_rawDescData
+}
+
+var file_interpreter_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_interpreter_proto_goTypes = []any{
+	(*GetLatestRequest)(nil),      // 0: european_smart_meter.interpreter.v1.GetLatestRequest
+	(*StreamReadingsRequest)(nil), // 1: european_smart_meter.interpreter.v1.StreamReadingsRequest
+	(*Reading)(nil),               // 2: european_smart_meter.interpreter.v1.Reading
+	(*GetSolarRequest)(nil),       // 3: european_smart_meter.interpreter.v1.GetSolarRequest
+	(*Solar)(nil),                 // 4: european_smart_meter.interpreter.v1.Solar
+	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+}
+var file_interpreter_proto_depIdxs = []int32{
+	5, // 0: european_smart_meter.interpreter.v1.Solar.read_at:type_name -> google.protobuf.Timestamp
+	0, // 1: european_smart_meter.interpreter.v1.Interpreter.GetLatest:input_type -> european_smart_meter.interpreter.v1.GetLatestRequest
+	1, // 2: european_smart_meter.interpreter.v1.Interpreter.StreamReadings:input_type -> european_smart_meter.interpreter.v1.StreamReadingsRequest
+	3, // 3: european_smart_meter.interpreter.v1.Interpreter.GetSolar:input_type -> european_smart_meter.interpreter.v1.GetSolarRequest
+	2, // 4: european_smart_meter.interpreter.v1.Interpreter.GetLatest:output_type -> european_smart_meter.interpreter.v1.Reading
+	2, // 5: european_smart_meter.interpreter.v1.Interpreter.StreamReadings:output_type -> european_smart_meter.interpreter.v1.Reading
+	4, // 6: european_smart_meter.interpreter.v1.Interpreter.GetSolar:output_type -> european_smart_meter.interpreter.v1.Solar
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_interpreter_proto_init() }
+func file_interpreter_proto_init() {
+	if File_interpreter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_interpreter_proto_rawDesc), len(file_interpreter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_interpreter_proto_goTypes,
+		DependencyIndexes: file_interpreter_proto_depIdxs,
+		MessageInfos:      file_interpreter_proto_msgTypes,
+	}.Build()
+	File_interpreter_proto = out.File
+	file_interpreter_proto_goTypes = nil
+	file_interpreter_proto_depIdxs = nil
+}
@@ -0,0 +1,210 @@
+// gRPC interface of the interpreter API, served next to the HTTP API when grpc_listen_port is set.
+// Regenerate with: protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative interpreter.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: interpreter.proto
+
+package interpreterpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Interpreter_GetLatest_FullMethodName      = "/european_smart_meter.interpreter.v1.Interpreter/GetLatest"
+	Interpreter_StreamReadings_FullMethodName = "/european_smart_meter.interpreter.v1.Interpreter/StreamReadings"
+	Interpreter_GetSolar_FullMethodName       = "/european_smart_meter.interpreter.v1.Interpreter/GetSolar"
+)
+
+// InterpreterClient is the client API for Interpreter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InterpreterClient interface {
+	// Latest reading from the smart meter, NOT_FOUND before the first reading.
+	GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*Reading, error)
+	// Live readings as they arrive, the same stream as /ws and /events.
+	StreamReadings(ctx context.Context, in *StreamReadingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Reading], error)
+	// Latest solar inverter read, UNAVAILABLE when no inverter is configured or read yet.
+	GetSolar(ctx context.Context, in *GetSolarRequest, opts ...grpc.CallOption) (*Solar, error)
+}
+
+type interpreterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInterpreterClient(cc grpc.ClientConnInterface) InterpreterClient {
+	return &interpreterClient{cc}
+}
+
+func (c *interpreterClient) GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*Reading, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reading)
+	err := c.cc.Invoke(ctx, Interpreter_GetLatest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *interpreterClient) StreamReadings(ctx context.Context, in *StreamReadingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Reading], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Interpreter_ServiceDesc.Streams[0], Interpreter_StreamReadings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamReadingsRequest, Reading]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Interpreter_StreamReadingsClient = grpc.ServerStreamingClient[Reading]
+
+func (c *interpreterClient) GetSolar(ctx context.Context, in *GetSolarRequest, opts ...grpc.CallOption) (*Solar, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Solar)
+	err := c.cc.Invoke(ctx, Interpreter_GetSolar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InterpreterServer is the server API for Interpreter service.
+// All implementations must embed UnimplementedInterpreterServer
+// for forward compatibility.
+type InterpreterServer interface {
+	// Latest reading from the smart meter, NOT_FOUND before the first reading.
+	GetLatest(context.Context, *GetLatestRequest) (*Reading, error)
+	// Live readings as they arrive, the same stream as /ws and /events.
+	StreamReadings(*StreamReadingsRequest, grpc.ServerStreamingServer[Reading]) error
+	// Latest solar inverter read, UNAVAILABLE when no inverter is configured or read yet.
+	GetSolar(context.Context, *GetSolarRequest) (*Solar, error)
+	mustEmbedUnimplementedInterpreterServer()
+}
+
+// UnimplementedInterpreterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedInterpreterServer struct{}
+
+func (UnimplementedInterpreterServer) GetLatest(context.Context, *GetLatestRequest) (*Reading, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatest not implemented")
+}
+func (UnimplementedInterpreterServer) StreamReadings(*StreamReadingsRequest, grpc.ServerStreamingServer[Reading]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamReadings not implemented")
+}
+func (UnimplementedInterpreterServer) GetSolar(context.Context, *GetSolarRequest) (*Solar, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSolar not implemented")
+}
+func (UnimplementedInterpreterServer) mustEmbedUnimplementedInterpreterServer() {}
+func (UnimplementedInterpreterServer) testEmbeddedByValue()                     {}
+
+// UnsafeInterpreterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InterpreterServer will
+// result in compilation errors.
+type UnsafeInterpreterServer interface {
+	mustEmbedUnimplementedInterpreterServer()
+}
+
+func RegisterInterpreterServer(s grpc.ServiceRegistrar, srv InterpreterServer) {
+	// If the following call pancis, it indicates UnimplementedInterpreterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Interpreter_ServiceDesc, srv)
+}
+
+func _Interpreter_GetLatest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InterpreterServer).GetLatest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Interpreter_GetLatest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InterpreterServer).GetLatest(ctx, req.(*GetLatestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Interpreter_StreamReadings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamReadingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InterpreterServer).StreamReadings(m, &grpc.GenericServerStream[StreamReadingsRequest, Reading]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Interpreter_StreamReadingsServer = grpc.ServerStreamingServer[Reading]
+
+func _Interpreter_GetSolar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSolarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InterpreterServer).GetSolar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Interpreter_GetSolar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InterpreterServer).GetSolar(ctx, req.(*GetSolarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Interpreter_ServiceDesc is the grpc.ServiceDesc for Interpreter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Interpreter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "european_smart_meter.interpreter.v1.Interpreter",
+	HandlerType: (*InterpreterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLatest",
+			Handler:    _Interpreter_GetLatest_Handler,
+		},
+		{
+			MethodName: "GetSolar",
+			Handler:    _Interpreter_GetSolar_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamReadings",
+			Handler:       _Interpreter_StreamReadings_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "interpreter.proto",
+}
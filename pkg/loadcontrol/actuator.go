@@ -0,0 +1,276 @@
+package loadcontrol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/ocpp"
+	"github.com/goburrow/modbus"
+)
+
+const (
+	ActuatorSimulated = "simulated"
+	ActuatorModbus    = "modbus"
+	ActuatorHTTP      = "http"
+	ActuatorOCPP      = "ocpp"
+)
+
+var ErrUnknownActuator = fmt.Errorf("unknown actuator type")
+
+// A device whose power can be set, eg. a home battery or EV charger.
+type Actuator interface {
+	// Set the power in watts, positive to consume (charge) and negative to discharge.
+	SetPower(watt float64) error
+}
+
+// Actuators that measure their own power, eg. a charger reporting meter values.
+// The controller uses the measured power instead of assuming the device follows the setpoint,
+// which matters for cars that charge slower than allowed.
+type PowerMeter interface {
+	MeasuredPowerW() (float64, bool)
+}
+
+// Create the actuator selected in the load control config.
+// chargePoints is only used by the ocpp actuator and may be nil otherwise.
+func NewActuator(cfg *config.ActuatorConfig, chargePoints ChargePoints) (Actuator, error) {
+	switch cfg.Type {
+	case ActuatorSimulated, "":
+		return &SimulatedActuator{}, nil
+	case ActuatorModbus:
+		return NewModbusActuator(cfg)
+	case ActuatorHTTP:
+		if cfg.HTTPURL == "" {
+			return nil, fmt.Errorf("http actuator needs http_url")
+		}
+		return &HTTPActuator{
+			Method:      cfg.HTTPMethod,
+			URL:         cfg.HTTPURL,
+			Body:        cfg.HTTPBody,
+			ContentType: cfg.HTTPContentType,
+		}, nil
+	case ActuatorOCPP:
+		if chargePoints == nil {
+			return nil, fmt.Errorf("ocpp actuator needs the OCPP central system, enable it in interpreter_api.toml")
+		}
+		if cfg.OCPPChargingRateUnit != ocpp.ChargingRateUnitW && cfg.OCPPChargingRateUnit != ocpp.ChargingRateUnitA {
+			return nil, fmt.Errorf("unknown charging rate unit %q", cfg.OCPPChargingRateUnit)
+		}
+		return &OCPPActuator{
+			ChargePoints:  chargePoints,
+			ChargePointID: cfg.OCPPChargePointID,
+			ConnectorID:   cfg.OCPPConnectorID,
+			RateUnit:      cfg.OCPPChargingRateUnit,
+			Phases:        cfg.OCPPPhases,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownActuator, cfg.Type)
+}
+
+// Only remembers and logs the setpoint, for trying out modes without hardware.
+type SimulatedActuator struct {
+	mutex     sync.Mutex
+	setpointW float64
+	updates   int
+}
+
+func (s *SimulatedActuator) SetPower(watt float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.setpointW = watt
+	s.updates++
+	log.Printf("Simulated actuator set to %.0f W", watt)
+	return nil
+}
+
+// Last setpoint and the number of times it was set.
+func (s *SimulatedActuator) Setpoint() (float64, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.setpointW, s.updates
+}
+
+// Writes the setpoint to a holding register over Modbus TCP,
+// eg. the power setpoint of a battery inverter or the current limit of a wallbox.
+type ModbusActuator struct {
+	address      string
+	slaveID      byte
+	register     uint16
+	registerType string
+	scale        float64
+}
+
+func NewModbusActuator(cfg *config.ActuatorConfig) (*ModbusActuator, error) {
+	if cfg.ModbusAddress == "" {
+		return nil, fmt.Errorf("modbus actuator needs modbus_address")
+	}
+	switch cfg.ModbusRegisterType {
+	case "int16", "uint16", "int32", "uint32":
+	default:
+		return nil, fmt.Errorf("unknown modbus register type %q", cfg.ModbusRegisterType)
+	}
+	scale := cfg.ModbusScale
+	if scale == 0 {
+		scale = 1
+	}
+	return &ModbusActuator{
+		address:      cfg.ModbusAddress,
+		slaveID:      byte(cfg.ModbusSlaveID),
+		register:     uint16(cfg.ModbusRegister),
+		registerType: cfg.ModbusRegisterType,
+		scale:        scale,
+	}, nil
+}
+
+func (m *ModbusActuator) SetPower(watt float64) error {
+	data := m.encode(watt)
+
+	handler := modbus.NewTCPClientHandler(m.address)
+	handler.SlaveId = m.slaveID
+	handler.Timeout = 5 * time.Second
+	if err := handler.Connect(); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer handler.Close()
+
+	client := modbus.NewClient(handler)
+	if _, err := client.WriteMultipleRegisters(m.register, uint16(len(data)/2), data); err != nil {
+		return fmt.Errorf("write register %d: %w", m.register, err)
+	}
+	return nil
+}
+
+// Scaled register value, clamped to the range of the register type.
+func (m *ModbusActuator) encode(watt float64) []byte {
+	value := math.Round(watt * m.scale)
+	switch m.registerType {
+	case "int16":
+		return binary.BigEndian.AppendUint16(nil, uint16(int16(clamp(value, math.MinInt16, math.MaxInt16))))
+	case "uint16":
+		return binary.BigEndian.AppendUint16(nil, uint16(clamp(value, 0, math.MaxUint16)))
+	case "int32":
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(clamp(value, math.MinInt32, math.MaxInt32))))
+	default:
+		return binary.BigEndian.AppendUint32(nil, uint32(clamp(value, 0, math.MaxUint32)))
+	}
+}
+
+// Sends the setpoint in an HTTP request, eg. to a wallbox or home automation webhook.
+// {power_w} and {power_kw} in the URL and body are replaced by the setpoint.
+type HTTPActuator struct {
+	Method      string
+	URL         string
+	Body        string
+	ContentType string
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func (h *HTTPActuator) SetPower(watt float64) error {
+	replacer := strings.NewReplacer(
+		"{power_w}", strconv.FormatFloat(math.Round(watt), 'f', -1, 64),
+		"{power_kw}", strconv.FormatFloat(math.Round(watt)/1000, 'f', -1, 64),
+	)
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body io.Reader
+	if h.Body != "" && method != http.MethodGet {
+		body = bytes.NewBufferString(replacer.Replace(h.Body))
+	}
+	req, err := http.NewRequest(method, replacer.Replace(h.URL), body)
+	if err != nil {
+		return err
+	}
+	if body != nil && h.ContentType != "" {
+		req.Header.Set("Content-Type", h.ContentType)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sends OCPP 1.6 requests to connected charge points, eg. ocpp.CentralSystem.
+// An empty id selects the only connected charge point.
+type ChargePoints interface {
+	SetChargingProfile(id string, request *ocpp.SetChargingProfileRequest) (*ocpp.SetChargingProfileResponse, error)
+	ConnectorPowerW(id string, connectorID int, maxAge time.Duration) (float64, bool)
+}
+
+// Limits an EV charger with an OCPP 1.6 TxDefaultProfile.
+// Chargers limited in amps get the setpoint divided over the phases at 230 V.
+type OCPPActuator struct {
+	ChargePoints  ChargePoints
+	ChargePointID string
+	ConnectorID   int    // 0 for the whole charge point
+	RateUnit      string // ocpp.ChargingRateUnitW or ocpp.ChargingRateUnitA
+	Phases        int
+}
+
+// Profile id and stack level of the profile sent by the load controller.
+const (
+	ocppChargingProfileID = 1
+	ocppStackLevel        = 1
+
+	// Chargers usually send meter values every 10 to 60 seconds
+	ocppMaxMeterValueAge = 2 * time.Minute
+)
+
+func (o *OCPPActuator) SetPower(watt float64) error {
+	phases := max(o.Phases, 1)
+	limit := math.Max(watt, 0)
+	if o.RateUnit == ocpp.ChargingRateUnitA {
+		limit /= 230 * float64(phases)
+	}
+
+	response, err := o.ChargePoints.SetChargingProfile(o.ChargePointID, &ocpp.SetChargingProfileRequest{
+		ConnectorID: o.ConnectorID,
+		CSChargingProfiles: ocpp.ChargingProfile{
+			ChargingProfileID:      ocppChargingProfileID,
+			StackLevel:             ocppStackLevel,
+			ChargingProfilePurpose: ocpp.ChargingProfilePurposeTxDefault,
+			ChargingProfileKind:    ocpp.ChargingProfileKindRelative,
+			ChargingSchedule: ocpp.ChargingSchedule{
+				ChargingRateUnit: o.RateUnit,
+				ChargingSchedulePeriod: []ocpp.ChargingSchedulePeriod{{
+					StartPeriod:  0,
+					Limit:        math.Floor(limit*10) / 10,
+					NumberPhases: &phases,
+				}},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if response.Status != ocpp.ChargingProfileStatusAccepted {
+		return fmt.Errorf("charging profile %s", strings.ToLower(response.Status))
+	}
+	return nil
+}
+
+func (o *OCPPActuator) MeasuredPowerW() (float64, bool) {
+	return o.ChargePoints.ConnectorPowerW(o.ChargePointID, o.ConnectorID, ocppMaxMeterValueAge)
+}
+
+func clamp(value, low, high float64) float64 {
+	return math.Max(low, math.Min(high, value))
+}
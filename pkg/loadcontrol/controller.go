@@ -0,0 +1,341 @@
+// Control of a home battery or EV charger by the net grid power measured by the P1 meter.
+//
+// Every interval the controller estimates the grid power without the device,
+// by subtracting the last setpoint (or the power the device reports) from the measured net power,
+// and picks the setpoint that brings the grid power to the target of the mode.
+package loadcontrol
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/dayahead"
+	"github.com/NotCoffee418/european_smart_meter/pkg/energycost"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/meterdb"
+)
+
+const (
+	// Absorb export above the export limit, never discharges
+	ModeZeroExport = "zero_export"
+	// Consume all solar surplus once it reaches the start power, eg. EV charging
+	ModeSolarSurplus = "solar_surplus"
+	// Keep import below the peak limit, charging with the remaining headroom.
+	// With the peak limit following the capacity tariff, this charges from surplus
+	// and from the grid up to the peak that is already billed this month.
+	ModePeakShaving = "peak_shaving"
+)
+
+var ErrUnknownMode = fmt.Errorf("unknown load control mode")
+
+// Settings that can be changed while running, nil fields are left unchanged.
+type Settings struct {
+	Mode         *string  `json:"mode"`
+	MinPowerW    *float64 `json:"min_power_w"`
+	MaxPowerW    *float64 `json:"max_power_w"`
+	HysteresisW  *float64 `json:"hysteresis_w"`
+	ExportLimitW *float64 `json:"export_limit_w"`
+	StartPowerW  *float64 `json:"start_power_w"`
+	PeakLimitW   *float64 `json:"peak_limit_w"`
+
+	PeakLimitFromCapacityTariff *bool `json:"peak_limit_from_capacity_tariff"`
+}
+
+type Status struct {
+	Mode         string  `json:"mode"`
+	MinPowerW    float64 `json:"min_power_w"`
+	MaxPowerW    float64 `json:"max_power_w"`
+	HysteresisW  float64 `json:"hysteresis_w"`
+	ExportLimitW float64 `json:"export_limit_w"`
+	StartPowerW  float64 `json:"start_power_w"`
+	PeakLimitW   float64 `json:"peak_limit_w"`
+
+	PeakLimitFromCapacityTariff bool `json:"peak_limit_from_capacity_tariff"`
+	// Highest 15 minute import of this month, when the peak limit follows the capacity tariff
+	CapacityPeakW float64 `json:"capacity_peak_w"`
+
+	// Measured grid power, positive when importing
+	GridPowerW float64 `json:"grid_power_w"`
+	// Last setpoint sent to the device
+	SetpointW float64 `json:"setpoint_w"`
+	// Power reported by the device itself, nil when it does not measure it
+	DevicePowerW *float64 `json:"device_power_w"`
+	// nil until the device was set for the first time
+	SetpointAt *time.Time `json:"setpoint_at"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+type Controller struct {
+	mutex    sync.Mutex
+	cfg      config.LoadControlConfig
+	actuator Actuator
+
+	reading    *interpreter.RawMeterReading
+	receivedAt time.Time
+
+	setpointW  float64
+	setpointAt time.Time
+	lastError  error
+
+	// Measured by the device, when it implements PowerMeter
+	devicePowerW *float64
+
+	capacityPeakW         float64
+	capacityPeakUpdatedAt time.Time
+}
+
+// The capacity tariff peak only changes at the end of a quarter hour
+const capacityPeakRefreshInterval = 15 * time.Minute
+
+func NewController(cfg *config.LoadControlConfig, actuator Actuator) (*Controller, error) {
+	if err := validateMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+	if err := validateLimits(cfg); err != nil {
+		return nil, err
+	}
+	return &Controller{cfg: *cfg, actuator: actuator}, nil
+}
+
+// Hand the controller every new reading, the latest is used on the next step.
+func (c *Controller) HandleReading(reading *interpreter.RawMeterReading) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reading = reading
+	c.receivedAt = time.Now()
+}
+
+// Step every interval until the process exits.
+func (c *Controller) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		c.Step(now)
+	}
+}
+
+// Calculate the setpoint from the latest reading and send it when it changed enough.
+func (c *Controller) Step(now time.Time) {
+	// Both may block on IO, so they are read before taking the lock
+	c.refreshCapacityPeak(now)
+	var devicePowerW *float64
+	if meter, ok := c.actuator.(PowerMeter); ok {
+		if powerW, ok := meter.MeasuredPowerW(); ok {
+			devicePowerW = &powerW
+		}
+	}
+
+	c.mutex.Lock()
+	c.devicePowerW = devicePowerW
+	previous := c.setpointW
+	var setpoint float64
+	maxAge := time.Duration(c.cfg.MaxReadingAgeSeconds) * time.Second
+	if c.reading != nil && (maxAge <= 0 || now.Sub(c.receivedAt) <= maxAge) {
+		setpoint = c.target(gridPowerW(c.reading))
+	}
+	// A device that was never set is set once, so it starts from a known state
+	send := c.setpointAt.IsZero() || c.lastError != nil || c.shouldSend(previous, setpoint)
+	c.mutex.Unlock()
+	if !send {
+		return
+	}
+
+	// Devices may take a while to respond, the lock is not held meanwhile
+	err := c.actuator.SetPower(setpoint)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		if c.lastError == nil {
+			log.Printf("Failed to set load control setpoint: %v", err)
+		}
+		c.lastError = err
+		return
+	}
+	if c.lastError != nil {
+		log.Println("Load control setpoint set again")
+	}
+	c.lastError = nil
+	c.setpointW = setpoint
+	c.setpointAt = now
+}
+
+// Setpoint for the measured grid power, clamped to the limits of the mode.
+func (c *Controller) target(gridW float64) float64 {
+	// Grid power if the device were off, assuming it follows the last setpoint unless it measures itself
+	deviceW := c.setpointW
+	if c.devicePowerW != nil {
+		deviceW = *c.devicePowerW
+	}
+	withoutDeviceW := gridW - deviceW
+
+	switch c.cfg.Mode {
+	case ModeZeroExport:
+		desired := -c.cfg.ExportLimitW - withoutDeviceW
+		return clamp(desired, math.Max(c.cfg.MinPowerW, 0), c.cfg.MaxPowerW)
+
+	case ModeSolarSurplus:
+		surplus := -withoutDeviceW
+		start := math.Max(c.cfg.StartPowerW, c.cfg.MinPowerW)
+		// Keep running at the start power while the surplus stays within the hysteresis
+		running := c.setpointW > 0
+		if surplus >= start {
+			return clamp(surplus, math.Max(c.cfg.MinPowerW, 0), c.cfg.MaxPowerW)
+		}
+		if running && surplus >= start-c.cfg.HysteresisW {
+			return math.Min(start, c.cfg.MaxPowerW)
+		}
+		return 0
+
+	case ModePeakShaving:
+		desired := c.peakLimitW() - withoutDeviceW
+		return clamp(desired, c.cfg.MinPowerW, c.cfg.MaxPowerW)
+	}
+	return 0
+}
+
+// Changes within the hysteresis are not sent, starting and stopping always is.
+func (c *Controller) shouldSend(previous, next float64) bool {
+	if (previous == 0) != (next == 0) {
+		return true
+	}
+	// Reaching a limit always gets sent, so the device does not stop just short of it
+	if next != previous && (next == c.cfg.MinPowerW || next == c.cfg.MaxPowerW) {
+		return true
+	}
+	return math.Abs(next-previous) >= c.cfg.HysteresisW
+}
+
+// Change the mode or limits, the next step uses the new settings.
+func (c *Controller) Update(settings *Settings) error {
+	if settings.Mode != nil {
+		if err := validateMode(*settings.Mode); err != nil {
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cfg := c.cfg
+	set := func(target *float64, value *float64) {
+		if value != nil {
+			*target = *value
+		}
+	}
+	if settings.Mode != nil {
+		cfg.Mode = *settings.Mode
+	}
+	set(&cfg.MinPowerW, settings.MinPowerW)
+	set(&cfg.MaxPowerW, settings.MaxPowerW)
+	set(&cfg.HysteresisW, settings.HysteresisW)
+	set(&cfg.ExportLimitW, settings.ExportLimitW)
+	set(&cfg.StartPowerW, settings.StartPowerW)
+	set(&cfg.PeakLimitW, settings.PeakLimitW)
+	if settings.PeakLimitFromCapacityTariff != nil {
+		cfg.PeakLimitFromCapacityTariff = *settings.PeakLimitFromCapacityTariff
+		// Refreshed on the next step
+		c.capacityPeakUpdatedAt = time.Time{}
+	}
+	if err := validateLimits(&cfg); err != nil {
+		return err
+	}
+	c.cfg = cfg
+	return nil
+}
+
+func (c *Controller) Status() *Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status := &Status{
+		Mode:         c.cfg.Mode,
+		MinPowerW:    c.cfg.MinPowerW,
+		MaxPowerW:    c.cfg.MaxPowerW,
+		HysteresisW:  c.cfg.HysteresisW,
+		ExportLimitW: c.cfg.ExportLimitW,
+		StartPowerW:  c.cfg.StartPowerW,
+		PeakLimitW:   c.cfg.PeakLimitW,
+		SetpointW:    c.setpointW,
+		DevicePowerW: c.devicePowerW,
+
+		PeakLimitFromCapacityTariff: c.cfg.PeakLimitFromCapacityTariff,
+		CapacityPeakW:               c.capacityPeakW,
+	}
+	if c.reading != nil {
+		status.GridPowerW = gridPowerW(c.reading)
+	}
+	if !c.setpointAt.IsZero() {
+		setpointAt := c.setpointAt
+		status.SetpointAt = &setpointAt
+	}
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	return status
+}
+
+// Peak limit, raised to the capacity tariff peak when enabled.
+// Must be called with the mutex held.
+func (c *Controller) peakLimitW() float64 {
+	if c.cfg.PeakLimitFromCapacityTariff {
+		return math.Max(c.cfg.PeakLimitW, c.capacityPeakW)
+	}
+	return c.cfg.PeakLimitW
+}
+
+// Look up the highest 15 minute import of the current month,
+// at least the capacity tariff minimum since that is billed regardless.
+func (c *Controller) refreshCapacityPeak(now time.Time) {
+	c.mutex.Lock()
+	if !c.cfg.PeakLimitFromCapacityTariff || now.Sub(c.capacityPeakUpdatedAt) < capacityPeakRefreshInterval {
+		c.mutex.Unlock()
+		return
+	}
+	c.capacityPeakUpdatedAt = now
+	meterID := ""
+	if c.reading != nil {
+		meterID = c.reading.MeterSerialElectricity
+	}
+	c.mutex.Unlock()
+
+	// Peaks are only looked up for a known meter, combined meters are not billed together
+	peakW := config.ActiveTariffConfig.Electricity.CapacityMinimumKW * 1000
+	if meterID != "" && meterdb.IsAvailable() {
+		meterNow := dayahead.LocalAsUTC(now, dayahead.LoadLocation(config.ActiveTariffConfig.Timezone))
+		monthPeakW, err := energycost.MonthPeakW(meterID, meterNow)
+		if err != nil {
+			log.Printf("Failed to read capacity tariff peak: %v", err)
+		}
+		peakW = math.Max(peakW, monthPeakW)
+	}
+
+	c.mutex.Lock()
+	c.capacityPeakW = peakW
+	c.mutex.Unlock()
+}
+
+// Net power from the grid in watts, negative when exporting.
+func gridPowerW(reading *interpreter.RawMeterReading) float64 {
+	return math.Round((reading.CurrentConsumptionKW - reading.CurrentProductionKW) * 1000)
+}
+
+func validateLimits(cfg *config.LoadControlConfig) error {
+	if cfg.MinPowerW > cfg.MaxPowerW {
+		return fmt.Errorf("min_power_w %.0f is above max_power_w %.0f", cfg.MinPowerW, cfg.MaxPowerW)
+	}
+	if cfg.HysteresisW < 0 {
+		return fmt.Errorf("hysteresis_w can not be negative")
+	}
+	return nil
+}
+
+func validateMode(mode string) error {
+	switch mode {
+	case ModeZeroExport, ModeSolarSurplus, ModePeakShaving:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownMode, mode)
+}
@@ -0,0 +1,102 @@
+package loadcontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+// Reading with the given net grid power, negative when exporting.
+func gridReading(gridW float64) *interpreter.RawMeterReading {
+	if gridW < 0 {
+		return &interpreter.RawMeterReading{CurrentProductionKW: -gridW / 1000}
+	}
+	return &interpreter.RawMeterReading{CurrentConsumptionKW: gridW / 1000}
+}
+
+func TestControllerZeroExport(t *testing.T) {
+	actuator := &SimulatedActuator{}
+	controller, err := NewController(&config.LoadControlConfig{
+		Mode:                 ModeZeroExport,
+		MaxPowerW:            3000,
+		HysteresisW:          50,
+		MaxReadingAgeSeconds: 10,
+	}, actuator)
+	if err != nil {
+		t.Fatalf("NewController: %v", err)
+	}
+
+	now := time.Now()
+	steps := []struct {
+		gridW     float64
+		wantW     float64
+		wantSends int
+	}{
+		// Absorbs the export
+		{-2000, 2000, 1},
+		// The device draws 2000 W, another 100 W is exported
+		{-100, 2100, 2},
+		// Within the hysteresis, not sent
+		{20, 2100, 2},
+		// Export above the max power, clamped
+		{-1500, 3000, 3},
+	}
+	for i, step := range steps {
+		controller.HandleReading(gridReading(step.gridW))
+		controller.Step(now)
+		setpointW, sends := actuator.Setpoint()
+		if setpointW != step.wantW || sends != step.wantSends {
+			t.Errorf("step %d: setpoint %.0f W after %d sends, want %.0f W after %d", i, setpointW, sends, step.wantW, step.wantSends)
+		}
+	}
+
+	// Without recent readings the device is switched off
+	controller.Step(now.Add(time.Minute))
+	if setpointW, _ := actuator.Setpoint(); setpointW != 0 {
+		t.Errorf("setpoint %.0f W with a stale reading, want 0", setpointW)
+	}
+}
+
+func TestControllerSolarSurplusHysteresis(t *testing.T) {
+	actuator := &SimulatedActuator{}
+	controller, err := NewController(&config.LoadControlConfig{
+		Mode:        ModeSolarSurplus,
+		MinPowerW:   1380,
+		MaxPowerW:   7400,
+		HysteresisW: 300,
+		StartPowerW: 1380,
+	}, actuator)
+	if err != nil {
+		t.Fatalf("NewController: %v", err)
+	}
+
+	now := time.Now()
+	for i, step := range []struct{ gridW, wantW float64 }{
+		// Not enough surplus to start
+		{-1000, 0},
+		{-1500, 1500},
+		// Surplus dropped to 1200 W, within the hysteresis of the start power
+		{300, 1380},
+		// Surplus dropped to 1000 W, stops
+		{380, 0},
+	} {
+		controller.HandleReading(gridReading(step.gridW))
+		controller.Step(now)
+		if setpointW, _ := actuator.Setpoint(); setpointW != step.wantW {
+			t.Errorf("step %d: setpoint %.0f W, want %.0f W", i, setpointW, step.wantW)
+		}
+	}
+}
+
+func TestNewControllerRejectsInvalidLimits(t *testing.T) {
+	_, err := NewController(&config.LoadControlConfig{Mode: ModeZeroExport, MinPowerW: 2000, MaxPowerW: 1000}, &SimulatedActuator{})
+	if err == nil {
+		t.Error("min_power_w above max_power_w was accepted")
+	}
+	_, err = NewController(&config.LoadControlConfig{Mode: ModeZeroExport, MaxPowerW: 1000, HysteresisW: -1}, &SimulatedActuator{})
+	if err == nil {
+		t.Error("negative hysteresis_w was accepted")
+	}
+}
@@ -0,0 +1,277 @@
+// Minimal mDNS responder (RFC 6762) advertising DNS-SD services over IPv4,
+// so devices on the local network discover our services like those of real devices.
+// Only the records of the configured services are answered, there is no probing for conflicts.
+package mdns
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	port = 5353
+	// Unicast response bit of questions and cache flush bit of unique records share the top bit of the class
+	classTopBit = 0x8000
+
+	// TTLs recommended by RFC 6762 for records with and without host names or addresses
+	hostTTL  = 120
+	otherTTL = 4500
+
+	// Services are announced this often when starting, a second apart
+	announceCount = 2
+)
+
+var groupAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: port}
+
+// DNS-SD service, advertised as Instance.Type.local on Host.local.
+type Service struct {
+	Instance string   // eg. p1meter-aabbcc
+	Type     string   // eg. _hwenergy._tcp
+	Host     string   // Without .local
+	Port     int      // Port of the service itself
+	TXT      []string // key=value pairs
+}
+
+func (s *Service) typeName() string     { return s.Type + ".local." }
+func (s *Service) instanceName() string { return s.Instance + "." + s.typeName() }
+func (s *Service) hostName() string     { return s.Host + ".local." }
+
+type Responder struct {
+	services []*Service
+	// Address the services listen on, nil when they listen on all addresses
+	address net.IP
+	conn    *net.UDPConn
+}
+
+// Responder for services listening on address, which is only advertised when it is a specific
+// IPv4 address. Empty, unspecified or unparsable addresses advertise the addresses of every interface,
+// loopback addresses are not advertised since other hosts cannot reach them.
+func NewResponder(address string, services ...*Service) *Responder {
+	responder := &Responder{services: services}
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil && address != "":
+		log.Printf("mDNS cannot advertise listen address %q, it is not an IP address, advertising the addresses of every interface", address)
+	case ip != nil && ip.IsLoopback():
+		log.Printf("mDNS does not advertise loopback listen address %s, other hosts cannot reach it", ip)
+		responder.address = ip
+	case ip != nil && !ip.IsUnspecified():
+		responder.address = ip
+	}
+	return responder
+}
+
+// Announce the services and answer queries until the socket fails.
+func (r *Responder) Run() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r.conn = conn
+
+	go r.announce()
+
+	buffer := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return err
+		}
+		r.handlePacket(buffer[:n], from)
+	}
+}
+
+// Unsolicited response with all records of every service.
+func (r *Responder) announce() {
+	var answers []dnsmessage.Resource
+	announcedHosts := map[string]bool{}
+	for _, service := range r.services {
+		answers = append(answers, r.serviceRecords(service)...)
+		if !announcedHosts[service.Host] {
+			announcedHosts[service.Host] = true
+			answers = append(answers, r.addressRecords(service)...)
+		}
+	}
+	for i := range announceCount {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		r.send(&dnsmessage.Message{
+			Header:  dnsmessage.Header{Response: true, Authoritative: true},
+			Answers: answers,
+		}, groupAddress)
+	}
+}
+
+func (r *Responder) handlePacket(packet []byte, from *net.UDPAddr) {
+	var query dnsmessage.Message
+	if err := query.Unpack(packet); err != nil || query.Header.Response {
+		return
+	}
+
+	// Queries from other ports are legacy unicast DNS queries, answered like a DNS server
+	legacy := from.Port != port
+	unicast := legacy
+	var answers, additionals []dnsmessage.Resource
+	for _, question := range query.Questions {
+		questionAnswers, questionAdditionals := r.answer(question)
+		if len(questionAnswers) == 0 {
+			continue
+		}
+		answers = append(answers, questionAnswers...)
+		additionals = append(additionals, questionAdditionals...)
+		if question.Class&classTopBit != 0 {
+			unicast = true
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	response := &dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	if legacy {
+		response.Header.ID = query.Header.ID
+		response.Questions = query.Questions
+		// Legacy resolvers do not know the cache flush bit
+		for _, records := range [][]dnsmessage.Resource{response.Answers, response.Additionals} {
+			for i := range records {
+				records[i].Header.Class &^= classTopBit
+			}
+		}
+	}
+	if unicast {
+		r.send(response, from)
+	} else {
+		r.send(response, groupAddress)
+	}
+}
+
+// Records answering question, and the records the querier will ask for next.
+func (r *Responder) answer(question dnsmessage.Question) ([]dnsmessage.Resource, []dnsmessage.Resource) {
+	name := strings.ToLower(question.Name.String())
+	matches := func(recordType dnsmessage.Type) bool {
+		return question.Type == recordType || question.Type == dnsmessage.TypeALL
+	}
+
+	var answers, additionals []dnsmessage.Resource
+	// Services can share a host
+	answeredHosts := map[string]bool{}
+	for _, service := range r.services {
+		records := r.serviceRecords(service)
+		ptr, srv, txt := records[0], records[1], records[2]
+		switch {
+		case name == "_services._dns-sd._udp.local." && matches(dnsmessage.TypePTR):
+			answers = append(answers, resource(name, otherTTL, false, &dnsmessage.PTRResource{PTR: mustName(service.typeName())}))
+		case name == strings.ToLower(service.typeName()) && matches(dnsmessage.TypePTR):
+			answers = append(answers, ptr)
+			additionals = append(additionals, srv, txt)
+			additionals = append(additionals, r.addressRecords(service)...)
+		case name == strings.ToLower(service.instanceName()):
+			if matches(dnsmessage.TypeSRV) {
+				answers = append(answers, srv)
+				additionals = append(additionals, r.addressRecords(service)...)
+			}
+			if matches(dnsmessage.TypeTXT) {
+				answers = append(answers, txt)
+			}
+		case name == strings.ToLower(service.hostName()) && matches(dnsmessage.TypeA) && !answeredHosts[name]:
+			answeredHosts[name] = true
+			answers = append(answers, r.addressRecords(service)...)
+		}
+	}
+	return answers, additionals
+}
+
+// PTR, SRV and TXT record of service.
+func (r *Responder) serviceRecords(service *Service) []dnsmessage.Resource {
+	txt := service.TXT
+	if len(txt) == 0 {
+		// A TXT record holds at least one string
+		txt = []string{""}
+	}
+	return []dnsmessage.Resource{
+		resource(service.typeName(), otherTTL, false, &dnsmessage.PTRResource{PTR: mustName(service.instanceName())}),
+		resource(service.instanceName(), hostTTL, true, &dnsmessage.SRVResource{Target: mustName(service.hostName()), Port: uint16(service.Port)}),
+		resource(service.instanceName(), otherTTL, true, &dnsmessage.TXTResource{TXT: txt}),
+	}
+}
+
+// A records of the host, looked up each time as addresses can change.
+func (r *Responder) addressRecords(service *Service) []dnsmessage.Resource {
+	addresses := []net.IP{r.address.To4()}
+	if r.address == nil {
+		addresses = localAddresses()
+	} else if addresses[0] == nil || r.address.IsLoopback() {
+		// Services on an IPv6 or loopback address have no A record
+		return nil
+	}
+	var records []dnsmessage.Resource
+	for _, ip := range addresses {
+		records = append(records, resource(service.hostName(), hostTTL, true, &dnsmessage.AResource{A: [4]byte(ip.To4())}))
+	}
+	return records
+}
+
+func (r *Responder) send(message *dnsmessage.Message, to *net.UDPAddr) {
+	packet, err := message.Pack()
+	if err != nil {
+		log.Printf("Failed to pack mDNS response: %v", err)
+		return
+	}
+	if _, err := r.conn.WriteToUDP(packet, to); err != nil {
+		log.Printf("Failed to send mDNS response to %s: %v", to, err)
+	}
+}
+
+func resource(name string, ttl uint32, unique bool, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	class := dnsmessage.ClassINET
+	if unique {
+		class |= classTopBit
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(name), Class: class, TTL: ttl},
+		Body:   body,
+	}
+}
+
+// Names are built from service definitions, which stay far below the 255 byte limit.
+func mustName(name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// IPv4 addresses of the interfaces that are up and support multicast, except loopback.
+func localAddresses() []net.IP {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addresses, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if ipNet, ok := address.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				ips = append(ips, ipNet.IP.To4())
+			}
+		}
+	}
+	return ips
+}
@@ -1,14 +1,36 @@
 package meterdb
 
-func InsertLivePowerReading(reading *MeterDbLivePowerReading) error {
-	db := GetDB()
+import "database/sql"
+
+// Shared by *sql.DB and *sql.Tx so inserts can run directly or batched.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Filter on meter_id unless AllMeters is requested. Takes the meter id twice as args.
+const meterFilter = "(? = '' OR meter_id = ?)"
 
+func InsertLivePhasePowerReading(reading *MeterDbLivePhasePowerReading) error {
+	return insertLivePhasePowerReading(GetDB(), reading)
+}
+
+func insertLivePhasePowerReading(db execer, reading *MeterDbLivePhasePowerReading) error {
 	_, err := db.Exec(
-		"INSERT INTO live_power_readings (timestamp, watt, reading_type) "+
-			"VALUES (?, ?, ?)",
+		"INSERT INTO live_phase_power_readings "+
+			"(meter_id, timestamp, tariff, import_watt, export_watt, "+
+			"l1_import_watt, l1_export_watt, l2_import_watt, l2_export_watt, l3_import_watt, l3_export_watt) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		reading.MeterID,
 		reading.Timestamp,
-		reading.Watt,
-		reading.ReadingType,
+		reading.Tariff,
+		reading.ImportWatt,
+		reading.ExportWatt,
+		reading.L1ImportWatt,
+		reading.L1ExportWatt,
+		reading.L2ImportWatt,
+		reading.L2ExportWatt,
+		reading.L3ImportWatt,
+		reading.L3ExportWatt,
 	)
 	if err != nil {
 		return err
@@ -17,15 +39,19 @@ func InsertLivePowerReading(reading *MeterDbLivePowerReading) error {
 }
 
 func InsertTotalPowerReading(reading *MeterDbTotalPowerReading) error {
-	db := GetDB()
+	return insertTotalPowerReading(GetDB(), reading)
+}
 
+func insertTotalPowerReading(db execer, reading *MeterDbTotalPowerReading) error {
 	_, err := db.Exec(
 		"INSERT INTO total_power_readings "+
-			"(timestamp, watthour, reading_type) "+
-			"VALUES (?, ?, ?)",
+			"(meter_id, timestamp, watthour, reading_type, segment_id) "+
+			"VALUES (?, ?, ?, ?, ?)",
+		reading.MeterID,
 		reading.Timestamp,
 		reading.Watthour,
 		reading.ReadingType,
+		reading.SegmentID,
 	)
 	if err != nil {
 		return err
@@ -34,14 +60,35 @@ func InsertTotalPowerReading(reading *MeterDbTotalPowerReading) error {
 }
 
 func InsertTotalGasReading(reading *MeterDbTotalGasReading) error {
-	db := GetDB()
+	return insertTotalGasReading(GetDB(), reading)
+}
 
+func insertTotalGasReading(db execer, reading *MeterDbTotalGasReading) error {
 	_, err := db.Exec(
 		"INSERT INTO total_gas_readings "+
-			"(timestamp, consumption_dm3) "+
-			"VALUES (?, ?)",
+			"(meter_id, timestamp, consumption_dm3, segment_id) "+
+			"VALUES (?, ?, ?, ?)",
+		reading.MeterID,
 		reading.Timestamp,
 		reading.TotalConsumptionDM3,
+		reading.SegmentID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func InsertDataGap(gap *MeterDbDataGap) error {
+	return insertDataGap(GetDB(), gap)
+}
+
+func insertDataGap(db execer, gap *MeterDbDataGap) error {
+	_, err := db.Exec(
+		"INSERT INTO data_gaps (meter_id, start_timestamp, end_timestamp) VALUES (?, ?, ?)",
+		gap.MeterID,
+		gap.StartTimestamp,
+		gap.EndTimestamp,
 	)
 	if err != nil {
 		return err
@@ -49,16 +96,265 @@ func InsertTotalGasReading(reading *MeterDbTotalGasReading) error {
 	return nil
 }
 
-func GetLastTotalPowerReading(readingType MeterDbPowerReadingType) (*MeterDbTotalPowerReading, error) {
+func InsertQuarantinedReading(reading *MeterDbQuarantinedReading) error {
+	return insertQuarantinedReading(GetDB(), reading)
+}
+
+func insertQuarantinedReading(db execer, reading *MeterDbQuarantinedReading) error {
+	_, err := db.Exec(
+		"INSERT INTO quarantined_readings "+
+			"(meter_id, timestamp, kind, reading_type, previous_value, value, reason) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?)",
+		reading.MeterID,
+		reading.Timestamp,
+		reading.Kind,
+		reading.ReadingType,
+		reading.PreviousValue,
+		reading.Value,
+		reading.Reason,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Get the last total of a register within a meter segment.
+func GetLastTotalPowerReading(meterID string, readingType MeterDbPowerReadingType, segmentID int64) (*MeterDbTotalPowerReading, error) {
 	db := GetDB()
 
 	var reading MeterDbTotalPowerReading
-	err := db.QueryRow("SELECT timestamp, watthour, reading_type "+
-		"FROM total_power_readings WHERE reading_type = ? ORDER BY timestamp DESC LIMIT 1",
-		readingType,
-	).Scan(&reading.Timestamp, &reading.Watthour, &reading.ReadingType)
+	err := db.QueryRow("SELECT meter_id, timestamp, watthour, reading_type, segment_id "+
+		"FROM total_power_readings WHERE meter_id = ? AND reading_type = ? AND segment_id = ? "+
+		"ORDER BY timestamp DESC LIMIT 1",
+		meterID, readingType, segmentID,
+	).Scan(&reading.MeterID, &reading.Timestamp, &reading.Watthour, &reading.ReadingType, &reading.SegmentID)
 	if err != nil {
 		return nil, err
 	}
 	return &reading, nil
 }
+
+// Get the last gas total within a meter segment.
+func GetLastTotalGasReading(meterID string, segmentID int64) (*MeterDbTotalGasReading, error) {
+	db := GetDB()
+
+	var reading MeterDbTotalGasReading
+	err := db.QueryRow("SELECT meter_id, timestamp, consumption_dm3, segment_id "+
+		"FROM total_gas_readings WHERE meter_id = ? AND segment_id = ? ORDER BY timestamp DESC LIMIT 1",
+		meterID, segmentID,
+	).Scan(&reading.MeterID, &reading.Timestamp, &reading.TotalConsumptionDM3, &reading.SegmentID)
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// Get the most recently started segment of a meter kind read through meterID.
+// Returns sql.ErrNoRows when no segment was started yet.
+func GetCurrentMeterSegment(meterID string, kind MeterDbMeterKind) (*MeterDbMeterSegment, error) {
+	db := GetDB()
+
+	var segment MeterDbMeterSegment
+	err := db.QueryRow("SELECT id, meter_id, kind, serial, started_at "+
+		"FROM meter_segments WHERE meter_id = ? AND kind = ? ORDER BY id DESC LIMIT 1",
+		meterID, kind,
+	).Scan(&segment.ID, &segment.MeterID, &segment.Kind, &segment.Serial, &segment.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &segment, nil
+}
+
+// Start a new counter segment for a meter kind read through meterID.
+// The very first segment adopts the meter's totals stored before segments existed.
+func StartMeterSegment(meterID string, kind MeterDbMeterKind, serial string, startedAt int64) (*MeterDbMeterSegment, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var existingSegments int
+	err = tx.QueryRow("SELECT COUNT(*) FROM meter_segments WHERE meter_id = ? AND kind = ?",
+		meterID, kind,
+	).Scan(&existingSegments)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO meter_segments (meter_id, kind, serial, started_at) VALUES (?, ?, ?, ?)",
+		meterID, kind, serial, startedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if existingSegments == 0 {
+		totalsTable := "total_power_readings"
+		if kind == MeterKindGas {
+			totalsTable = "total_gas_readings"
+		}
+		_, err = tx.Exec("UPDATE "+totalsTable+" SET segment_id = ? WHERE meter_id = ? AND segment_id = 0",
+			id, meterID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &MeterDbMeterSegment{
+		ID:        id,
+		MeterID:   meterID,
+		Kind:      kind,
+		Serial:    serial,
+		StartedAt: startedAt,
+	}, nil
+}
+
+// Tables with rows tagged by meter id
+var meterTables = []string{
+	"live_phase_power_readings",
+	"total_power_readings",
+	"total_gas_readings",
+	"data_gaps",
+	"meter_segments",
+	"quarantined_readings",
+	"live_power_readings",
+	"energy_balance",
+	"solar_production_readings",
+}
+
+// Move rows stored before meters were tagged to meterID, so its history and
+// counter segments continue from them. Returns whether there were any.
+// Rows colliding with rows of meterID keep the legacy id.
+func AdoptLegacyRows(meterID string) (bool, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	adopted := false
+	for _, table := range meterTables {
+		result, err := tx.Exec("UPDATE OR IGNORE "+table+" SET meter_id = ? WHERE meter_id = ?",
+			meterID, LegacyMeterID,
+		)
+		if err != nil {
+			return false, err
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+			adopted = true
+		}
+	}
+	return adopted, tx.Commit()
+}
+
+// Get the ids of all meters with stored live readings.
+func GetMeterIDs() ([]string, error) {
+	db := GetDB()
+
+	rows, err := db.Query("SELECT DISTINCT meter_id FROM live_power_history ORDER BY meter_id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	meterIDs := make([]string, 0)
+	for rows.Next() {
+		var meterID string
+		if err := rows.Scan(&meterID); err != nil {
+			return nil, err
+		}
+		meterIDs = append(meterIDs, meterID)
+	}
+	return meterIDs, rows.Err()
+}
+
+// Get live power readings between from and to (inclusive, unix seconds).
+// Includes legacy rows, which only contain the dominant direction without phase detail.
+func GetLivePowerHistory(meterID string, from int64, to int64) ([]*MeterDbLivePhasePowerReading, error) {
+	db := GetDB()
+
+	rows, err := db.Query("SELECT meter_id, timestamp, tariff, import_watt, export_watt, "+
+		"l1_import_watt, l1_export_watt, l2_import_watt, l2_export_watt, l3_import_watt, l3_export_watt, legacy "+
+		"FROM live_power_history WHERE "+meterFilter+" AND timestamp BETWEEN ? AND ? "+
+		"ORDER BY timestamp ASC, meter_id ASC",
+		meterID, meterID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := make([]*MeterDbLivePhasePowerReading, 0)
+	for rows.Next() {
+		var reading MeterDbLivePhasePowerReading
+		err := rows.Scan(
+			&reading.MeterID, &reading.Timestamp, &reading.Tariff, &reading.ImportWatt, &reading.ExportWatt,
+			&reading.L1ImportWatt, &reading.L1ExportWatt,
+			&reading.L2ImportWatt, &reading.L2ExportWatt,
+			&reading.L3ImportWatt, &reading.L3ExportWatt,
+			&reading.Legacy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, &reading)
+	}
+	return readings, rows.Err()
+}
+
+// Timestamp of the most recent stored live reading of a meter.
+// Returns sql.ErrNoRows when the meter has no readings yet.
+func GetLastLivePowerTimestamp(meterID string) (int64, error) {
+	db := GetDB()
+
+	var timestamp sql.NullInt64
+	err := db.QueryRow("SELECT MAX(timestamp) FROM live_power_history WHERE meter_id = ?",
+		meterID,
+	).Scan(&timestamp)
+	if err != nil {
+		return 0, err
+	}
+	if !timestamp.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return timestamp.Int64, nil
+}
+
+// Get data gaps overlapping from and to (inclusive, unix seconds).
+func GetDataGaps(meterID string, from int64, to int64) ([]*MeterDbDataGap, error) {
+	db := GetDB()
+
+	rows, err := db.Query("SELECT meter_id, start_timestamp, end_timestamp FROM data_gaps "+
+		"WHERE "+meterFilter+" AND end_timestamp >= ? AND start_timestamp <= ? ORDER BY start_timestamp ASC",
+		meterID, meterID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gaps := make([]*MeterDbDataGap, 0)
+	for rows.Next() {
+		var gap MeterDbDataGap
+		if err := rows.Scan(&gap.MeterID, &gap.StartTimestamp, &gap.EndTimestamp); err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, &gap)
+	}
+	return gaps, rows.Err()
+}
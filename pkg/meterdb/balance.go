@@ -0,0 +1,51 @@
+package meterdb
+
+// Summed energy flows over a period.
+type EnergyBalanceTotals struct {
+	ImportWh float64
+	ExportWh float64
+	SolarWh  float64
+	// Seconds covered by balance rows, and the part of it with known solar production
+	CoveredSeconds      int64
+	SolarCoveredSeconds int64
+}
+
+func InsertEnergyBalance(balance *MeterDbEnergyBalance) error {
+	return insertEnergyBalance(GetDB(), balance)
+}
+
+func insertEnergyBalance(db execer, balance *MeterDbEnergyBalance) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO energy_balance "+
+			"(meter_id, timestamp, duration_seconds, import_wh, export_wh, solar_wh) "+
+			"VALUES (?, ?, ?, ?, ?, ?)",
+		balance.MeterID,
+		balance.Timestamp,
+		balance.DurationSeconds,
+		balance.ImportWh,
+		balance.ExportWh,
+		balance.SolarWh,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Sum the energy balance rows starting between from and to (inclusive).
+func GetEnergyBalanceTotals(meterID string, from int64, to int64) (*EnergyBalanceTotals, error) {
+	db := GetDB()
+
+	var totals EnergyBalanceTotals
+	err := db.QueryRow(
+		"SELECT COALESCE(SUM(import_wh), 0), COALESCE(SUM(export_wh), 0), COALESCE(SUM(solar_wh), 0), "+
+			"COALESCE(SUM(duration_seconds), 0), "+
+			"COALESCE(SUM(CASE WHEN solar_wh IS NULL THEN 0 ELSE duration_seconds END), 0) "+
+			"FROM energy_balance WHERE "+meterFilter+" AND timestamp BETWEEN ? AND ?",
+		meterID, meterID, from, to,
+	).Scan(&totals.ImportWh, &totals.ExportWh, &totals.SolarWh, &totals.CoveredSeconds, &totals.SolarCoveredSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
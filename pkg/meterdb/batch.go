@@ -0,0 +1,188 @@
+package meterdb
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Rows kept while the database fails, in batches of maxRows.
+// Older rows are dropped beyond this, so a failing database does not exhaust memory.
+const maxPendingBatches = 20
+
+// A queued insert, executed inside the batch transaction.
+type batchedInsert func(db execer) error
+
+// BatchWriter buffers inserts and commits them in a single transaction
+// every flushInterval or once maxRows are pending, whichever comes first.
+// This keeps SD card writes down compared to auto-committing every row.
+type BatchWriter struct {
+	flushInterval time.Duration
+	maxRows       int
+
+	pendingMutex sync.Mutex
+	pending      []batchedInsert
+	// Held for a whole flush, so a flush only returns once rows queued before it are committed
+	flushMutex sync.Mutex
+
+	flushSignal chan struct{}
+	stopSignal  chan struct{}
+	stopped     chan struct{}
+	closeOnce   sync.Once
+}
+
+// Create a BatchWriter and start its background flush loop.
+// Close must be called on shutdown to commit remaining rows.
+func NewBatchWriter(flushInterval time.Duration, maxRows int) *BatchWriter {
+	if flushInterval <= 0 {
+		flushInterval = 30 * time.Second
+	}
+	if maxRows <= 0 {
+		maxRows = 300
+	}
+
+	b := &BatchWriter{
+		flushInterval: flushInterval,
+		maxRows:       maxRows,
+		pending:       make([]batchedInsert, 0, maxRows),
+		flushSignal:   make(chan struct{}, 1),
+		stopSignal:    make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *BatchWriter) QueueLivePhasePowerReading(reading *MeterDbLivePhasePowerReading) {
+	b.queue(func(db execer) error {
+		return insertLivePhasePowerReading(db, reading)
+	})
+}
+
+func (b *BatchWriter) QueueTotalPowerReading(reading *MeterDbTotalPowerReading) {
+	b.queue(func(db execer) error {
+		return insertTotalPowerReading(db, reading)
+	})
+}
+
+func (b *BatchWriter) QueueTotalGasReading(reading *MeterDbTotalGasReading) {
+	b.queue(func(db execer) error {
+		return insertTotalGasReading(db, reading)
+	})
+}
+
+func (b *BatchWriter) QueueDataGap(gap *MeterDbDataGap) {
+	b.queue(func(db execer) error {
+		return insertDataGap(db, gap)
+	})
+}
+
+func (b *BatchWriter) QueueQuarantinedReading(reading *MeterDbQuarantinedReading) {
+	b.queue(func(db execer) error {
+		return insertQuarantinedReading(db, reading)
+	})
+}
+
+func (b *BatchWriter) QueueEnergyBalance(balance *MeterDbEnergyBalance) {
+	b.queue(func(db execer) error {
+		return insertEnergyBalance(db, balance)
+	})
+}
+
+func (b *BatchWriter) QueueSolarProductionReading(reading *MeterDbSolarProductionReading) {
+	b.queue(func(db execer) error {
+		return insertSolarProductionReading(db, reading)
+	})
+}
+
+// Commit all pending rows in one transaction.
+// Rows that fail individually are logged and dropped,
+// rows are only kept for a retry when the transaction itself fails.
+func (b *BatchWriter) Flush() error {
+	b.flushMutex.Lock()
+	defer b.flushMutex.Unlock()
+
+	b.pendingMutex.Lock()
+	batch := b.pending
+	b.pending = make([]batchedInsert, 0, b.maxRows)
+	b.pendingMutex.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	tx, err := GetDB().Begin()
+	if err != nil {
+		b.requeue(batch)
+		return fmt.Errorf("failed to begin batch transaction: %w", err)
+	}
+
+	for _, insert := range batch {
+		if err := insert(tx); err != nil {
+			log.Printf("Failed to insert batched row: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		b.requeue(batch)
+		return fmt.Errorf("failed to commit batch of %d rows: %w", len(batch), err)
+	}
+	return nil
+}
+
+// Stop the flush loop and commit anything still pending.
+func (b *BatchWriter) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.stopSignal)
+	})
+	<-b.stopped
+	return b.Flush()
+}
+
+func (b *BatchWriter) queue(insert batchedInsert) {
+	b.pendingMutex.Lock()
+	b.pending = append(b.pending, insert)
+	full := len(b.pending) >= b.maxRows
+	b.pendingMutex.Unlock()
+
+	if full {
+		select {
+		case b.flushSignal <- struct{}{}:
+		default:
+			// Flush already requested
+		}
+	}
+}
+
+// Put a failed batch back in front of rows queued in the meantime,
+// dropping the oldest rows once more than maxPendingBatches are pending.
+func (b *BatchWriter) requeue(batch []batchedInsert) {
+	b.pendingMutex.Lock()
+	defer b.pendingMutex.Unlock()
+	b.pending = append(batch, b.pending...)
+	if excess := len(b.pending) - b.maxRows*maxPendingBatches; excess > 0 {
+		log.Printf("Dropping %d batched rows, the database keeps failing", excess)
+		b.pending = b.pending[excess:]
+	}
+}
+
+func (b *BatchWriter) run() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flushSignal:
+		case <-b.stopSignal:
+			return
+		}
+		if err := b.Flush(); err != nil {
+			log.Printf("Failed to flush batch: %v", err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+-- +up
+-- Live readings store import and export for every phase simultaneously,
+-- so mixed flows (eg. L1 importing while L2 exports) are no longer lost.
+CREATE TABLE live_phase_power_readings (
+    timestamp INTEGER PRIMARY KEY,
+    tariff INTEGER NOT NULL,
+    import_watt INTEGER NOT NULL,
+    export_watt INTEGER NOT NULL,
+    l1_import_watt INTEGER NOT NULL,
+    l1_export_watt INTEGER NOT NULL,
+    l2_import_watt INTEGER NOT NULL,
+    l2_export_watt INTEGER NOT NULL,
+    l3_import_watt INTEGER NOT NULL,
+    l3_export_watt INTEGER NOT NULL
+);
+
+-- Totals of every register may now change within the same second.
+CREATE TABLE total_power_readings_new (
+    timestamp INTEGER NOT NULL,
+    watthour INTEGER NOT NULL,
+    reading_type INTEGER NOT NULL,
+    PRIMARY KEY (timestamp, reading_type)
+);
+INSERT INTO total_power_readings_new (timestamp, watthour, reading_type)
+    SELECT timestamp, watthour, reading_type FROM total_power_readings;
+DROP TABLE total_power_readings;
+ALTER TABLE total_power_readings_new RENAME TO total_power_readings;
+
+-- Combined history of new and legacy live readings.
+-- Legacy rows only know the dominant direction and have no phase detail.
+CREATE VIEW live_power_history AS
+    SELECT
+        timestamp, tariff, import_watt, export_watt,
+        l1_import_watt, l1_export_watt,
+        l2_import_watt, l2_export_watt,
+        l3_import_watt, l3_export_watt,
+        0 AS legacy
+    FROM live_phase_power_readings
+    UNION ALL
+    SELECT
+        timestamp,
+        CASE WHEN reading_type IN (0, 2) THEN 1 ELSE 2 END,
+        CASE WHEN reading_type IN (0, 1) THEN watt ELSE 0 END,
+        CASE WHEN reading_type IN (2, 3) THEN watt ELSE 0 END,
+        0, 0, 0, 0, 0, 0,
+        1 AS legacy
+    FROM live_power_readings;
+
+-- +down
+DROP VIEW live_power_history;
+DROP TABLE live_phase_power_readings;
+
+CREATE TABLE total_power_readings_old (
+    timestamp INTEGER PRIMARY KEY,
+    watthour INTEGER NOT NULL,
+    reading_type INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO total_power_readings_old (timestamp, watthour, reading_type)
+    SELECT timestamp, watthour, reading_type FROM total_power_readings;
+DROP TABLE total_power_readings;
+ALTER TABLE total_power_readings_old RENAME TO total_power_readings;
@@ -0,0 +1,10 @@
+-- +up
+-- Periods without live readings that could not be backfilled.
+-- Both timestamps are the stored readings surrounding the gap.
+CREATE TABLE data_gaps (
+    start_timestamp INTEGER PRIMARY KEY,
+    end_timestamp INTEGER NOT NULL
+);
+
+-- +down
+DROP TABLE data_gaps;
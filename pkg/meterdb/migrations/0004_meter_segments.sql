@@ -0,0 +1,30 @@
+-- +up
+-- A segment starts whenever a meter is replaced (serial changed)
+-- or its counters restart, so deltas are never taken across segments.
+CREATE TABLE meter_segments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind INTEGER NOT NULL,
+    serial TEXT NOT NULL,
+    started_at INTEGER NOT NULL
+);
+
+-- Existing totals are assigned when the first segment is created.
+ALTER TABLE total_power_readings ADD COLUMN segment_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE total_gas_readings ADD COLUMN segment_id INTEGER NOT NULL DEFAULT 0;
+
+-- Totals that failed sanity checks, kept for inspection only.
+CREATE TABLE quarantined_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp INTEGER NOT NULL,
+    kind INTEGER NOT NULL,
+    reading_type INTEGER NOT NULL,
+    previous_value INTEGER NOT NULL,
+    value INTEGER NOT NULL,
+    reason TEXT NOT NULL
+);
+
+-- +down
+DROP TABLE quarantined_readings;
+ALTER TABLE total_gas_readings DROP COLUMN segment_id;
+ALTER TABLE total_power_readings DROP COLUMN segment_id;
+DROP TABLE meter_segments;
@@ -0,0 +1,180 @@
+-- +up
+-- Every row is tagged with the electricity meter serial it came from,
+-- so readings of multiple meters can share one database.
+-- Existing rows belong to the meter installed before this migration. When its serial
+-- is not known yet they are tagged legacy, and adopted by the first meter collected
+-- from the primary interpreter API.
+CREATE TEMP TABLE previous_meter AS
+    SELECT COALESCE(
+        (SELECT serial FROM meter_segments WHERE kind = 0 ORDER BY id DESC LIMIT 1),
+        'legacy'
+    ) AS meter_id;
+
+DROP VIEW live_power_history;
+
+CREATE TABLE live_phase_power_readings_new (
+    meter_id TEXT NOT NULL,
+    timestamp INTEGER NOT NULL,
+    tariff INTEGER NOT NULL,
+    import_watt INTEGER NOT NULL,
+    export_watt INTEGER NOT NULL,
+    l1_import_watt INTEGER NOT NULL,
+    l1_export_watt INTEGER NOT NULL,
+    l2_import_watt INTEGER NOT NULL,
+    l2_export_watt INTEGER NOT NULL,
+    l3_import_watt INTEGER NOT NULL,
+    l3_export_watt INTEGER NOT NULL,
+    PRIMARY KEY (meter_id, timestamp)
+);
+INSERT INTO live_phase_power_readings_new
+    SELECT (SELECT meter_id FROM previous_meter), timestamp, tariff, import_watt, export_watt,
+        l1_import_watt, l1_export_watt, l2_import_watt, l2_export_watt, l3_import_watt, l3_export_watt
+    FROM live_phase_power_readings;
+DROP TABLE live_phase_power_readings;
+ALTER TABLE live_phase_power_readings_new RENAME TO live_phase_power_readings;
+
+CREATE TABLE total_power_readings_new (
+    meter_id TEXT NOT NULL,
+    timestamp INTEGER NOT NULL,
+    watthour INTEGER NOT NULL,
+    reading_type INTEGER NOT NULL,
+    segment_id INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (meter_id, timestamp, reading_type)
+);
+INSERT INTO total_power_readings_new
+    SELECT (SELECT meter_id FROM previous_meter), timestamp, watthour, reading_type, segment_id
+    FROM total_power_readings;
+DROP TABLE total_power_readings;
+ALTER TABLE total_power_readings_new RENAME TO total_power_readings;
+
+CREATE TABLE total_gas_readings_new (
+    meter_id TEXT NOT NULL,
+    timestamp INTEGER NOT NULL,
+    consumption_dm3 INTEGER NOT NULL,
+    segment_id INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (meter_id, timestamp)
+);
+INSERT INTO total_gas_readings_new
+    SELECT (SELECT meter_id FROM previous_meter), timestamp, consumption_dm3, segment_id
+    FROM total_gas_readings;
+DROP TABLE total_gas_readings;
+ALTER TABLE total_gas_readings_new RENAME TO total_gas_readings;
+
+CREATE TABLE data_gaps_new (
+    meter_id TEXT NOT NULL,
+    start_timestamp INTEGER NOT NULL,
+    end_timestamp INTEGER NOT NULL,
+    PRIMARY KEY (meter_id, start_timestamp)
+);
+INSERT INTO data_gaps_new
+    SELECT (SELECT meter_id FROM previous_meter), start_timestamp, end_timestamp
+    FROM data_gaps;
+DROP TABLE data_gaps;
+ALTER TABLE data_gaps_new RENAME TO data_gaps;
+
+ALTER TABLE meter_segments ADD COLUMN meter_id TEXT NOT NULL DEFAULT '';
+UPDATE meter_segments SET meter_id = (SELECT meter_id FROM previous_meter);
+
+ALTER TABLE quarantined_readings ADD COLUMN meter_id TEXT NOT NULL DEFAULT '';
+UPDATE quarantined_readings SET meter_id = (SELECT meter_id FROM previous_meter);
+
+ALTER TABLE live_power_readings ADD COLUMN meter_id TEXT NOT NULL DEFAULT '';
+UPDATE live_power_readings SET meter_id = (SELECT meter_id FROM previous_meter);
+
+CREATE VIEW live_power_history AS
+    SELECT
+        meter_id, timestamp, tariff, import_watt, export_watt,
+        l1_import_watt, l1_export_watt,
+        l2_import_watt, l2_export_watt,
+        l3_import_watt, l3_export_watt,
+        0 AS legacy
+    FROM live_phase_power_readings
+    UNION ALL
+    SELECT
+        meter_id,
+        timestamp,
+        CASE WHEN reading_type IN (0, 2) THEN 1 ELSE 2 END,
+        CASE WHEN reading_type IN (0, 1) THEN watt ELSE 0 END,
+        CASE WHEN reading_type IN (2, 3) THEN watt ELSE 0 END,
+        0, 0, 0, 0, 0, 0,
+        1 AS legacy
+    FROM live_power_readings;
+
+-- Queries across all meters filter on time only
+CREATE INDEX idx_live_phase_power_readings_timestamp ON live_phase_power_readings (timestamp);
+CREATE INDEX idx_total_power_readings_timestamp ON total_power_readings (timestamp);
+CREATE INDEX idx_total_gas_readings_timestamp ON total_gas_readings (timestamp);
+
+DROP TABLE previous_meter;
+
+-- +down
+DROP VIEW live_power_history;
+
+ALTER TABLE live_power_readings DROP COLUMN meter_id;
+ALTER TABLE quarantined_readings DROP COLUMN meter_id;
+ALTER TABLE meter_segments DROP COLUMN meter_id;
+
+CREATE TABLE data_gaps_old (
+    start_timestamp INTEGER PRIMARY KEY,
+    end_timestamp INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO data_gaps_old SELECT start_timestamp, end_timestamp FROM data_gaps;
+DROP TABLE data_gaps;
+ALTER TABLE data_gaps_old RENAME TO data_gaps;
+
+CREATE TABLE total_gas_readings_old (
+    timestamp INTEGER PRIMARY KEY,
+    consumption_dm3 INTEGER NOT NULL,
+    segment_id INTEGER NOT NULL DEFAULT 0
+);
+INSERT OR IGNORE INTO total_gas_readings_old SELECT timestamp, consumption_dm3, segment_id FROM total_gas_readings;
+DROP TABLE total_gas_readings;
+ALTER TABLE total_gas_readings_old RENAME TO total_gas_readings;
+
+CREATE TABLE total_power_readings_old (
+    timestamp INTEGER NOT NULL,
+    watthour INTEGER NOT NULL,
+    reading_type INTEGER NOT NULL,
+    segment_id INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (timestamp, reading_type)
+);
+INSERT OR IGNORE INTO total_power_readings_old SELECT timestamp, watthour, reading_type, segment_id FROM total_power_readings;
+DROP TABLE total_power_readings;
+ALTER TABLE total_power_readings_old RENAME TO total_power_readings;
+
+CREATE TABLE live_phase_power_readings_old (
+    timestamp INTEGER PRIMARY KEY,
+    tariff INTEGER NOT NULL,
+    import_watt INTEGER NOT NULL,
+    export_watt INTEGER NOT NULL,
+    l1_import_watt INTEGER NOT NULL,
+    l1_export_watt INTEGER NOT NULL,
+    l2_import_watt INTEGER NOT NULL,
+    l2_export_watt INTEGER NOT NULL,
+    l3_import_watt INTEGER NOT NULL,
+    l3_export_watt INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO live_phase_power_readings_old
+    SELECT timestamp, tariff, import_watt, export_watt,
+        l1_import_watt, l1_export_watt, l2_import_watt, l2_export_watt, l3_import_watt, l3_export_watt
+    FROM live_phase_power_readings;
+DROP TABLE live_phase_power_readings;
+ALTER TABLE live_phase_power_readings_old RENAME TO live_phase_power_readings;
+
+CREATE VIEW live_power_history AS
+    SELECT
+        timestamp, tariff, import_watt, export_watt,
+        l1_import_watt, l1_export_watt,
+        l2_import_watt, l2_export_watt,
+        l3_import_watt, l3_export_watt,
+        0 AS legacy
+    FROM live_phase_power_readings
+    UNION ALL
+    SELECT
+        timestamp,
+        CASE WHEN reading_type IN (0, 2) THEN 1 ELSE 2 END,
+        CASE WHEN reading_type IN (0, 1) THEN watt ELSE 0 END,
+        CASE WHEN reading_type IN (2, 3) THEN watt ELSE 0 END,
+        0, 0, 0, 0, 0, 0,
+        1 AS legacy
+    FROM live_power_readings;
@@ -0,0 +1,12 @@
+-- +up
+-- Day-ahead market prices per interval, excluding VAT and contract markup.
+-- Timestamps are the interval start in meter local time, like all other tables.
+CREATE TABLE prices (
+    timestamp INTEGER PRIMARY KEY,
+    duration_seconds INTEGER NOT NULL,
+    price_kwh REAL NOT NULL,
+    source TEXT NOT NULL
+);
+
+-- +down
+DROP TABLE prices;
@@ -0,0 +1,16 @@
+-- +up
+-- Energy flows of a meter per interval, timestamp is the interval start.
+-- solar_wh is NULL when the inverter could not be read during the interval.
+CREATE TABLE energy_balance (
+    meter_id TEXT NOT NULL,
+    timestamp INTEGER NOT NULL,
+    duration_seconds INTEGER NOT NULL,
+    import_wh INTEGER NOT NULL,
+    export_wh INTEGER NOT NULL,
+    solar_wh REAL,
+    PRIMARY KEY (meter_id, timestamp)
+);
+CREATE INDEX idx_energy_balance_timestamp ON energy_balance(timestamp);
+
+-- +down
+DROP TABLE energy_balance;
@@ -0,0 +1,14 @@
+-- +up
+-- Solar inverter output polled through the interpreter API of a meter.
+-- lifetime_yield_wh is the inverter's own counter, NULL when not reported.
+CREATE TABLE solar_production_readings (
+    meter_id TEXT NOT NULL,
+    timestamp INTEGER NOT NULL,
+    power_watt INTEGER NOT NULL,
+    lifetime_yield_wh INTEGER,
+    PRIMARY KEY (meter_id, timestamp)
+);
+CREATE INDEX idx_solar_production_readings_timestamp ON solar_production_readings(timestamp);
+
+-- +down
+DROP TABLE solar_production_readings;
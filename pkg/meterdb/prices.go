@@ -0,0 +1,71 @@
+package meterdb
+
+import "database/sql"
+
+// Insert or replace prices in a single transaction.
+// Prices are republished regularly, the latest import wins.
+func InsertPrices(prices []*MeterDbPrice) error {
+	tx, err := GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, price := range prices {
+		_, err := tx.Exec(
+			"INSERT OR REPLACE INTO prices (timestamp, duration_seconds, price_kwh, source) "+
+				"VALUES (?, ?, ?, ?)",
+			price.Timestamp,
+			price.DurationSeconds,
+			price.PriceKWH,
+			price.Source,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get prices of intervals overlapping from and to (unix seconds), oldest first.
+func GetPrices(from int64, to int64) ([]*MeterDbPrice, error) {
+	db := GetDB()
+
+	rows, err := db.Query("SELECT timestamp, duration_seconds, price_kwh, source FROM prices "+
+		"WHERE timestamp + duration_seconds > ? AND timestamp < ? ORDER BY timestamp ASC",
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := make([]*MeterDbPrice, 0)
+	for rows.Next() {
+		var price MeterDbPrice
+		if err := rows.Scan(&price.Timestamp, &price.DurationSeconds, &price.PriceKWH, &price.Source); err != nil {
+			return nil, err
+		}
+		prices = append(prices, &price)
+	}
+	return prices, rows.Err()
+}
+
+// Get the average price of intervals overlapping from (inclusive) and to (exclusive).
+// Returns sql.ErrNoRows when no prices are known for the period.
+func GetAveragePriceKWH(from int64, to int64) (float64, error) {
+	db := GetDB()
+
+	var average sql.NullFloat64
+	err := db.QueryRow("SELECT AVG(price_kwh) FROM prices "+
+		"WHERE timestamp + duration_seconds > ? AND timestamp < ?",
+		from, to,
+	).Scan(&average)
+	if err != nil {
+		return 0, err
+	}
+	if !average.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return average.Float64, nil
+}
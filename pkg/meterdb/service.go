@@ -9,6 +9,8 @@ import (
 	"database/sql"
 	"embed"
 	"log"
+	"net/url"
+	"os"
 	"sync"
 
 	"github.com/NotCoffee418/dbmigrator"
@@ -46,7 +48,7 @@ func InitializeDatabase() {
 func GetDB() *sql.DB {
 	once.Do(func() {
 		var err error
-		db, err = sql.Open("sqlite", pathing.GetMeterDbPath())
+		db, err = sql.Open("sqlite", getDSN())
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -57,3 +59,28 @@ func GetDB() *sql.DB {
 	})
 	return db
 }
+
+// Pragmas are applied to every pooled connection.
+// WAL lets readers in other services work alongside the collector's writes,
+// synchronous NORMAL is safe with WAL and avoids an fsync on every commit.
+func getDSN() string {
+	pragmas := []string{
+		"journal_mode(WAL)",
+		"synchronous(NORMAL)",
+		"busy_timeout(5000)",
+		"temp_store(MEMORY)",
+	}
+	query := url.Values{}
+	for _, pragma := range pragmas {
+		query.Add("_pragma", pragma)
+	}
+	return "file:" + pathing.GetMeterDbPath() + "?" + query.Encode()
+}
+
+// Whether the meter database was created by meter_collector.
+// Services that only read should check this before calling GetDB,
+// which would otherwise create an empty database.
+func IsAvailable() bool {
+	_, err := os.Stat(pathing.GetMeterDbPath())
+	return err == nil
+}
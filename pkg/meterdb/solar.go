@@ -0,0 +1,103 @@
+package meterdb
+
+func InsertSolarProductionReading(reading *MeterDbSolarProductionReading) error {
+	return insertSolarProductionReading(GetDB(), reading)
+}
+
+func insertSolarProductionReading(db execer, reading *MeterDbSolarProductionReading) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO solar_production_readings "+
+			"(meter_id, timestamp, power_watt, lifetime_yield_wh) "+
+			"VALUES (?, ?, ?, ?)",
+		reading.MeterID,
+		reading.Timestamp,
+		reading.PowerWatt,
+		reading.LifetimeYieldWh,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Get the stored solar readings between from and to (unix seconds), oldest first.
+func GetSolarProductionReadings(meterID string, from int64, to int64) ([]*MeterDbSolarProductionReading, error) {
+	db := GetDB()
+
+	rows, err := db.Query(
+		"SELECT meter_id, timestamp, power_watt, lifetime_yield_wh FROM solar_production_readings "+
+			"WHERE "+meterFilter+" AND timestamp BETWEEN ? AND ? ORDER BY timestamp ASC, meter_id ASC",
+		meterID, meterID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := make([]*MeterDbSolarProductionReading, 0)
+	for rows.Next() {
+		var reading MeterDbSolarProductionReading
+		if err := rows.Scan(&reading.MeterID, &reading.Timestamp, &reading.PowerWatt, &reading.LifetimeYieldWh); err != nil {
+			return nil, err
+		}
+		readings = append(readings, &reading)
+	}
+	return readings, rows.Err()
+}
+
+// Get the solar energy produced per bucket between from and to (unix seconds).
+// Keys are the unix timestamp the bucket starts at, eg. 3600 for hours or 86400 for days.
+// Each increase of the lifetime yield is attributed to the bucket it was stored in.
+// Without a reported yield, power is integrated between readings at most 5 minutes apart.
+// Only looks back a day for the previous reading.
+func GetSolarProductionByBucket(meterID string, from int64, to int64, bucketSeconds int64) (map[int64]float64, error) {
+	db := GetDB()
+
+	rows, err := db.Query(
+		"SELECT (timestamp / ?) * ? AS bucket, SUM(delta) FROM ("+
+			"SELECT timestamp, CASE "+
+			"WHEN lifetime_yield_wh IS NOT NULL AND previous_yield IS NOT NULL THEN lifetime_yield_wh - previous_yield "+
+			"WHEN timestamp - previous_timestamp <= 300 THEN (power_watt + previous_power) / 2.0 * (timestamp - previous_timestamp) / 3600.0 "+
+			"ELSE 0 END AS delta FROM ("+
+			"SELECT timestamp, power_watt, lifetime_yield_wh, "+
+			"LAG(timestamp) OVER w AS previous_timestamp, "+
+			"LAG(power_watt) OVER w AS previous_power, "+
+			"LAG(lifetime_yield_wh) OVER w AS previous_yield "+
+			"FROM solar_production_readings "+
+			"WHERE "+meterFilter+" AND timestamp BETWEEN ? AND ? "+
+			"WINDOW w AS (PARTITION BY meter_id ORDER BY timestamp)"+
+			")) WHERE timestamp >= ? AND delta > 0 GROUP BY bucket",
+		bucketSeconds, bucketSeconds, meterID, meterID, from-24*3600, to, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	production := map[int64]float64{}
+	for rows.Next() {
+		var bucket int64
+		var wh float64
+		if err := rows.Scan(&bucket, &wh); err != nil {
+			return nil, err
+		}
+		production[bucket] = wh
+	}
+	return production, rows.Err()
+}
+
+// Get the highest polled solar power of any single meter between from and to (unix seconds).
+func GetSolarPeakWatt(meterID string, from int64, to int64) (int32, error) {
+	db := GetDB()
+
+	var peak int32
+	err := db.QueryRow(
+		"SELECT COALESCE(MAX(power_watt), 0) FROM solar_production_readings "+
+			"WHERE "+meterFilter+" AND timestamp BETWEEN ? AND ?",
+		meterID, meterID, from, to,
+	).Scan(&peak)
+	if err != nil {
+		return 0, err
+	}
+	return peak, nil
+}
@@ -1,5 +1,12 @@
 package meterdb
 
+// Every row is tagged with the serial of the electricity meter it came from.
+// Query functions accept AllMeters to combine every meter, so it is never stored as a meter id.
+const AllMeters = ""
+
+// Meter id of rows stored before meters were tagged, until the primary interpreter API's meter adopts them.
+const LegacyMeterID = "legacy"
+
 type MeterDbPowerReadingType uint8
 
 const (
@@ -9,19 +16,99 @@ const (
 	PowerProductionNight                          = 3
 )
 
-type MeterDbLivePowerReading struct {
-	Timestamp   int64                   `db:"timestamp"`
-	Watt        uint32                  `db:"watt"`
-	ReadingType MeterDbPowerReadingType `db:"reading_type"`
+type MeterDbMeterKind uint8
+
+const (
+	MeterKindElectricity MeterDbMeterKind = 0
+	MeterKindGas         MeterDbMeterKind = 1
+)
+
+// Live power with import and export for all phases at once.
+// Legacy is only set when read from history and the row originates
+// from the old single value live_power_readings table.
+type MeterDbLivePhasePowerReading struct {
+	MeterID      string `db:"meter_id"`
+	Timestamp    int64  `db:"timestamp"`
+	Tariff       uint8  `db:"tariff"` // 1 = Day, 2 = Night
+	ImportWatt   uint32 `db:"import_watt"`
+	ExportWatt   uint32 `db:"export_watt"`
+	L1ImportWatt uint32 `db:"l1_import_watt"`
+	L1ExportWatt uint32 `db:"l1_export_watt"`
+	L2ImportWatt uint32 `db:"l2_import_watt"`
+	L2ExportWatt uint32 `db:"l2_export_watt"`
+	L3ImportWatt uint32 `db:"l3_import_watt"`
+	L3ExportWatt uint32 `db:"l3_export_watt"`
+	Legacy       bool   `db:"legacy"`
 }
 
 type MeterDbTotalPowerReading struct {
+	MeterID     string                  `db:"meter_id"`
 	Timestamp   int64                   `db:"timestamp"`
 	Watthour    uint32                  `db:"watthour"`
 	ReadingType MeterDbPowerReadingType `db:"reading_type"`
+	SegmentID   int64                   `db:"segment_id"`
 }
 
 type MeterDbTotalGasReading struct {
+	MeterID             string `db:"meter_id"`
 	Timestamp           int64  `db:"timestamp"`
 	TotalConsumptionDM3 uint32 `db:"consumption_dm3"`
+	SegmentID           int64  `db:"segment_id"`
+}
+
+// Continuous counter history of a single physical meter.
+// ID 0 is used for totals stored before segments existed or without a known serial.
+// MeterID is the electricity meter the (gas) meter is read through.
+type MeterDbMeterSegment struct {
+	ID        int64            `db:"id"`
+	MeterID   string           `db:"meter_id"`
+	Kind      MeterDbMeterKind `db:"kind"`
+	Serial    string           `db:"serial"`
+	StartedAt int64            `db:"started_at"`
+}
+
+// A total that failed sanity checks and was not stored.
+// ReadingType is only meaningful for electricity.
+type MeterDbQuarantinedReading struct {
+	MeterID       string                  `db:"meter_id"`
+	Timestamp     int64                   `db:"timestamp"`
+	Kind          MeterDbMeterKind        `db:"kind"`
+	ReadingType   MeterDbPowerReadingType `db:"reading_type"`
+	PreviousValue uint32                  `db:"previous_value"`
+	Value         uint32                  `db:"value"`
+	Reason        string                  `db:"reason"`
+}
+
+type MeterDbDataGap struct {
+	MeterID        string `db:"meter_id"`
+	StartTimestamp int64  `db:"start_timestamp"`
+	EndTimestamp   int64  `db:"end_timestamp"`
+}
+
+// Market price of an interval starting at Timestamp.
+type MeterDbPrice struct {
+	Timestamp       int64   `db:"timestamp"`
+	DurationSeconds int64   `db:"duration_seconds"`
+	PriceKWH        float64 `db:"price_kwh"`
+	Source          string  `db:"source"`
+}
+
+// Energy flows of a meter during an interval starting at Timestamp.
+// SolarWh is nil when the inverter could not be read.
+type MeterDbEnergyBalance struct {
+	MeterID         string   `db:"meter_id"`
+	Timestamp       int64    `db:"timestamp"`
+	DurationSeconds int64    `db:"duration_seconds"`
+	ImportWh        int64    `db:"import_wh"`
+	ExportWh        int64    `db:"export_wh"`
+	SolarWh         *float64 `db:"solar_wh"`
+}
+
+// Solar inverter output at Timestamp, LifetimeYieldWh is nil when not reported.
+// Served as is by the interpreter API's /solar/readings.
+type MeterDbSolarProductionReading struct {
+	MeterID         string `db:"meter_id" json:"meter_id"`
+	Timestamp       int64  `db:"timestamp" json:"timestamp"`
+	PowerWatt       int32  `db:"power_watt" json:"power_watt"`
+	LifetimeYieldWh *int64 `db:"lifetime_yield_wh" json:"lifetime_yield_wh"`
 }
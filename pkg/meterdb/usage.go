@@ -0,0 +1,170 @@
+package meterdb
+
+import "database/sql"
+
+// Get the energy counted by a power register between from and to (unix seconds).
+// Deltas are calculated per meter segment, so replacing a meter
+// does not show up as a huge negative or positive usage.
+func GetTotalPowerUsageWh(meterID string, readingType MeterDbPowerReadingType, from int64, to int64) (uint32, error) {
+	return getUsage(
+		"total_power_readings", "watthour",
+		"reading_type = ?", []any{readingType},
+		meterID, from, to,
+	)
+}
+
+// Get the gas consumed between from and to (unix seconds) in dm3, across meter segments.
+func GetTotalGasUsageDM3(meterID string, from int64, to int64) (uint32, error) {
+	return getUsage(
+		"total_gas_readings", "consumption_dm3",
+		"1 = 1", nil,
+		meterID, from, to,
+	)
+}
+
+// Sum of (last value at to - last value at from) for every segment with data in the range.
+// When a segment starts within the range, its first value is the baseline.
+// Table, column and filter are never user input.
+func getUsage(
+	table string,
+	column string,
+	filter string,
+	filterArgs []any,
+	meterID string,
+	from int64,
+	to int64,
+) (uint32, error) {
+	db := GetDB()
+
+	type meterSegment struct {
+		meterID   string
+		segmentID int64
+	}
+
+	segmentArgs := append(append([]any{}, filterArgs...), meterID, meterID, from, to)
+	rows, err := db.Query(
+		"SELECT DISTINCT meter_id, segment_id FROM "+table+
+			" WHERE "+filter+" AND "+meterFilter+" AND timestamp BETWEEN ? AND ?",
+		segmentArgs...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	segments := make([]meterSegment, 0)
+	for rows.Next() {
+		var segment meterSegment
+		if err := rows.Scan(&segment.meterID, &segment.segmentID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		segments = append(segments, segment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var usage uint32
+	for _, segment := range segments {
+		args := append(append([]any{}, filterArgs...), segment.meterID, segment.segmentID)
+
+		var end uint32
+		err := db.QueryRow(
+			"SELECT "+column+" FROM "+table+
+				" WHERE "+filter+" AND meter_id = ? AND segment_id = ? AND timestamp <= ?"+
+				" ORDER BY timestamp DESC LIMIT 1",
+			append(args, to)...,
+		).Scan(&end)
+		if err != nil {
+			return 0, err
+		}
+
+		var start uint32
+		err = db.QueryRow(
+			"SELECT "+column+" FROM "+table+
+				" WHERE "+filter+" AND meter_id = ? AND segment_id = ? AND timestamp <= ?"+
+				" ORDER BY timestamp DESC LIMIT 1",
+			append(args, from)...,
+		).Scan(&start)
+		if err == sql.ErrNoRows {
+			// Segment started within the range
+			err = db.QueryRow(
+				"SELECT "+column+" FROM "+table+
+					" WHERE "+filter+" AND meter_id = ? AND segment_id = ? AND timestamp >= ?"+
+					" ORDER BY timestamp ASC LIMIT 1",
+				append(args, from)...,
+			).Scan(&start)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if end > start {
+			usage += end - start
+		}
+	}
+	return usage, nil
+}
+
+// Get the energy counted by a power register per hour between from and to (unix seconds).
+// Keys are the unix timestamp the hour starts at. Each increase of the register
+// is attributed to the hour it was stored in. Only looks back a week for the
+// previous value of a register, older baselines are ignored.
+func GetPowerUsageByHour(meterID string, readingType MeterDbPowerReadingType, from int64, to int64) (map[int64]uint32, error) {
+	db := GetDB()
+
+	rows, err := db.Query(
+		"SELECT (timestamp / 3600) * 3600 AS hour, SUM(delta) FROM ("+
+			"SELECT timestamp, watthour - LAG(watthour) OVER "+
+			"(PARTITION BY meter_id, segment_id ORDER BY timestamp) AS delta "+
+			"FROM total_power_readings "+
+			"WHERE reading_type = ? AND "+meterFilter+" AND timestamp BETWEEN ? AND ?"+
+			") WHERE timestamp >= ? AND delta > 0 GROUP BY hour",
+		readingType, meterID, meterID, from-7*24*3600, to, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := map[int64]uint32{}
+	for rows.Next() {
+		var hour int64
+		var wh uint32
+		if err := rows.Scan(&hour, &wh); err != nil {
+			return nil, err
+		}
+		usage[hour] = wh
+	}
+	return usage, rows.Err()
+}
+
+// Get the highest 15 minute average import power per meter between from and to (unix seconds),
+// as used for capacity tariffs.
+func GetQuarterHourImportPeaks(meterID string, from int64, to int64) (map[string]uint32, error) {
+	db := GetDB()
+
+	rows, err := db.Query(
+		"SELECT meter_id, MAX(average_watt) FROM ("+
+			"SELECT meter_id, AVG(import_watt) AS average_watt FROM live_power_history "+
+			"WHERE "+meterFilter+" AND timestamp BETWEEN ? AND ? "+
+			"GROUP BY meter_id, timestamp / 900"+
+			") GROUP BY meter_id",
+		meterID, meterID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	peaks := map[string]uint32{}
+	for rows.Next() {
+		var peakMeterID string
+		var averageWatt float64
+		if err := rows.Scan(&peakMeterID, &averageWatt); err != nil {
+			return nil, err
+		}
+		peaks[peakMeterID] = uint32(averageWatt)
+	}
+	return peaks, rows.Err()
+}
@@ -0,0 +1,227 @@
+// Minimal Modbus TCP server exposing a register bank.
+// Serves the inverter simulator, which stands in for a solar inverter when no hardware
+// is available, and the virtual meter, which exposes the P1 readings to inverters.
+// Clients may write registers unless the server is read-only, like a real meter.
+// Holding and input registers share the same bank, reads of registers
+// that were never set fail with an illegal data address exception.
+package modbusserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sync"
+)
+
+const (
+	funcReadHoldingRegisters   = 0x03
+	funcReadInputRegisters     = 0x04
+	funcWriteSingleRegister    = 0x06
+	funcWriteMultipleRegisters = 0x10
+
+	exceptionIllegalFunction    = 0x01
+	exceptionIllegalDataAddress = 0x02
+	exceptionIllegalDataValue   = 0x03
+	exceptionGatewayNoResponse  = 0x0B
+
+	maxReadQuantity  = 125
+	maxWriteQuantity = 123
+)
+
+type Server struct {
+	mutex     sync.RWMutex
+	registers map[uint16]uint16
+	offline   bool
+	readOnly  bool
+}
+
+func NewServer() *Server {
+	return &Server{registers: map[uint16]uint16{}}
+}
+
+// Set consecutive registers starting at start.
+func (s *Server) SetRegisters(start uint16, values ...uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, value := range values {
+		s.registers[start+uint16(i)] = value
+	}
+}
+
+// Set a 32 bit value over two registers, high word first.
+func (s *Server) SetUint32(start uint16, value uint32) {
+	s.SetRegisters(start, uint16(value>>16), uint16(value))
+}
+
+// Set a 32 bit float over two registers, high word first.
+func (s *Server) SetFloat32(start uint16, value float32) {
+	s.SetUint32(start, math.Float32bits(value))
+}
+
+// Set an ASCII string over length registers, padded with zeros.
+func (s *Server) SetString(start uint16, length int, value string) {
+	data := make([]byte, length*2)
+	copy(data, value)
+	values := make([]uint16, length)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	s.SetRegisters(start, values...)
+}
+
+// While offline every request fails with a gateway target device failed to respond exception,
+// eg. so a device relying on the values notices they are no longer updated.
+func (s *Server) SetOffline(offline bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.offline = offline
+}
+
+func (s *Server) isOffline() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.offline
+}
+
+// While read-only writes fail with an illegal function exception, like on devices that only report values.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.readOnly = readOnly
+}
+
+func (s *Server) isReadOnly() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.readOnly
+}
+
+// Get consecutive registers, false when any of them was never set.
+func (s *Server) Registers(start uint16, quantity uint16) ([]uint16, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	values := make([]uint16, quantity)
+	for i := range values {
+		value, ok := s.registers[start+uint16(i)]
+		if !ok {
+			return nil, false
+		}
+		values[i] = value
+	}
+	return values, true
+}
+
+// Accept connections until the listener is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// MBAP header: transaction id, protocol id, length, unit id, followed by the PDU.
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Modbus connection from %s closed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		length := binary.BigEndian.Uint16(header[4:])
+		if length < 2 || length > 254 {
+			log.Printf("Invalid Modbus frame length %d from %s", length, conn.RemoteAddr())
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		response := s.handlePDU(pdu)
+		frame := make([]byte, 7, 7+len(response))
+		copy(frame, header[:4])
+		binary.BigEndian.PutUint16(frame[4:], uint16(len(response)+1))
+		frame[6] = header[6]
+		if _, err := conn.Write(append(frame, response...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handlePDU(pdu []byte) []byte {
+	function := pdu[0]
+	if s.isOffline() {
+		return exception(function, exceptionGatewayNoResponse)
+	}
+	if (function == funcWriteSingleRegister || function == funcWriteMultipleRegisters) && s.isReadOnly() {
+		return exception(function, exceptionIllegalFunction)
+	}
+	if len(pdu) < 5 {
+		return exception(function, exceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(pdu[1:])
+
+	switch function {
+	case funcReadHoldingRegisters, funcReadInputRegisters:
+		quantity := binary.BigEndian.Uint16(pdu[3:])
+		if quantity == 0 || quantity > maxReadQuantity {
+			return exception(function, exceptionIllegalDataValue)
+		}
+		values, ok := s.Registers(start, quantity)
+		if !ok {
+			return exception(function, exceptionIllegalDataAddress)
+		}
+		response := []byte{function, byte(quantity * 2)}
+		for _, value := range values {
+			response = binary.BigEndian.AppendUint16(response, value)
+		}
+		return response
+
+	case funcWriteSingleRegister:
+		if _, ok := s.Registers(start, 1); !ok {
+			return exception(function, exceptionIllegalDataAddress)
+		}
+		s.SetRegisters(start, binary.BigEndian.Uint16(pdu[3:]))
+		return pdu[:5]
+
+	case funcWriteMultipleRegisters:
+		quantity := binary.BigEndian.Uint16(pdu[3:])
+		if quantity == 0 || quantity > maxWriteQuantity || len(pdu) < 6+int(quantity)*2 {
+			return exception(function, exceptionIllegalDataValue)
+		}
+		if _, ok := s.Registers(start, quantity); !ok {
+			return exception(function, exceptionIllegalDataAddress)
+		}
+		values := make([]uint16, quantity)
+		for i := range values {
+			values[i] = binary.BigEndian.Uint16(pdu[6+i*2:])
+		}
+		s.SetRegisters(start, values...)
+		return pdu[:5]
+	}
+	return exception(function, exceptionIllegalFunction)
+}
+
+func exception(function byte, code byte) []byte {
+	return []byte{function | 0x80, code}
+}
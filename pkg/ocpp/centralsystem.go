@@ -0,0 +1,367 @@
+package ocpp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrChargePointNotConnected = errors.New("charge point not connected")
+
+// Heartbeat interval sent to charge points in the BootNotification response
+const heartbeatIntervalSeconds = 300
+
+// Minimal OCPP 1.6J central system accepting wallbox connections on /ocpp/{chargePointId}.
+// Every id tag is authorized, charge points are limited by their id and password.
+type CentralSystem struct {
+	// Charge point ids allowed to connect, empty allows any
+	allowedIDs []string
+	// Basic auth password by charge point id (OCPP 1.6 security profile 1), none requires no authentication
+	passwords map[string]string
+	upgrader  websocket.Upgrader
+
+	mutex        sync.RWMutex
+	chargePoints map[string]*chargePoint
+	// Transaction ids are unique while the process runs
+	nextTransactionID int
+}
+
+// State of a connected charge point as reported by itself.
+type ChargePointStatus struct {
+	ID          string             `json:"id"`
+	Vendor      string             `json:"vendor"`
+	Model       string             `json:"model"`
+	ConnectedAt time.Time          `json:"connected_at"`
+	LastSeenAt  time.Time          `json:"last_seen_at"`
+	Connectors  []*ConnectorStatus `json:"connectors"`
+}
+
+type ConnectorStatus struct {
+	ConnectorID   int    `json:"connector_id"`
+	Status        string `json:"status"`
+	ErrorCode     string `json:"error_code"`
+	TransactionID *int   `json:"transaction_id"`
+	IdTag         string `json:"id_tag,omitempty"`
+	// From MeterValues, nil when the charge point does not report them
+	PowerW           *float64   `json:"power_w"`
+	EnergyWh         *float64   `json:"energy_wh"`
+	MeterValuesAt    *time.Time `json:"meter_values_at"`
+	ChargingLimit    *float64   `json:"charging_limit"`
+	ChargingRateUnit string     `json:"charging_rate_unit,omitempty"`
+}
+
+type chargePoint struct {
+	conn   *Conn
+	status ChargePointStatus
+}
+
+func NewCentralSystem(allowedIDs []string, passwords map[string]string) *CentralSystem {
+	return &CentralSystem{
+		allowedIDs: allowedIDs,
+		passwords:  passwords,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{Subprotocol},
+			CheckOrigin:  func(r *http.Request) bool { return true },
+		},
+		chargePoints: map[string]*chargePoint{},
+	}
+}
+
+// Accept a charge point, the id is the last element of the path.
+func (cs *CentralSystem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if id == "" {
+		http.Error(w, "Charge point id missing from path", http.StatusNotFound)
+		return
+	}
+	if len(cs.allowedIDs) > 0 && !slices.Contains(cs.allowedIDs, id) {
+		log.Printf("Rejected unknown charge point %q", id)
+		http.Error(w, "Unknown charge point", http.StatusNotFound)
+		return
+	}
+	if !cs.isAuthenticated(id, r) {
+		log.Printf("Rejected charge point %q with invalid credentials", id)
+		w.Header().Set("WWW-Authenticate", `Basic realm="OCPP"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !slices.Contains(websocket.Subprotocols(r), Subprotocol) {
+		http.Error(w, "Only "+Subprotocol+" is supported", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := cs.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Charge point %s websocket upgrade failed: %v", id, err)
+		return
+	}
+
+	now := time.Now()
+	cp := &chargePoint{status: ChargePointStatus{ID: id, ConnectedAt: now, LastSeenAt: now}}
+	cp.conn = NewConn(ws, func(action string, payload json.RawMessage) (any, error) {
+		return cs.handleCall(cp, action, payload)
+	})
+
+	cs.mutex.Lock()
+	if previous, ok := cs.chargePoints[id]; ok {
+		// Charge points reconnect without closing the old connection after network trouble
+		previous.conn.Close()
+	}
+	cs.chargePoints[id] = cp
+	cs.mutex.Unlock()
+	log.Printf("Charge point %s connected", id)
+
+	err = cp.conn.Serve()
+
+	cs.mutex.Lock()
+	if cs.chargePoints[id] == cp {
+		delete(cs.chargePoints, id)
+	}
+	cs.mutex.Unlock()
+	log.Printf("Charge point %s disconnected: %v", id, err)
+}
+
+// Basic auth with the charge point id as username, once any password is configured.
+func (cs *CentralSystem) isAuthenticated(id string, r *http.Request) bool {
+	if len(cs.passwords) == 0 {
+		return true
+	}
+	expected, ok := cs.passwords[id]
+	username, password, hasAuth := r.BasicAuth()
+	if !ok || expected == "" || !hasAuth || username != id {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+func (cs *CentralSystem) handleCall(cp *chargePoint, action string, payload json.RawMessage) (any, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	now := time.Now()
+	cp.status.LastSeenAt = now
+
+	switch action {
+	case "BootNotification":
+		var request BootNotificationRequest
+		if err := DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		cp.status.Vendor, cp.status.Model = request.ChargePointVendor, request.ChargePointModel
+		return &BootNotificationResponse{Status: "Accepted", CurrentTime: now.UTC(), Interval: heartbeatIntervalSeconds}, nil
+
+	case "Heartbeat":
+		return &HeartbeatResponse{CurrentTime: now.UTC()}, nil
+
+	case "StatusNotification":
+		var request StatusNotificationRequest
+		if err := DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		connector := cp.connector(request.ConnectorID)
+		connector.Status, connector.ErrorCode = request.Status, request.ErrorCode
+		return &StatusNotificationResponse{}, nil
+
+	case "Authorize":
+		var request AuthorizeRequest
+		if err := DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		return &AuthorizeResponse{IdTagInfo: IdTagInfo{Status: "Accepted"}}, nil
+
+	case "StartTransaction":
+		var request StartTransactionRequest
+		if err := DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		cs.nextTransactionID++
+		transactionID := cs.nextTransactionID
+		connector := cp.connector(request.ConnectorID)
+		connector.TransactionID, connector.IdTag = &transactionID, request.IdTag
+		meterStart := float64(request.MeterStart)
+		connector.EnergyWh = &meterStart
+		return &StartTransactionResponse{IdTagInfo: IdTagInfo{Status: "Accepted"}, TransactionID: transactionID}, nil
+
+	case "StopTransaction":
+		var request StopTransactionRequest
+		if err := DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		for _, connector := range cp.status.Connectors {
+			if connector.TransactionID != nil && *connector.TransactionID == request.TransactionID {
+				connector.TransactionID, connector.IdTag, connector.PowerW = nil, "", nil
+			}
+		}
+		return &StopTransactionResponse{}, nil
+
+	case "MeterValues":
+		var request MeterValuesRequest
+		if err := DecodePayload(payload, &request); err != nil {
+			return nil, err
+		}
+		cp.connector(request.ConnectorID).applyMeterValues(request.MeterValue)
+		return &MeterValuesResponse{}, nil
+
+	case "DataTransfer":
+		return map[string]string{"status": "UnknownVendorId"}, nil
+	}
+	return nil, &CallError{Code: ErrorCodeNotImplemented, Description: action + " is not supported"}
+}
+
+// Connector by id, added on first use. Must be called with the mutex held.
+func (cp *chargePoint) connector(id int) *ConnectorStatus {
+	for _, connector := range cp.status.Connectors {
+		if connector.ConnectorID == id {
+			return connector
+		}
+	}
+	connector := &ConnectorStatus{ConnectorID: id}
+	cp.status.Connectors = append(cp.status.Connectors, connector)
+	slices.SortFunc(cp.status.Connectors, func(a, b *ConnectorStatus) int { return a.ConnectorID - b.ConnectorID })
+	return connector
+}
+
+// Keep the latest power and energy register.
+// Power reported per phase is summed unless the total is reported as well.
+func (c *ConnectorStatus) applyMeterValues(meterValues []MeterValue) {
+	for _, meterValue := range meterValues {
+		var powerW, phasePowerW, energyWh float64
+		var hasPower, hasPhasePower, hasEnergy bool
+		for _, sampled := range meterValue.SampledValue {
+			value, err := strconv.ParseFloat(sampled.Value, 64)
+			if err != nil {
+				continue
+			}
+			if strings.HasPrefix(sampled.Unit, "k") {
+				value *= 1000
+			}
+			switch sampled.Measurand {
+			case MeasurandPowerActiveImport:
+				if sampled.Phase == "" {
+					powerW, hasPower = value, true
+				} else {
+					phasePowerW += value
+					hasPhasePower = true
+				}
+			case MeasurandEnergyActiveImportRegister, "":
+				if sampled.Phase == "" {
+					energyWh, hasEnergy = value, true
+				}
+			}
+		}
+		if !hasPower && hasPhasePower {
+			powerW, hasPower = phasePowerW, true
+		}
+		if hasPower {
+			c.PowerW = &powerW
+		}
+		if hasEnergy {
+			c.EnergyWh = &energyWh
+		}
+		if hasPower || hasEnergy {
+			at := meterValue.Timestamp
+			if at.IsZero() {
+				at = time.Now()
+			}
+			c.MeterValuesAt = &at
+		}
+	}
+}
+
+// Status of all connected charge points, sorted by id.
+func (cs *CentralSystem) ChargePoints() []ChargePointStatus {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	statuses := make([]ChargePointStatus, 0, len(cs.chargePoints))
+	for _, cp := range cs.chargePoints {
+		status := cp.status
+		status.Connectors = make([]*ConnectorStatus, 0, len(cp.status.Connectors))
+		for _, connector := range cp.status.Connectors {
+			copied := *connector
+			status.Connectors = append(status.Connectors, &copied)
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b ChargePointStatus) int { return strings.Compare(a.ID, b.ID) })
+	return statuses
+}
+
+// Send a charging profile to a connected charge point.
+// An empty id selects the only connected charge point.
+func (cs *CentralSystem) SetChargingProfile(id string, request *SetChargingProfileRequest) (*SetChargingProfileResponse, error) {
+	cp, err := cs.chargePoint(id)
+	if err != nil {
+		return nil, err
+	}
+	var response SetChargingProfileResponse
+	if err := cp.conn.Call("SetChargingProfile", request, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Status == ChargingProfileStatusAccepted && len(request.CSChargingProfiles.ChargingSchedule.ChargingSchedulePeriod) > 0 {
+		cs.mutex.Lock()
+		limit := request.CSChargingProfiles.ChargingSchedule.ChargingSchedulePeriod[0].Limit
+		connectors := cp.status.Connectors
+		if request.ConnectorID != 0 {
+			connectors = []*ConnectorStatus{cp.connector(request.ConnectorID)}
+		}
+		for _, connector := range connectors {
+			connector.ChargingLimit = &limit
+			connector.ChargingRateUnit = request.CSChargingProfiles.ChargingSchedule.ChargingRateUnit
+		}
+		cs.mutex.Unlock()
+	}
+	return &response, nil
+}
+
+// Charging power of a connector from the charge point's own meter,
+// false when it was not reported within maxAge.
+func (cs *CentralSystem) ConnectorPowerW(id string, connectorID int, maxAge time.Duration) (float64, bool) {
+	cp, err := cs.chargePoint(id)
+	if err != nil {
+		return 0, false
+	}
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	var powerW float64
+	found := false
+	for _, connector := range cp.status.Connectors {
+		// Connector 0 stands for the whole charge point, sum the actual connectors
+		if (connectorID != 0 && connector.ConnectorID != connectorID) || (connectorID == 0 && connector.ConnectorID == 0) {
+			continue
+		}
+		if connector.PowerW == nil || connector.MeterValuesAt == nil || time.Since(*connector.MeterValuesAt) > maxAge {
+			continue
+		}
+		powerW += *connector.PowerW
+		found = true
+	}
+	return powerW, found
+}
+
+func (cs *CentralSystem) chargePoint(id string) (*chargePoint, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	if id != "" {
+		if cp, ok := cs.chargePoints[id]; ok {
+			return cp, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrChargePointNotConnected, id)
+	}
+	if len(cs.chargePoints) > 1 {
+		return nil, fmt.Errorf("%d charge points connected, select one by id", len(cs.chargePoints))
+	}
+	for _, cp := range cs.chargePoints {
+		return cp, nil
+	}
+	return nil, ErrChargePointNotConnected
+}
@@ -0,0 +1,215 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// OCPP-J message types, each message is a JSON array starting with the type.
+const (
+	messageTypeCall       = 2 // [2, id, action, payload]
+	messageTypeCallResult = 3 // [3, id, payload]
+	messageTypeCallError  = 4 // [4, id, code, description, details]
+
+	// Websocket subprotocol of OCPP 1.6J
+	Subprotocol = "ocpp1.6"
+
+	callTimeout = 30 * time.Second
+)
+
+// Error codes of CALLERROR messages.
+const (
+	ErrorCodeNotImplemented      = "NotImplemented"
+	ErrorCodeFormationViolation  = "FormationViolation"
+	ErrorCodeInternalError       = "InternalError"
+	ErrorCodeProtocolError       = "ProtocolError"
+	ErrorCodeGenericError        = "GenericError"
+	ErrorCodeSecurityError       = "SecurityError"
+	ErrorCodeNotSupported        = "NotSupported"
+	ErrorCodePropertyConstraint  = "PropertyConstraintViolation"
+	ErrorCodeOccurrenceViolation = "OccurenceConstraintViolation" // Spelled as in the specification
+	ErrorCodeTypeConstraint      = "TypeConstraintViolation"
+)
+
+var (
+	ErrConnectionClosed = errors.New("ocpp connection closed")
+	ErrCallTimeout      = errors.New("ocpp call timed out")
+)
+
+// CALLERROR received in response to a call, or returned by a handler to send one.
+type CallError struct {
+	Code        string
+	Description string
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// Handles a call from the other side, returning the response payload.
+// Returning a *CallError sends that error code, other errors are sent as InternalError.
+type CallHandler func(action string, payload json.RawMessage) (any, error)
+
+// Both sides of an OCPP-J websocket can send calls and must answer calls from the other side.
+type Conn struct {
+	ws      *websocket.Conn
+	handler CallHandler
+
+	writeMutex sync.Mutex
+	nextID     atomic.Uint64
+
+	pendingMutex sync.Mutex
+	pending      map[string]chan callResponse
+	closed       chan struct{}
+}
+
+type callResponse struct {
+	payload json.RawMessage
+	err     error
+}
+
+func NewConn(ws *websocket.Conn, handler CallHandler) *Conn {
+	return &Conn{
+		ws:      ws,
+		handler: handler,
+		pending: map[string]chan callResponse{},
+		closed:  make(chan struct{}),
+	}
+}
+
+// Send a call and decode the result into response, which may be nil.
+func (c *Conn) Call(action string, request any, response any) error {
+	id := strconv.FormatUint(c.nextID.Add(1), 10)
+	result := make(chan callResponse, 1)
+	c.pendingMutex.Lock()
+	c.pending[id] = result
+	c.pendingMutex.Unlock()
+	defer func() {
+		c.pendingMutex.Lock()
+		delete(c.pending, id)
+		c.pendingMutex.Unlock()
+	}()
+
+	if err := c.write([]any{messageTypeCall, id, action, request}); err != nil {
+		return err
+	}
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return r.err
+		}
+		if response == nil {
+			return nil
+		}
+		return json.Unmarshal(r.payload, response)
+	case <-c.closed:
+		return ErrConnectionClosed
+	case <-time.After(callTimeout):
+		return fmt.Errorf("%w: %s", ErrCallTimeout, action)
+	}
+}
+
+// Read messages until the connection fails, answering calls with the handler.
+// Calls are handled one at a time, as OCPP allows a single call in progress per direction.
+func (c *Conn) Serve() error {
+	defer func() {
+		close(c.closed)
+		c.ws.Close()
+	}()
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var message []json.RawMessage
+		if err := json.Unmarshal(data, &message); err != nil || len(message) < 3 {
+			// Without a message id there is nothing to respond to
+			continue
+		}
+		var messageType int
+		var id string
+		if json.Unmarshal(message[0], &messageType) != nil || json.Unmarshal(message[1], &id) != nil {
+			continue
+		}
+
+		switch messageType {
+		case messageTypeCall:
+			if len(message) < 4 {
+				c.writeError(id, &CallError{Code: ErrorCodeFormationViolation, Description: "call without payload"})
+				continue
+			}
+			var action string
+			json.Unmarshal(message[2], &action)
+			c.handleCall(id, action, message[3])
+		case messageTypeCallResult:
+			c.resolve(id, callResponse{payload: message[2]})
+		case messageTypeCallError:
+			callErr := &CallError{}
+			json.Unmarshal(message[2], &callErr.Code)
+			if len(message) > 3 {
+				json.Unmarshal(message[3], &callErr.Description)
+			}
+			c.resolve(id, callResponse{err: callErr})
+		}
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *Conn) handleCall(id string, action string, payload json.RawMessage) {
+	response, err := c.handler(action, payload)
+	if err != nil {
+		var callErr *CallError
+		if !errors.As(err, &callErr) {
+			callErr = &CallError{Code: ErrorCodeInternalError, Description: err.Error()}
+		}
+		c.writeError(id, callErr)
+		return
+	}
+	c.write([]any{messageTypeCallResult, id, response})
+}
+
+func (c *Conn) writeError(id string, callErr *CallError) error {
+	return c.write([]any{messageTypeCallError, id, callErr.Code, callErr.Description, struct{}{}})
+}
+
+// Hand the response to the waiting call. Each id is resolved once, responses to unknown
+// or already answered ids are dropped so a misbehaving charge point can not block the reader.
+func (c *Conn) resolve(id string, response callResponse) {
+	c.pendingMutex.Lock()
+	result, ok := c.pending[id]
+	delete(c.pending, id)
+	c.pendingMutex.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case result <- response:
+	default:
+	}
+}
+
+func (c *Conn) write(message []any) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.ws.WriteJSON(message)
+}
+
+// Decode the payload of a call, failing with a FormationViolation.
+func DecodePayload(payload json.RawMessage, request any) error {
+	if err := json.Unmarshal(payload, request); err != nil {
+		return &CallError{Code: ErrorCodeFormationViolation, Description: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// OCPP 1.6J messages used for smart charging.
+package ocpp
+
+import "time"
+
+const (
+	ChargingRateUnitW = "W"
+	ChargingRateUnitA = "A"
+
+	ChargingProfilePurposeTxDefault = "TxDefaultProfile"
+	ChargingProfilePurposeTx        = "TxProfile"
+	ChargingProfilePurposeMax       = "ChargePointMaxProfile"
+
+	ChargingProfileKindAbsolute  = "Absolute"
+	ChargingProfileKindRecurring = "Recurring"
+	ChargingProfileKindRelative  = "Relative"
+
+	ChargingProfileStatusAccepted     = "Accepted"
+	ChargingProfileStatusRejected     = "Rejected"
+	ChargingProfileStatusNotSupported = "NotSupported"
+)
+
+type SetChargingProfileRequest struct {
+	// 0 applies the profile to the whole charge point
+	ConnectorID        int             `json:"connectorId"`
+	CSChargingProfiles ChargingProfile `json:"csChargingProfiles"`
+}
+
+type SetChargingProfileResponse struct {
+	Status string `json:"status"`
+}
+
+type ChargingProfile struct {
+	ChargingProfileID      int              `json:"chargingProfileId"`
+	TransactionID          *int             `json:"transactionId,omitempty"`
+	StackLevel             int              `json:"stackLevel"`
+	ChargingProfilePurpose string           `json:"chargingProfilePurpose"`
+	ChargingProfileKind    string           `json:"chargingProfileKind"`
+	ValidFrom              *time.Time       `json:"validFrom,omitempty"`
+	ValidTo                *time.Time       `json:"validTo,omitempty"`
+	ChargingSchedule       ChargingSchedule `json:"chargingSchedule"`
+}
+
+type ChargingSchedule struct {
+	Duration               *int                     `json:"duration,omitempty"` // Seconds
+	StartSchedule          *time.Time               `json:"startSchedule,omitempty"`
+	ChargingRateUnit       string                   `json:"chargingRateUnit"`
+	ChargingSchedulePeriod []ChargingSchedulePeriod `json:"chargingSchedulePeriod"`
+	MinChargingRate        *float64                 `json:"minChargingRate,omitempty"`
+}
+
+type ChargingSchedulePeriod struct {
+	StartPeriod  int     `json:"startPeriod"` // Seconds from the start of the schedule
+	Limit        float64 `json:"limit"`       // In the charging rate unit, one decimal
+	NumberPhases *int    `json:"numberPhases,omitempty"`
+}
+
+// Core profile messages sent by the charge point.
+
+type BootNotificationRequest struct {
+	ChargePointVendor       string `json:"chargePointVendor"`
+	ChargePointModel        string `json:"chargePointModel"`
+	ChargePointSerialNumber string `json:"chargePointSerialNumber,omitempty"`
+	FirmwareVersion         string `json:"firmwareVersion,omitempty"`
+}
+
+type BootNotificationResponse struct {
+	Status      string    `json:"status"` // Accepted, Pending or Rejected
+	CurrentTime time.Time `json:"currentTime"`
+	Interval    int       `json:"interval"` // Heartbeat interval in seconds
+}
+
+type HeartbeatRequest struct{}
+
+type HeartbeatResponse struct {
+	CurrentTime time.Time `json:"currentTime"`
+}
+
+type StatusNotificationRequest struct {
+	ConnectorID int        `json:"connectorId"`
+	ErrorCode   string     `json:"errorCode"`
+	Status      string     `json:"status"` // Available, Preparing, Charging, SuspendedEV, SuspendedEVSE, Finishing, ...
+	Info        string     `json:"info,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+}
+
+type StatusNotificationResponse struct{}
+
+type IdTagInfo struct {
+	Status string `json:"status"` // Accepted, Blocked, Expired, Invalid or ConcurrentTx
+}
+
+type AuthorizeRequest struct {
+	IdTag string `json:"idTag"`
+}
+
+type AuthorizeResponse struct {
+	IdTagInfo IdTagInfo `json:"idTagInfo"`
+}
+
+type StartTransactionRequest struct {
+	ConnectorID int       `json:"connectorId"`
+	IdTag       string    `json:"idTag"`
+	MeterStart  int       `json:"meterStart"` // Wh
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type StartTransactionResponse struct {
+	IdTagInfo     IdTagInfo `json:"idTagInfo"`
+	TransactionID int       `json:"transactionId"`
+}
+
+type StopTransactionRequest struct {
+	TransactionID int       `json:"transactionId"`
+	IdTag         string    `json:"idTag,omitempty"`
+	MeterStop     int       `json:"meterStop"` // Wh
+	Timestamp     time.Time `json:"timestamp"`
+	Reason        string    `json:"reason,omitempty"`
+}
+
+type StopTransactionResponse struct {
+	IdTagInfo *IdTagInfo `json:"idTagInfo,omitempty"`
+}
+
+type MeterValuesRequest struct {
+	ConnectorID   int          `json:"connectorId"`
+	TransactionID *int         `json:"transactionId,omitempty"`
+	MeterValue    []MeterValue `json:"meterValue"`
+}
+
+type MeterValuesResponse struct{}
+
+type MeterValue struct {
+	Timestamp    time.Time      `json:"timestamp"`
+	SampledValue []SampledValue `json:"sampledValue"`
+}
+
+// Value is a decimal string, measurand defaults to Energy.Active.Import.Register in Wh.
+type SampledValue struct {
+	Value     string `json:"value"`
+	Measurand string `json:"measurand,omitempty"`
+	Phase     string `json:"phase,omitempty"`
+	Unit      string `json:"unit,omitempty"`
+}
+
+const (
+	MeasurandEnergyActiveImportRegister = "Energy.Active.Import.Register"
+	MeasurandPowerActiveImport          = "Power.Active.Import"
+	MeasurandCurrentImport              = "Current.Import"
+)
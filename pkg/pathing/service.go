@@ -29,6 +29,11 @@ func GetMeterDbPath() string {
 	return filepath.Join(GetDataDir(), "esm-meter.db")
 }
 
+// Recent readings of the interpreter API, persisted across restarts
+func GetReadingBufferPath() string {
+	return filepath.Join(GetDataDir(), "reading-buffer.json")
+}
+
 func GetDataDir() string {
 	return "/var/lib/european_smart_meter"
 }
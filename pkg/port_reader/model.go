@@ -4,6 +4,7 @@ import (
 	"io"
 	"regexp"
 	"sync"
+	"time"
 
 	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
 )
@@ -13,8 +14,10 @@ type P1Reader struct {
 	baudrate      uint
 	serialPort    io.ReadWriteCloser
 	latestReading *interpreter.RawMeterReading
-	readingMutex  sync.RWMutex
-	stopSignal    bool
+	// When latestReading was received, in system time
+	latestReadingAt time.Time
+	readingMutex    sync.RWMutex
+	stopSignal      bool
 
 	// Pre-compiled regex patterns
 	obisPatterns    map[string]*regexp.Regexp
@@ -100,6 +100,7 @@ func (p *P1Reader) StartReading(
 			if reading := p.parseTelegram(telegram); reading != nil {
 				p.readingMutex.Lock()
 				p.latestReading = reading
+				p.latestReadingAt = time.Now()
 				p.readingMutex.Unlock()
 
 				go handleReading(reading)
@@ -124,6 +125,13 @@ func (p *P1Reader) GetLatestReading() *interpreter.RawMeterReading {
 	return p.latestReading
 }
 
+// When the latest reading was received, zero before the first reading.
+func (p *P1Reader) GetLatestReadingTime() time.Time {
+	p.readingMutex.RLock()
+	defer p.readingMutex.RUnlock()
+	return p.latestReadingAt
+}
+
 // Open the connection to the P1 port.
 func (p *P1Reader) connect() error {
 	options := serial.OpenOptions{
@@ -0,0 +1,135 @@
+// Keeps the most recent meter readings in memory so consumers
+// can catch up on readings they missed while disconnected.
+package readingbuffer
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+type bufferedReading struct {
+	Timestamp int64                        `json:"ts"`
+	Reading   *interpreter.RawMeterReading `json:"reading"`
+}
+
+// Fixed size ring buffer of readings ordered by arrival.
+type RingBuffer struct {
+	mu       sync.RWMutex
+	readings []bufferedReading
+	next     int
+	count    int
+}
+
+func NewRingBuffer(capacity int) *RingBuffer {
+	if capacity <= 0 {
+		capacity = 3600
+	}
+	return &RingBuffer{
+		readings: make([]bufferedReading, capacity),
+	}
+}
+
+// Add a reading, overwriting the oldest one when full.
+// Readings with an unparsable timestamp are ignored.
+func (b *RingBuffer) Add(reading *interpreter.RawMeterReading) {
+	ts, err := time.Parse(time.RFC3339, reading.Timestamp)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readings[b.next] = bufferedReading{Timestamp: ts.Unix(), Reading: reading}
+	b.next = (b.next + 1) % len(b.readings)
+	if b.count < len(b.readings) {
+		b.count++
+	}
+}
+
+// Get all buffered readings with a timestamp after since (unix seconds), oldest first.
+func (b *RingBuffer) Since(since int64) []*interpreter.RawMeterReading {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := make([]*interpreter.RawMeterReading, 0)
+	for _, buffered := range b.ordered() {
+		if buffered.Timestamp > since {
+			result = append(result, buffered.Reading)
+		}
+	}
+	return result
+}
+
+// Unix timestamp of the oldest buffered reading, 0 when empty.
+func (b *RingBuffer) OldestTimestamp() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.count == 0 {
+		return 0
+	}
+	return b.ordered()[0].Timestamp
+}
+
+func (b *RingBuffer) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.count
+}
+
+// Write the buffer contents to disk so it survives restarts.
+func (b *RingBuffer) SaveToFile(path string) error {
+	b.mu.RLock()
+	data, err := json.Marshal(b.ordered())
+	b.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// Write to temp file first so a crash never leaves a half written buffer
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Restore readings saved with SaveToFile.
+// A missing file is not an error, there is simply nothing to restore.
+func (b *RingBuffer) LoadFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var saved []bufferedReading
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	sort.SliceStable(saved, func(i, j int) bool {
+		return saved[i].Timestamp < saved[j].Timestamp
+	})
+	for _, buffered := range saved {
+		if buffered.Reading != nil {
+			b.Add(buffered.Reading)
+		}
+	}
+	return nil
+}
+
+// Buffered readings oldest first. Caller must hold the lock.
+func (b *RingBuffer) ordered() []bufferedReading {
+	result := make([]bufferedReading, 0, b.count)
+	start := (b.next - b.count + len(b.readings)) % len(b.readings)
+	for i := 0; i < b.count; i++ {
+		result = append(result, b.readings[(start+i)%len(b.readings)])
+	}
+	return result
+}
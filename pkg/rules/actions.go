@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+)
+
+const (
+	ActionWebhook = "webhook"
+	ActionMQTT    = "mqtt"
+	ActionExec    = "exec"
+
+	actionTimeout = 30 * time.Second
+)
+
+type action interface {
+	run(event *Event) error
+}
+
+func newAction(cfg config.RuleActionConfig) (action, error) {
+	switch cfg.Type {
+	case ActionWebhook:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook needs a url")
+		}
+		return &webhookAction{cfg: cfg}, nil
+	case ActionMQTT:
+		if cfg.Broker == "" || cfg.Topic == "" {
+			return nil, fmt.Errorf("mqtt needs a broker and topic")
+		}
+		return &mqttAction{cfg: cfg}, nil
+	case ActionExec:
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("exec needs a command")
+		}
+		return &execAction{cfg: cfg}, nil
+	}
+	return nil, fmt.Errorf("unknown action type %q", cfg.Type)
+}
+
+// Fill in the event placeholders of a template.
+func (e *Event) expand(template string) string {
+	return strings.NewReplacer(
+		"{rule}", e.Rule,
+		"{state}", e.State,
+		"{metric}", e.Metric,
+		"{operator}", e.Operator,
+		"{threshold}", strconv.FormatFloat(e.Threshold, 'f', -1, 64),
+		"{value}", strconv.FormatFloat(e.Value, 'f', -1, 64),
+		"{timestamp}", e.Timestamp.Format(time.RFC3339),
+	).Replace(template)
+}
+
+// Body template, or the event as JSON.
+func (e *Event) payload(template string) []byte {
+	if template != "" {
+		return []byte(e.expand(template))
+	}
+	data, _ := json.Marshal(e)
+	return data
+}
+
+type webhookAction struct {
+	cfg config.RuleActionConfig
+}
+
+var httpClient = &http.Client{Timeout: actionTimeout}
+
+func (w *webhookAction) run(event *Event) error {
+	method := w.cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	contentType := w.cfg.ContentType
+	if contentType == "" && w.cfg.Body == "" {
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(method, event.expand(w.cfg.URL), bytes.NewReader(event.payload(w.cfg.Body)))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type mqttAction struct {
+	cfg config.RuleActionConfig
+}
+
+func (m *mqttAction) run(event *Event) error {
+	return publishMQTT(m.cfg.Broker, m.cfg.Username, m.cfg.Password,
+		event.expand(m.cfg.Topic), event.payload(m.cfg.Body), m.cfg.Retain)
+}
+
+type execAction struct {
+	cfg config.RuleActionConfig
+}
+
+// The event is also passed in ESM_RULE_* environment variables.
+func (x *execAction) run(event *Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+
+	args := make([]string, len(x.cfg.Command))
+	for i, arg := range x.cfg.Command {
+		args[i] = event.expand(arg)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(cmd.Environ(),
+		"ESM_RULE_NAME="+event.Rule,
+		"ESM_RULE_STATE="+event.State,
+		"ESM_RULE_METRIC="+event.Metric,
+		"ESM_RULE_VALUE="+strconv.FormatFloat(event.Value, 'f', -1, 64),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
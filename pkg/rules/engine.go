@@ -0,0 +1,287 @@
+// Notification rules evaluated against the live readings, eg. "export > 3 kW for 10 minutes".
+// A rule fires once its condition held for for_seconds and recovers once it did not
+// for recover_seconds, running its actions on both transitions.
+package rules
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+const (
+	StateOK     = "ok"
+	StateFiring = "firing"
+	// Sent to actions when a firing rule no longer holds
+	StateRecovered = "recovered"
+
+	// Time based metrics such as telegram_age_seconds are checked without readings
+	evaluateInterval = time.Second
+	reloadInterval   = 5 * time.Second
+)
+
+var operators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// Event passed to the actions of a rule, sent as JSON by webhooks and MQTT.
+type Event struct {
+	Rule      string    `json:"rule"`
+	State     string    `json:"state"`
+	Metric    string    `json:"metric"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Since     time.Time `json:"since"` // When the condition started or stopped holding
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// State of a rule, as shown on /rules.
+type RuleStatus struct {
+	Name     string     `json:"name"`
+	Metric   string     `json:"metric"`
+	Operator string     `json:"operator"`
+	Value    float64    `json:"value"`
+	State    string     `json:"state"`
+	Current  *float64   `json:"current"` // nil while the metric is unknown
+	Since    *time.Time `json:"since"`   // When the rule fired, nil when ok
+}
+
+type Engine struct {
+	mutex   sync.Mutex
+	rules   []*rule
+	actions map[string]action
+	metrics *metrics
+	// Called with every event besides the actions, eg. to stream it to clients
+	onEvent func(event *Event)
+}
+
+type rule struct {
+	cfg     config.RuleConfig
+	compare func(a, b float64) bool
+	actions []action
+
+	firing bool
+	// Start of the current run of the condition holding or not holding
+	changedAt time.Time
+	holding   bool
+	firedAt   time.Time
+	value     *float64
+}
+
+func NewEngine(cfg *config.RulesConfig) (*Engine, error) {
+	engine := &Engine{metrics: newMetrics(time.Now())}
+	if err := engine.SetRules(cfg); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Replace the rules and actions. Rules that kept their name and condition keep their state,
+// so a reload does not fire them again. An edited condition starts over.
+func (e *Engine) SetRules(cfg *config.RulesConfig) error {
+	actions := map[string]action{}
+	for _, actionCfg := range cfg.Actions {
+		a, err := newAction(actionCfg)
+		if err != nil {
+			return fmt.Errorf("action %q: %w", actionCfg.Name, err)
+		}
+		actions[actionCfg.Name] = a
+	}
+
+	rules := make([]*rule, 0, len(cfg.Rules))
+	for _, ruleCfg := range cfg.Rules {
+		if !ruleCfg.Enabled {
+			continue
+		}
+		compare, ok := operators[ruleCfg.Operator]
+		if !ok {
+			return fmt.Errorf("rule %q: unknown operator %q", ruleCfg.Name, ruleCfg.Operator)
+		}
+		r := &rule{cfg: ruleCfg, compare: compare}
+		for _, name := range ruleCfg.Actions {
+			a, ok := actions[name]
+			if !ok {
+				return fmt.Errorf("rule %q: unknown action %q", ruleCfg.Name, name)
+			}
+			r.actions = append(r.actions, a)
+		}
+		rules = append(rules, r)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, r := range rules {
+		i := slices.IndexFunc(e.rules, func(old *rule) bool { return old.cfg.Name == r.cfg.Name })
+		if i >= 0 && sameCondition(&e.rules[i].cfg, &r.cfg) {
+			old := e.rules[i]
+			r.firing, r.changedAt, r.holding, r.firedAt = old.firing, old.changedAt, old.holding, old.firedAt
+		}
+	}
+	e.rules = rules
+	e.actions = actions
+	return nil
+}
+
+func sameCondition(a, b *config.RuleConfig) bool {
+	return a.Metric == b.Metric && a.Operator == b.Operator && a.Value == b.Value &&
+		a.ForSeconds == b.ForSeconds && a.RecoverSeconds == b.RecoverSeconds
+}
+
+// Set a function called with every event, it must not block.
+func (e *Engine) SetEventHandler(handler func(event *Event)) {
+	e.mutex.Lock()
+	e.onEvent = handler
+	e.mutex.Unlock()
+}
+
+// Evaluate the rules with a new reading.
+func (e *Engine) HandleReading(reading *interpreter.RawMeterReading) {
+	now := time.Now()
+	e.mutex.Lock()
+	e.metrics.update(reading, now)
+	e.mutex.Unlock()
+	e.evaluate(now)
+}
+
+// Evaluate every second and reload the rules when the file at path changes.
+func (e *Engine) Run(path string) {
+	lastModified := modTime(path)
+	evaluateTicker := time.NewTicker(evaluateInterval)
+	defer evaluateTicker.Stop()
+	reloadTicker := time.NewTicker(reloadInterval)
+	defer reloadTicker.Stop()
+	for {
+		select {
+		case now := <-evaluateTicker.C:
+			e.evaluate(now)
+		case <-reloadTicker.C:
+			modified := modTime(path)
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			if err := config.LoadRulesConfig(); err != nil {
+				log.Printf("Failed to reload rules, keeping the previous rules: %v", err)
+				continue
+			}
+			if err := e.SetRules(config.ActiveRulesConfig); err != nil {
+				log.Printf("Failed to reload rules, keeping the previous rules: %v", err)
+				continue
+			}
+			log.Printf("Reloaded %d rules", len(e.Status()))
+		}
+	}
+}
+
+func (e *Engine) evaluate(now time.Time) {
+	e.mutex.Lock()
+	var events []*Event
+	var eventActions [][]action
+	for _, r := range e.rules {
+		if event := r.evaluate(e.metrics, now); event != nil {
+			events = append(events, event)
+			eventActions = append(eventActions, r.actions)
+		}
+	}
+	onEvent := e.onEvent
+	e.mutex.Unlock()
+
+	// Actions may be slow, they never hold up the readings
+	for i, event := range events {
+		log.Printf("Rule %q %s: %s = %g", event.Rule, event.State, event.Metric, event.Value)
+		if onEvent != nil {
+			onEvent(event)
+		}
+		for _, a := range eventActions[i] {
+			go func() {
+				if err := a.run(event); err != nil {
+					log.Printf("Rule %q action failed: %v", event.Rule, err)
+				}
+			}()
+		}
+	}
+}
+
+// Advance the state of the rule, returning an event when it fired or recovered.
+func (r *rule) evaluate(m *metrics, now time.Time) *Event {
+	value, ok := m.get(r.cfg.Metric, now)
+	if !ok {
+		r.value = nil
+		return nil
+	}
+	r.value = &value
+
+	holding := r.compare(value, r.cfg.Value)
+	if holding != r.holding || r.changedAt.IsZero() {
+		r.holding = holding
+		r.changedAt = now
+	}
+	duration := now.Sub(r.changedAt)
+
+	event := &Event{
+		Rule:      r.cfg.Name,
+		Metric:    r.cfg.Metric,
+		Operator:  r.cfg.Operator,
+		Threshold: r.cfg.Value,
+		Value:     value,
+		Since:     r.changedAt,
+		Timestamp: now,
+	}
+	switch {
+	case !r.firing && holding && duration >= time.Duration(r.cfg.ForSeconds)*time.Second:
+		r.firing = true
+		r.firedAt = now
+		event.State = StateFiring
+		return event
+	case r.firing && !holding && duration >= time.Duration(r.cfg.RecoverSeconds)*time.Second:
+		r.firing = false
+		if !r.cfg.NotifyRecovery {
+			return nil
+		}
+		event.State = StateRecovered
+		return event
+	}
+	return nil
+}
+
+func (e *Engine) Status() []RuleStatus {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	statuses := make([]RuleStatus, 0, len(e.rules))
+	for _, r := range e.rules {
+		status := RuleStatus{
+			Name:     r.cfg.Name,
+			Metric:   r.cfg.Metric,
+			Operator: r.cfg.Operator,
+			Value:    r.cfg.Value,
+			State:    StateOK,
+			Current:  r.value,
+		}
+		if r.firing {
+			firedAt := r.firedAt
+			status.State, status.Since = StateFiring, &firedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
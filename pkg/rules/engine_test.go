@@ -0,0 +1,32 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+)
+
+func TestSetRulesKeepsStateOfUnchangedRules(t *testing.T) {
+	exportRule := config.RuleConfig{Name: "export", Enabled: true, Metric: "export_kw", Operator: ">", Value: 3}
+	engine, err := NewEngine(&config.RulesConfig{Rules: []config.RuleConfig{exportRule}})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	engine.rules[0].firing = true
+
+	if err := engine.SetRules(&config.RulesConfig{Rules: []config.RuleConfig{exportRule}}); err != nil {
+		t.Fatalf("SetRules: %v", err)
+	}
+	if !engine.rules[0].firing {
+		t.Error("unchanged rule lost its state on reload")
+	}
+
+	edited := exportRule
+	edited.Value = 5
+	if err := engine.SetRules(&config.RulesConfig{Rules: []config.RuleConfig{edited}}); err != nil {
+		t.Fatalf("SetRules: %v", err)
+	}
+	if engine.rules[0].firing {
+		t.Error("rule with an edited threshold kept the state of its old condition")
+	}
+}
@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+// Gas meters report a new total every 5 to 15 minutes,
+// without a change for this long there is no gas usage.
+const gasIdleAfter = 20 * time.Minute
+
+// Reading values are unknown once the last reading is this old,
+// so rules do not keep acting on the values of a meter that stopped sending.
+// telegram_age_seconds covers the meter going silent.
+const readingMaxAge = time.Minute
+
+// Values rules can refer to, derived from the readings.
+type metrics struct {
+	values map[string]float64
+
+	lastReadingAt time.Time
+
+	// Gas usage per hour from the last two changes of the gas total
+	gasM3         float64
+	gasChangedAt  time.Time
+	gasM3PerHour  float64
+	gasRateKnown  bool
+	gasTotalKnown bool
+}
+
+func newMetrics(now time.Time) *metrics {
+	// No telegram counts from startup
+	return &metrics{values: map[string]float64{}, lastReadingAt: now}
+}
+
+// Every numeric reading field by its JSON name, plus the derived metrics.
+func (m *metrics) update(reading *interpreter.RawMeterReading, now time.Time) {
+	m.lastReadingAt = now
+	values := map[string]float64{}
+	if data, err := json.Marshal(reading); err == nil {
+		var fields map[string]any
+		json.Unmarshal(data, &fields)
+		for name, value := range fields {
+			if number, ok := value.(float64); ok {
+				values[name] = number
+			}
+		}
+	}
+
+	values["import_kw"] = reading.CurrentConsumptionKW
+	values["export_kw"] = reading.CurrentProductionKW
+	values["net_kw"] = reading.CurrentConsumptionKW - reading.CurrentProductionKW
+
+	// Single phase meters report 0 for the other phases
+	maxVoltage, minVoltage := 0.0, math.Inf(1)
+	for _, voltage := range []float64{reading.L1VoltageV, reading.L2VoltageV, reading.L3VoltageV} {
+		if voltage > 0 {
+			maxVoltage = math.Max(maxVoltage, voltage)
+			minVoltage = math.Min(minVoltage, voltage)
+		}
+	}
+	if maxVoltage > 0 {
+		values["max_voltage_v"] = maxVoltage
+		values["min_voltage_v"] = minVoltage
+	}
+	values["max_current_a"] = math.Max(reading.L1CurrentA, math.Max(reading.L2CurrentA, reading.L3CurrentA))
+
+	m.updateGas(reading.GasConsumptionM3, now)
+	m.values = values
+}
+
+func (m *metrics) updateGas(totalM3 float64, now time.Time) {
+	if totalM3 <= 0 {
+		return
+	}
+	if !m.gasTotalKnown {
+		m.gasM3, m.gasChangedAt, m.gasTotalKnown = totalM3, now, true
+		return
+	}
+	if totalM3 != m.gasM3 {
+		if hours := now.Sub(m.gasChangedAt).Hours(); hours > 0 {
+			m.gasM3PerHour = (totalM3 - m.gasM3) / hours
+			m.gasRateKnown = true
+		}
+		m.gasM3, m.gasChangedAt = totalM3, now
+	}
+}
+
+// Current value of a metric, false when it is not known (yet).
+func (m *metrics) get(name string, now time.Time) (float64, bool) {
+	switch name {
+	case "telegram_age_seconds":
+		return now.Sub(m.lastReadingAt).Seconds(), true
+	case "gas_m3_per_hour":
+		if !m.gasRateKnown {
+			return 0, false
+		}
+		if now.Sub(m.gasChangedAt) > gasIdleAfter {
+			return 0, true
+		}
+		return m.gasM3PerHour, true
+	}
+	if now.Sub(m.lastReadingAt) > readingMaxAge {
+		return 0, false
+	}
+	value, ok := m.values[name]
+	return value, ok
+}
@@ -0,0 +1,24 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+)
+
+func TestMetricsExpire(t *testing.T) {
+	now := time.Now()
+	m := newMetrics(now)
+	m.update(&interpreter.RawMeterReading{CurrentProductionKW: 3.5}, now)
+
+	if value, ok := m.get("export_kw", now.Add(30*time.Second)); !ok || value != 3.5 {
+		t.Errorf("export_kw %v %v, want 3.5", value, ok)
+	}
+	if _, ok := m.get("export_kw", now.Add(2*time.Minute)); ok {
+		t.Error("export_kw still known two minutes after the last reading")
+	}
+	if age, ok := m.get("telegram_age_seconds", now.Add(2*time.Minute)); !ok || age != 120 {
+		t.Errorf("telegram_age_seconds %v %v, want 120", age, ok)
+	}
+}
@@ -0,0 +1,137 @@
+package rules
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	mqttConnect    = 1 << 4
+	mqttConnAck    = 2 << 4
+	mqttPublish    = 3 << 4
+	mqttDisconnect = 14 << 4
+
+	mqttProtocolLevel = 4
+	mqttTimeout       = 10 * time.Second
+)
+
+var mqttConnections atomic.Uint64
+
+// Publish a single QoS 0 message on a new connection.
+// Notifications are rare, so no connection is kept open.
+func publishMQTT(broker, username, password, topic string, payload []byte, retain bool) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker %q: %w", broker, err)
+	}
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostWithPort(u, "1883"))
+	case "tls", "ssl", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithPort(u, "8883"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return fmt.Errorf("unsupported broker scheme %q, use tcp:// or tls://", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+
+	if _, err := conn.Write(mqttConnectPacket(mqttClientID(), username, password)); err != nil {
+		return err
+	}
+
+	connAck := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connAck); err != nil {
+		return fmt.Errorf("no CONNACK: %w", err)
+	}
+	if connAck[0] != mqttConnAck || connAck[3] != 0 {
+		return fmt.Errorf("connection refused by broker, return code %d", connAck[3])
+	}
+
+	if _, err := conn.Write(mqttPublishPacket(topic, payload, retain)); err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte{mqttDisconnect, 0})
+	return err
+}
+
+// Brokers drop the older of two connections with the same client id,
+// so every connection gets its own in case actions publish at the same time.
+func mqttClientID() string {
+	return "esm-" + strconv.Itoa(os.Getpid()) + "-" + strconv.FormatUint(mqttConnections.Add(1), 10)
+}
+
+// CONNECT with a clean session.
+func mqttConnectPacket(clientID, username, password string) []byte {
+	var flags byte = 0x02
+	connect := mqttString(nil, "MQTT")
+	connect = append(connect, mqttProtocolLevel)
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	connect = append(connect, flags)
+	connect = binary.BigEndian.AppendUint16(connect, 30) // Keep alive seconds
+	connect = mqttString(connect, clientID)
+	if username != "" {
+		connect = mqttString(connect, username)
+	}
+	if password != "" {
+		connect = mqttString(connect, password)
+	}
+	return mqttPacket(mqttConnect, connect)
+}
+
+// QoS 0 PUBLISH, which has no packet identifier.
+func mqttPublishPacket(topic string, payload []byte, retain bool) []byte {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	return mqttPacket(mqttPublish|flags, append(mqttString(nil, topic), payload...))
+}
+
+// Fixed header with the variable length encoded remaining length.
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func mqttString(buffer []byte, value string) []byte {
+	buffer = binary.BigEndian.AppendUint16(buffer, uint16(len(value)))
+	return append(buffer, value...)
+}
+
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Packets of client esm-1-1 logging in as user/pass and publishing {"a":1} retained on esm/test,
+// written out from the MQTT 3.1.1 specification
+const (
+	specConnect = "101f00044d51545404c2001e0007" + "65736d2d312d31" + "000475736572" + "000470617373"
+	specPublish = "3111" + "000865736d2f74657374" + "7b2261223a317d"
+)
+
+func TestMQTTPacketEncoding(t *testing.T) {
+	connect := hex.EncodeToString(mqttConnectPacket("esm-1-1", "user", "pass"))
+	if connect != specConnect {
+		t.Errorf("CONNECT %s, want %s", connect, specConnect)
+	}
+	publish := hex.EncodeToString(mqttPublishPacket("esm/test", []byte(`{"a":1}`), true))
+	if publish != specPublish {
+		t.Errorf("PUBLISH %s, want %s", publish, specPublish)
+	}
+
+	// Remaining lengths above 127 take a second byte
+	long := mqttPublishPacket("t", bytes.Repeat([]byte{'x'}, 200), false)
+	if got := hex.EncodeToString(long[:3]); got != "30cb01" {
+		t.Errorf("long PUBLISH header %s, want 30cb01", got)
+	}
+}
+
+func TestMQTTClientIDUnique(t *testing.T) {
+	first, second := mqttClientID(), mqttClientID()
+	if first == second {
+		t.Errorf("client id %q reused", first)
+	}
+}
+
+func TestPublishMQTT(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connect := make([]byte, 2)
+		io.ReadFull(conn, connect)
+		io.ReadFull(conn, make([]byte, connect[1]))
+		conn.Write([]byte{mqttConnAck, 2, 0, 0})
+		rest, _ := io.ReadAll(conn)
+		received <- rest
+	}()
+
+	err = publishMQTT("tcp://"+listener.Addr().String(), "", "", "esm/test", []byte(`{"a":1}`), true)
+	if err != nil {
+		t.Fatalf("publishMQTT: %v", err)
+	}
+	want := specPublish + "e000"
+	if got := hex.EncodeToString(<-received); got != want {
+		t.Errorf("sent %s after CONNACK, want %s", got, want)
+	}
+}
+
+func TestPublishMQTTRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Not authorized
+		conn.Write([]byte{mqttConnAck, 2, 0, 5})
+		io.ReadAll(conn)
+	}()
+
+	err = publishMQTT("tcp://"+listener.Addr().String(), "user", "wrong", "esm/test", nil, false)
+	if err == nil || !strings.Contains(err.Error(), "return code 5") {
+		t.Errorf("error %v, want refused with return code 5", err)
+	}
+}
@@ -0,0 +1,280 @@
+package solarinverter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// Huawei SUN2000 register blocks, read with as few requests as possible.
+// Registers are 16 bit, 32 bit values span two registers, high word first.
+const (
+	huaweiPVStringCountRegister = 30071
+
+	// States, alarms and PV strings
+	huaweiStatusBlockStart = 32000
+	huaweiStatusBlockSize  = 64
+
+	// Power, grid, temperature and yields
+	huaweiPowerBlockStart = 32064
+	huaweiPowerBlockSize  = 52
+
+	// LUNA2000 storage unit 1, fails on inverters without a battery
+	huaweiBatteryBlockStart = 37758
+	huaweiBatteryBlockSize  = 9
+
+	huaweiMaxPVStrings = 24
+)
+
+// Register 32089
+var huaweiDeviceStatuses = map[uint16]string{
+	0x0000: "Standby: initializing",
+	0x0001: "Standby: detecting insulation resistance",
+	0x0002: "Standby: detecting irradiation",
+	0x0003: "Standby: grid detecting",
+	0x0100: "Starting",
+	0x0200: "On-grid",
+	0x0201: "Grid connection: power limited",
+	0x0202: "Grid connection: self-derating",
+	0x0203: "Off-grid running",
+	0x0300: "Shutdown: fault",
+	0x0301: "Shutdown: command",
+	0x0302: "Shutdown: OVGR",
+	0x0303: "Shutdown: communication disconnected",
+	0x0304: "Shutdown: power limited",
+	0x0305: "Shutdown: manual startup required",
+	0x0306: "Shutdown: DC switches disconnected",
+	0x0307: "Shutdown: rapid cutoff",
+	0x0308: "Shutdown: input underpower",
+	0x0401: "Grid scheduling: cosphi-P curve",
+	0x0402: "Grid scheduling: Q-U curve",
+	0x0403: "Grid scheduling: PF-U curve",
+	0x0404: "Grid scheduling: dry contact",
+	0x0405: "Grid scheduling: Q-P curve",
+	0x0500: "Spot-check ready",
+	0x0501: "Spot-checking",
+	0x0600: "Inspecting",
+	0x0700: "AFCI self check",
+	0x0800: "I-V scanning",
+	0x0900: "DC input detection",
+	0x0A00: "Running: off-grid charging",
+	0xA000: "Standby: no irradiation",
+}
+
+// Register 37762
+var huaweiBatteryStatuses = map[uint16]string{
+	0: "Offline",
+	1: "Standby",
+	2: "Running",
+	3: "Fault",
+	4: "Sleep mode",
+}
+
+// Bits of alarm registers 32008 to 32010
+var huaweiAlarms = [3][16]string{
+	{
+		"High String Input Voltage",
+		"DC Arc Fault",
+		"String Reverse Connection",
+		"String Current Backfeed",
+		"Abnormal String Power",
+		"AFCI Self-Check Fail",
+		"Phase Wire Short-Circuited to PE",
+		"Grid Loss",
+		"Grid Undervoltage",
+		"Grid Overvoltage",
+		"Grid Voltage Imbalance",
+		"Grid Overfrequency",
+		"Grid Underfrequency",
+		"Unstable Grid Frequency",
+		"Output Overcurrent",
+		"Output DC Component Overhigh",
+	},
+	{
+		"Abnormal Residual Current",
+		"Abnormal Grounding",
+		"Low Insulation Resistance",
+		"Overtemperature",
+		"Device Fault",
+		"Upgrade Failed or Version Mismatch",
+		"License Expired",
+		"Faulty Monitoring Unit",
+		"Faulty Power Collector",
+		"Battery Abnormal",
+		"Active Islanding",
+		"Passive Islanding",
+		"Transient AC Overvoltage",
+		"Peripheral Port Short Circuit",
+		"Churn Output Overload",
+		"Abnormal PV Module Configuration",
+	},
+	{
+		"Optimizer Fault",
+		"Built-in PID Operation Abnormal",
+		"High Input String Voltage to Ground",
+		"External Fan Abnormal",
+		"Battery Reverse Connection",
+		"On-grid/Off-grid Controller Abnormal",
+		"PV String Loss",
+		"Internal Fan Abnormal",
+		"DC Protection Unit Abnormal",
+	},
+}
+
+// Huawei SUN2000, over the WLAN dongle, SDongle or RS485.
+type HuaweiInverter struct {
+	conn      *modbusConnection
+	pvStrings int // Read once from the inverter
+}
+
+func (h *HuaweiInverter) ReadSnapshot() (*InverterSnapshot, error) {
+	var snapshot *InverterSnapshot
+	err := h.conn.do(func(client modbus.Client) error {
+		var err error
+		snapshot, h.pvStrings, err = readHuaweiSnapshot(client, h.pvStrings)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Raw registers of a block read.
+type registerBlock struct {
+	start uint16
+	data  []byte
+}
+
+func readRegisterBlock(client modbus.Client, start uint16, size uint16) (*registerBlock, error) {
+	data, err := client.ReadHoldingRegisters(start, size)
+	if err != nil {
+		return nil, fmt.Errorf("read registers %d-%d: %w", start, start+size-1, err)
+	}
+	if len(data) != int(size)*2 {
+		return nil, fmt.Errorf("read registers %d-%d: got %d bytes", start, start+size-1, len(data))
+	}
+	return &registerBlock{start: start, data: data}, nil
+}
+
+func (b *registerBlock) u16(register uint16) uint16 {
+	offset := int(register-b.start) * 2
+	return binary.BigEndian.Uint16(b.data[offset:])
+}
+
+func (b *registerBlock) i16(register uint16) int16 {
+	return int16(b.u16(register))
+}
+
+func (b *registerBlock) u32(register uint16) uint32 {
+	offset := int(register-b.start) * 2
+	return binary.BigEndian.Uint32(b.data[offset:])
+}
+
+func (b *registerBlock) i32(register uint16) int32 {
+	return int32(b.u32(register))
+}
+
+// Read a full snapshot from a SUN2000.
+// pvStrings is the number of connected strings, 0 to read it from the inverter.
+func readHuaweiSnapshot(client modbus.Client, pvStrings int) (*InverterSnapshot, int, error) {
+	if pvStrings == 0 {
+		count, err := readRegisterBlock(client, huaweiPVStringCountRegister, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		pvStrings = min(int(count.u16(huaweiPVStringCountRegister)), huaweiMaxPVStrings)
+	}
+
+	status, err := readRegisterBlock(client, huaweiStatusBlockStart, huaweiStatusBlockSize)
+	if err != nil {
+		return nil, pvStrings, err
+	}
+	power, err := readRegisterBlock(client, huaweiPowerBlockStart, huaweiPowerBlockSize)
+	if err != nil {
+		return nil, pvStrings, err
+	}
+
+	snapshot := &InverterSnapshot{
+		ReadAt: time.Now(),
+		Driver: DriverHuawei,
+
+		InputPowerW:           power.i32(32064),
+		PeakActivePowerTodayW: power.i32(32078),
+		ActivePowerW:          power.i32(32080),
+		ReactivePowerVar:      power.i32(32082),
+		PowerFactor:           float64(power.i16(32084)) / 1000,
+		EfficiencyPercent:     float64(power.u16(32086)) / 100,
+
+		DailyYieldWh:    int64(power.u32(32114)) * 10,
+		LifetimeYieldWh: int64(power.u32(32106)) * 10,
+
+		GridFrequencyHz: float64(power.u16(32085)) / 100,
+		LineVoltagesV: [3]float64{
+			float64(power.u16(32066)) / 10,
+			float64(power.u16(32067)) / 10,
+			float64(power.u16(32068)) / 10,
+		},
+		PhaseVoltagesV: [3]float64{
+			float64(power.u16(32069)) / 10,
+			float64(power.u16(32070)) / 10,
+			float64(power.u16(32071)) / 10,
+		},
+		PhaseCurrentsA: [3]float64{
+			float64(power.i32(32072)) / 1000,
+			float64(power.i32(32074)) / 1000,
+			float64(power.i32(32076)) / 1000,
+		},
+
+		InternalTemperatureC:     float64(power.i16(32087)) / 10,
+		InsulationResistanceMOhm: float64(power.u16(32088)) / 1000,
+
+		DeviceStatus: power.u16(32089),
+		FaultCode:    power.u16(32090),
+		StateCodes: [3]uint32{
+			uint32(status.u16(32000)),
+			uint32(status.u16(32002)),
+			status.u32(32003),
+		},
+		AlarmCodes: [3]uint16{
+			status.u16(32008),
+			status.u16(32009),
+			status.u16(32010),
+		},
+	}
+
+	snapshot.DeviceStatusText = huaweiDeviceStatuses[snapshot.DeviceStatus]
+	snapshot.Alarms = make([]string, 0)
+	for register, code := range snapshot.AlarmCodes {
+		for bit, name := range huaweiAlarms[register] {
+			if name != "" && code&(1<<bit) != 0 {
+				snapshot.Alarms = append(snapshot.Alarms, name)
+			}
+		}
+	}
+
+	snapshot.PVStrings = make([]PVString, 0, pvStrings)
+	for i := range pvStrings {
+		register := uint16(32016 + i*2)
+		snapshot.PVStrings = append(snapshot.PVStrings, PVString{
+			VoltageV: float64(status.i16(register)) / 10,
+			CurrentA: float64(status.i16(register+1)) / 100,
+		})
+	}
+
+	// Inverters without a battery reject these registers or report no capacity
+	battery, err := readRegisterBlock(client, huaweiBatteryBlockStart, huaweiBatteryBlockSize)
+	if err == nil && battery.u32(37758) > 0 {
+		snapshot.Battery = &BatterySnapshot{
+			RatedCapacityWh: battery.u32(37758),
+			StateOfCharge:   float64(battery.u16(37760)) / 10,
+			RunningStatus:   battery.u16(37762),
+			ChargePowerW:    battery.i32(37765),
+		}
+		snapshot.Battery.RunningStatusText = huaweiBatteryStatuses[snapshot.Battery.RunningStatus]
+	}
+
+	return snapshot, pvStrings, nil
+}
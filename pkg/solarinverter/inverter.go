@@ -0,0 +1,150 @@
+package solarinverter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/config"
+	"github.com/goburrow/modbus"
+)
+
+const (
+	DriverHuawei  = "huawei"
+	DriverSunSpec = "sunspec"
+
+	TransportTCP = "tcp"
+	TransportRTU = "rtu"
+)
+
+var ErrUnknownDriver = fmt.Errorf("unknown solar inverter driver")
+
+// A solar inverter read over Modbus.
+// Implementations keep discovered state between reads and are not safe for concurrent use.
+type Inverter interface {
+	// Read all values the inverter supports in as few requests as possible.
+	ReadSnapshot() (*InverterSnapshot, error)
+}
+
+// Everything the inverter reports in a single poll.
+// Values an inverter does not report are left zero.
+type InverterSnapshot struct {
+	ReadAt time.Time `json:"read_at"`
+	Driver string    `json:"driver"`
+
+	ActivePowerW          int32   `json:"active_power_w"`
+	InputPowerW           int32   `json:"input_power_w"`
+	ReactivePowerVar      int32   `json:"reactive_power_var"`
+	PeakActivePowerTodayW int32   `json:"peak_active_power_today_w"`
+	PowerFactor           float64 `json:"power_factor"`
+	EfficiencyPercent     float64 `json:"efficiency_percent"`
+
+	DailyYieldWh    int64 `json:"daily_yield_wh"`
+	LifetimeYieldWh int64 `json:"lifetime_yield_wh"`
+
+	GridFrequencyHz float64    `json:"grid_frequency_hz"`
+	PhaseVoltagesV  [3]float64 `json:"phase_voltages_v"`
+	PhaseCurrentsA  [3]float64 `json:"phase_currents_a"`
+	LineVoltagesV   [3]float64 `json:"line_voltages_v"` // A-B, B-C, C-A
+
+	InternalTemperatureC     float64 `json:"internal_temperature_c"`
+	InsulationResistanceMOhm float64 `json:"insulation_resistance_mohm"`
+
+	PVStrings []PVString `json:"pv_strings"`
+
+	// Status and alarm codes are vendor specific, the texts describe them
+	DeviceStatus     uint16    `json:"device_status"`
+	DeviceStatusText string    `json:"device_status_text"`
+	FaultCode        uint16    `json:"fault_code"`
+	StateCodes       [3]uint32 `json:"state_codes"`
+	AlarmCodes       [3]uint16 `json:"alarm_codes"`
+	Alarms           []string  `json:"alarms"`
+
+	// nil when no battery is connected, eg. a Huawei LUNA2000
+	Battery *BatterySnapshot `json:"battery"`
+}
+
+type PVString struct {
+	VoltageV float64 `json:"voltage_v"`
+	CurrentA float64 `json:"current_a"`
+}
+
+type BatterySnapshot struct {
+	RunningStatus     uint16  `json:"running_status"`
+	RunningStatusText string  `json:"running_status_text"`
+	StateOfCharge     float64 `json:"state_of_charge_percent"`
+	RatedCapacityWh   uint32  `json:"rated_capacity_wh"`
+	ChargePowerW      int32   `json:"charge_power_w"` // Negative when discharging
+}
+
+// Create the inverter driver selected in the interpreter API config.
+func NewInverter(cfg *config.InterpreterAPIConfig) (Inverter, error) {
+	conn := &modbusConnection{
+		transport:    cfg.SolarInverterTransport,
+		address:      fmt.Sprintf("%s:%d", cfg.SolarInverterIp, cfg.SolarInverterModbusPort),
+		serialDevice: cfg.SolarInverterSerialDevice,
+		baudrate:     cfg.SolarInverterBaudrate,
+		slaveID:      byte(cfg.SolarInverterSlaveID),
+	}
+	if conn.transport != TransportTCP && conn.transport != TransportRTU {
+		return nil, fmt.Errorf("unknown solar inverter transport %q", conn.transport)
+	}
+
+	switch cfg.SolarInverterDriver {
+	case DriverHuawei, "":
+		// The 2s delay after connecting causes everything to not implode as much
+		if conn.transport == TransportTCP {
+			conn.settleDelay = 2 * time.Second
+		}
+		return &HuaweiInverter{conn: conn}, nil
+	case DriverSunSpec:
+		return &SunSpecInverter{conn: conn}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, cfg.SolarInverterDriver)
+}
+
+// Connection settings shared by all drivers.
+type modbusConnection struct {
+	transport    string
+	address      string // TCP
+	serialDevice string // RTU
+	baudrate     int    // RTU
+	slaveID      byte
+	settleDelay  time.Duration
+}
+
+type modbusHandler interface {
+	modbus.ClientHandler
+	Connect() error
+	Close() error
+}
+
+// Connect, run read and disconnect again.
+// Inverters tend to drop idle connections, so none are kept open.
+func (c *modbusConnection) do(read func(client modbus.Client) error) error {
+	var handler modbusHandler
+	switch c.transport {
+	case TransportRTU:
+		rtuHandler := modbus.NewRTUClientHandler(c.serialDevice)
+		rtuHandler.BaudRate = c.baudrate
+		rtuHandler.DataBits = 8
+		rtuHandler.Parity = "N"
+		rtuHandler.StopBits = 1
+		rtuHandler.SlaveId = c.slaveID
+		rtuHandler.Timeout = 5 * time.Second
+		handler = rtuHandler
+	default:
+		tcpHandler := modbus.NewTCPClientHandler(c.address)
+		tcpHandler.SlaveId = c.slaveID
+		tcpHandler.Timeout = 10 * time.Second
+		handler = tcpHandler
+	}
+
+	if err := handler.Connect(); err != nil {
+		handler.Close()
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer handler.Close()
+
+	time.Sleep(c.settleDelay)
+	return read(modbus.NewClient(handler))
+}
@@ -3,12 +3,12 @@ package solarinverter
 import (
 	"errors"
 	"fmt"
+	"log"
 	"os/exec"
 	"sync"
 	"time"
 
 	"github.com/NotCoffee418/european_smart_meter/pkg/config"
-	"github.com/goburrow/modbus"
 	probing "github.com/prometheus-community/pro-bing"
 )
 
@@ -16,39 +16,133 @@ var (
 	ErrModbusNotConfigured = fmt.Errorf("modbus not configured") // may be intended
 	ErrModbusReadFailed    = fmt.Errorf("modbus read failed")
 	ErrModbusNotConnected  = fmt.Errorf("modbus not connected")
+	ErrNoReadingYet        = fmt.Errorf("no solar inverter reading yet")
 )
 
 var (
-	solarPowerMu      sync.Mutex
-	lastSolarReadWatt int32 = 0
-	lastSolarReadTime time.Time
+	solarPowerMu  sync.RWMutex
+	inverter      Inverter // Only used by the poller
+	lastSnapshot  *InverterSnapshot
+	lastReadError error
+	pollInterval  time.Duration
 )
 
+// Latest result of the background poller.
+type Status struct {
+	Snapshot  *InverterSnapshot
+	UpdatedAt time.Time
+	Age       time.Duration
+	// No successful read for three poll intervals, the inverter may be offline
+	Stale     bool
+	LastError error // Error of the most recent poll, nil when it succeeded
+}
+
 // IsModbusConfigured checks if the modbus configuration is set.
 // This feature is optional, Empty values as config are acceptable.
 func IsModbusConfigured() bool {
-	return config.ActiveInterpreterAPIConfig.SolarInverterIp != "" &&
-		config.ActiveInterpreterAPIConfig.SolarInverterModbusPort != 0 &&
-		config.ActiveInterpreterAPIConfig.WlanConnectionId != ""
+	cfg := config.ActiveInterpreterAPIConfig
+	if cfg.SolarInverterTransport == TransportRTU {
+		return cfg.SolarInverterSerialDevice != ""
+	}
+	return cfg.SolarInverterIp != "" && cfg.SolarInverterModbusPort != 0
 }
 
+// Inverters on their own Wi-Fi access point are reconnected with nmcli.
+func usesWlanConnection() bool {
+	cfg := config.ActiveInterpreterAPIConfig
+	return cfg.SolarInverterTransport != TransportRTU && cfg.WlanConnectionId != ""
+}
+
+// Current production of the last successful poll.
 func ReadSolarData() (int32, error) {
-	// Check if configured
+	snapshot, err := ReadInverterSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.ActivePowerW, nil
+}
+
+// Snapshot of the last successful poll, returns immediately.
+// The snapshot is shared with other callers, do not modify it.
+func ReadInverterSnapshot() (*InverterSnapshot, error) {
+	status, err := GetStatus()
+	if err != nil {
+		return nil, err
+	}
+	return status.Snapshot, nil
+}
+
+// Latest poll result including its age, fails when nothing was read successfully yet.
+func GetStatus() (*Status, error) {
 	if !IsModbusConfigured() {
-		return 0, ErrModbusNotConfigured
+		return nil, ErrModbusNotConfigured
 	}
 
-	// Use cached reads to avoid spamming the poor inverter
-	solarPowerMu.Lock()
-	defer solarPowerMu.Unlock()
-	if lastSolarReadTime.After(time.Now().Add(-30 * time.Second)) {
-		return lastSolarReadWatt, nil
+	solarPowerMu.RLock()
+	defer solarPowerMu.RUnlock()
+	if lastSnapshot == nil {
+		if lastReadError != nil {
+			return nil, lastReadError
+		}
+		return nil, ErrNoReadingYet
+	}
+
+	age := time.Since(lastSnapshot.ReadAt)
+	return &Status{
+		Snapshot:  lastSnapshot,
+		UpdatedAt: lastSnapshot.ReadAt,
+		Age:       age,
+		Stale:     age > 3*pollInterval,
+		LastError: lastReadError,
+	}, nil
+}
+
+// Poll the inverter every interval in the background, so reads never wait on the inverter.
+// onSnapshot is called after every successful poll and may be nil.
+func StartPoller(interval time.Duration, onSnapshot func(*InverterSnapshot)) error {
+	if !IsModbusConfigured() {
+		return ErrModbusNotConfigured
+	}
+	var err error
+	if inverter, err = NewInverter(config.ActiveInterpreterAPIConfig); err != nil {
+		return err
 	}
 
+	solarPowerMu.Lock()
+	pollInterval = interval
+	solarPowerMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			snapshot, err := pollInverter()
+
+			solarPowerMu.Lock()
+			if err != nil && (lastReadError == nil || lastSnapshot == nil) {
+				log.Printf("Failed to read solar inverter: %v", err)
+			}
+			lastReadError = err
+			if err == nil {
+				lastSnapshot = snapshot
+			}
+			solarPowerMu.Unlock()
+
+			if err == nil && onSnapshot != nil {
+				onSnapshot(snapshot)
+			}
+		}
+	}()
+	return nil
+}
+
+// Read the inverter, reconnecting Wi-Fi and retrying when needed.
+// May block for well over 30 seconds when the inverter is unreachable.
+func pollInverter() (*InverterSnapshot, error) {
 	const maxRetries = 3
 	var lastErr error
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
+		if attempt > 0 && usesWlanConnection() {
 			// Try reconnecting on retry attempts
 			if err := tryReconnect(); err != nil {
 				lastErr = fmt.Errorf("reconnect failed on attempt %d: %w", attempt+1, err)
@@ -57,54 +151,28 @@ func ReadSolarData() (int32, error) {
 		}
 
 		// Ping check before attempting modbus connection
-		if ok, _, err := ping(config.ActiveInterpreterAPIConfig.SolarInverterIp); !ok || err != nil {
-			lastErr = fmt.Errorf("ping failed on attempt %d: %w", attempt+1, err)
-			if attempt < maxRetries-1 {
-				time.Sleep(2 * time.Second)
-			}
-			continue
-		}
-
-		host := config.ActiveInterpreterAPIConfig.SolarInverterIp
-		port := config.ActiveInterpreterAPIConfig.SolarInverterModbusPort
-
-		handler := modbus.NewTCPClientHandler(fmt.Sprintf("%s:%d", host, port))
-		handler.Timeout = 10 * time.Second
-		handler.SlaveId = 0
-
-		if err := handler.Connect(); err != nil {
-			lastErr = fmt.Errorf("connection failed on attempt %d: %w", attempt+1, err)
-			handler.Close()
-			if attempt < maxRetries-1 {
-				time.Sleep(2 * time.Second)
+		if usesWlanConnection() {
+			if ok, _, err := ping(config.ActiveInterpreterAPIConfig.SolarInverterIp); !ok || err != nil {
+				lastErr = fmt.Errorf("ping failed on attempt %d: %w", attempt+1, err)
+				if attempt < maxRetries-1 {
+					time.Sleep(2 * time.Second)
+				}
+				continue
 			}
-			continue
 		}
 
-		// The 2s delay after connecting causes everything to not implode as much
-		time.Sleep(2 * time.Second)
-		client := modbus.NewClient(handler)
-
-		// Read Active Power
-		result, err := client.ReadHoldingRegisters(32080, 2)
-		handler.Close()
-
+		snapshot, err := inverter.ReadSnapshot()
 		if err != nil {
-			lastErr = fmt.Errorf("read power failed on attempt %d: %w", attempt+1, err)
+			lastErr = fmt.Errorf("read failed on attempt %d: %w", attempt+1, err)
 			if attempt < maxRetries-1 {
 				time.Sleep(2 * time.Second)
 			}
 			continue
 		}
-
-		// Success - calculate power and return
-		power := int32(result[0])<<24 | int32(result[1])<<16 | int32(result[2])<<8 | int32(result[3])
-		lastSolarReadWatt = power
-		lastSolarReadTime = time.Now()
-		return power, nil
+		return snapshot, nil
 	}
 
-	return 0, errors.Join(ErrModbusReadFailed, lastErr)
+	return nil, errors.Join(ErrModbusReadFailed, lastErr)
 }
 
 func tryReconnect() error {
@@ -0,0 +1,239 @@
+package solarinverter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// SunSpec models are found by walking a chain of model headers (id, length)
+// starting after the "SunS" marker at one of the well known base addresses.
+var sunspecBaseAddresses = []uint16{40000, 0, 50000}
+
+const (
+	sunspecMarker  = 0x53756e53 // "SunS"
+	sunspecEndID   = 0xFFFF
+	sunspecMaxRead = 125
+
+	// Integer inverter models with scale factors, single, split and three phase
+	sunspecModelInverterSinglePhase = 101
+	sunspecModelInverterSplitPhase  = 102
+	sunspecModelInverterThreePhase  = 103
+	sunspecModelMPPT                = 160
+
+	// Not implemented values
+	sunspecNotImplementedInt16  = -0x8000
+	sunspecNotImplementedUint16 = 0xFFFF
+)
+
+var ErrSunSpecNotFound = errors.New("no SunSpec inverter model found")
+
+// Operating state, register St of the inverter models
+var sunspecStates = map[uint16]string{
+	1: "Off",
+	2: "Sleeping",
+	3: "Starting",
+	4: "MPPT",
+	5: "Throttled",
+	6: "Shutting down",
+	7: "Fault",
+	8: "Standby",
+}
+
+// Bits of Evt1 of the inverter models
+var sunspecEvents = [16]string{
+	"Ground Fault",
+	"DC Overvoltage",
+	"AC Disconnect Open",
+	"DC Disconnect Open",
+	"Grid Disconnect",
+	"Cabinet Open",
+	"Manual Shutdown",
+	"Overtemperature",
+	"Overfrequency",
+	"Underfrequency",
+	"AC Overvoltage",
+	"AC Undervoltage",
+	"Blown String Fuse",
+	"Undertemperature",
+	"Memory Loss",
+	"Hardware Test Failure",
+}
+
+// Any inverter implementing the SunSpec Modbus information models, eg. SMA, Fronius or SolarEdge.
+// Only the integer models are supported, float models 111 to 113 are not.
+type SunSpecInverter struct {
+	conn *modbusConnection
+
+	// Addresses of the model headers, found on the first read
+	inverterModel uint16
+	mpptModel     uint16 // 0 when not available
+}
+
+func (s *SunSpecInverter) ReadSnapshot() (*InverterSnapshot, error) {
+	var snapshot *InverterSnapshot
+	err := s.conn.do(func(client modbus.Client) error {
+		if s.inverterModel == 0 {
+			if err := s.discover(client); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		snapshot, err = s.readInverterModel(client)
+		if err != nil {
+			// Models may move after a firmware update
+			s.inverterModel = 0
+			return err
+		}
+		if s.mpptModel != 0 {
+			if snapshot.PVStrings, err = s.readMPPTModel(client); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Find the inverter and MPPT models in the model chain.
+func (s *SunSpecInverter) discover(client modbus.Client) error {
+	s.inverterModel, s.mpptModel = 0, 0
+	for _, base := range sunspecBaseAddresses {
+		marker, err := readRegisterBlock(client, base, 2)
+		if err != nil || marker.u32(base) != sunspecMarker {
+			continue
+		}
+
+		address := base + 2
+		for range 100 {
+			header, err := readRegisterBlock(client, address, 2)
+			if err != nil {
+				return err
+			}
+			id, length := header.u16(address), header.u16(address+1)
+			if id == sunspecEndID {
+				break
+			}
+			switch id {
+			case sunspecModelInverterSinglePhase, sunspecModelInverterSplitPhase, sunspecModelInverterThreePhase:
+				if s.inverterModel == 0 {
+					s.inverterModel = address
+				}
+			case sunspecModelMPPT:
+				s.mpptModel = address
+			}
+			address += 2 + length
+		}
+
+		if s.inverterModel == 0 {
+			return ErrSunSpecNotFound
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: no SunS marker at %v", ErrSunSpecNotFound, sunspecBaseAddresses)
+}
+
+// Inverter model 101 to 103, 50 registers after the header.
+func (s *SunSpecInverter) readInverterModel(client modbus.Client) (*InverterSnapshot, error) {
+	model, err := readRegisterBlock(client, s.inverterModel, 52)
+	if err != nil {
+		return nil, err
+	}
+	id := model.u16(s.inverterModel)
+	if id < sunspecModelInverterSinglePhase || id > sunspecModelInverterThreePhase {
+		return nil, fmt.Errorf("%w: model %d at %d", ErrSunSpecNotFound, id, s.inverterModel)
+	}
+
+	// Data registers follow the two header registers
+	r := func(offset uint16) uint16 { return s.inverterModel + 2 + offset }
+	scaled := func(offset uint16, scaleOffset uint16) float64 {
+		return sunspecScale(float64(model.u16(r(offset))), model.i16(r(scaleOffset)), model.u16(r(offset)) == sunspecNotImplementedUint16)
+	}
+	scaledSigned := func(offset uint16, scaleOffset uint16) float64 {
+		return sunspecScale(float64(model.i16(r(offset))), model.i16(r(scaleOffset)), model.i16(r(offset)) == sunspecNotImplementedInt16)
+	}
+
+	snapshot := &InverterSnapshot{
+		ReadAt: time.Now(),
+		Driver: DriverSunSpec,
+
+		ActivePowerW:     int32(scaledSigned(12, 13)),
+		InputPowerW:      int32(scaledSigned(29, 30)),
+		ReactivePowerVar: int32(scaledSigned(18, 19)),
+		PowerFactor:      scaledSigned(20, 21) / 100,
+
+		LifetimeYieldWh: int64(sunspecScale(float64(model.u32(r(22))), model.i16(r(24)), false)),
+
+		GridFrequencyHz: scaled(14, 15),
+		PhaseCurrentsA:  [3]float64{scaled(1, 4), scaled(2, 4), scaled(3, 4)},
+		LineVoltagesV:   [3]float64{scaled(5, 11), scaled(6, 11), scaled(7, 11)},
+		PhaseVoltagesV:  [3]float64{scaled(8, 11), scaled(9, 11), scaled(10, 11)},
+
+		InternalTemperatureC: scaledSigned(31, 35),
+
+		DeviceStatus: model.u16(r(36)),
+		StateCodes:   [3]uint32{uint32(model.u16(r(36))), uint32(model.u16(r(37))), 0},
+		AlarmCodes:   [3]uint16{model.u16(r(38)), model.u16(r(39)), 0}, // Evt1 high and low word
+		PVStrings:    make([]PVString, 0),
+	}
+	if activeW, dcW := float64(snapshot.ActivePowerW), float64(snapshot.InputPowerW); dcW > 0 {
+		snapshot.EfficiencyPercent = math.Round(activeW/dcW*10000) / 100
+	}
+
+	snapshot.DeviceStatusText = sunspecStates[snapshot.DeviceStatus]
+	snapshot.Alarms = make([]string, 0)
+	events := model.u32(r(38))
+	for bit, name := range sunspecEvents {
+		if events&(1<<bit) != 0 {
+			snapshot.Alarms = append(snapshot.Alarms, name)
+		}
+	}
+	return snapshot, nil
+}
+
+// MPPT extension model 160, 8 registers followed by 20 per module.
+func (s *SunSpecInverter) readMPPTModel(client modbus.Client) ([]PVString, error) {
+	header, err := readRegisterBlock(client, s.mpptModel, 10)
+	if err != nil {
+		return nil, err
+	}
+	r := func(offset uint16) uint16 { return s.mpptModel + 2 + offset }
+	currentScale, voltageScale := header.i16(r(0)), header.i16(r(1))
+	modules := int(header.u16(r(6)))
+
+	strings := make([]PVString, 0, modules)
+	for module := 0; module < modules; {
+		// As many modules as fit in a single read
+		batch := min(modules-module, sunspecMaxRead/20)
+		start := r(8 + uint16(module)*20)
+		block, err := readRegisterBlock(client, start, uint16(batch*20))
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			moduleStart := start + uint16(i)*20
+			current, voltage := block.u16(moduleStart+9), block.u16(moduleStart+10)
+			strings = append(strings, PVString{
+				VoltageV: sunspecScale(float64(voltage), voltageScale, voltage == sunspecNotImplementedUint16),
+				CurrentA: sunspecScale(float64(current), currentScale, current == sunspecNotImplementedUint16),
+			})
+		}
+		module += batch
+	}
+	return strings, nil
+}
+
+// Apply a SunSpec scale factor, value * 10^scale. Not implemented values are 0.
+func sunspecScale(value float64, scale int16, notImplemented bool) float64 {
+	if notImplemented || scale == sunspecNotImplementedInt16 {
+		return 0
+	}
+	return value * math.Pow10(int(scale))
+}
@@ -0,0 +1,176 @@
+// Emulates an energy meter over Modbus TCP with the values of the P1 port, so inverters and
+// batteries that do zero-export control with their own meter can use the smart meter instead.
+// Power is positive when importing from the grid and negative when exporting.
+package virtualmeter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/interpreter"
+	"github.com/NotCoffee418/european_smart_meter/pkg/modbusserver"
+)
+
+const (
+	ProfileSDM630  = "sdm630"
+	ProfileSunSpec = "sunspec"
+)
+
+var ErrUnknownProfile = fmt.Errorf("unknown virtual meter profile")
+
+// Without a reading for this long the meter stops answering, so devices switch
+// to their fail-safe instead of regulating on outdated values
+const staleAfter = 10 * time.Second
+
+// Nominal voltage for meters that do not report it
+const nominalVoltageV = 230
+
+type Meter struct {
+	server *modbusserver.Server
+	update func(server *modbusserver.Server, values *meterValues)
+
+	mutex     sync.Mutex
+	updatedAt time.Time
+}
+
+// Values of a reading as an energy meter reports them.
+type meterValues struct {
+	voltageV [3]float64
+	currentA [3]float64
+	powerW   [3]float64
+	totalW   float64
+
+	importKWH float64
+	exportKWH float64
+	serial    string
+}
+
+// Meter with the register map of profile, it answers once the first reading is set.
+// Registers are read-only, like on a real meter.
+func New(profile string) (*Meter, error) {
+	meter := &Meter{server: modbusserver.NewServer()}
+	meter.server.SetReadOnly(true)
+	switch profile {
+	case ProfileSDM630, "":
+		setupSDM630(meter.server)
+		meter.update = updateSDM630
+	case ProfileSunSpec:
+		setupSunSpec(meter.server)
+		meter.update = updateSunSpec
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, profile)
+	}
+	meter.server.SetOffline(true)
+	return meter, nil
+}
+
+// Set the registers to the reading.
+func (m *Meter) Update(reading *interpreter.RawMeterReading) {
+	m.update(m.server, valuesFromReading(reading))
+
+	m.mutex.Lock()
+	m.updatedAt = time.Now()
+	m.mutex.Unlock()
+	m.server.SetOffline(false)
+}
+
+// Serve Modbus TCP, any unit id is answered.
+func (m *Meter) ListenAndServe(address string) error {
+	go m.watch()
+	return m.server.ListenAndServe(address)
+}
+
+// Stop answering when readings stop arriving.
+func (m *Meter) watch() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mutex.Lock()
+		stale := time.Since(m.updatedAt) > staleAfter
+		m.mutex.Unlock()
+		if stale {
+			m.server.SetOffline(true)
+		}
+	}
+}
+
+// The P1 port reports currents in whole amps, so they follow from power and voltage instead.
+func valuesFromReading(reading *interpreter.RawMeterReading) *meterValues {
+	values := &meterValues{
+		powerW: [3]float64{
+			(reading.L1ConsumptionKW - reading.L1ProductionKW) * 1000,
+			(reading.L2ConsumptionKW - reading.L2ProductionKW) * 1000,
+			(reading.L3ConsumptionKW - reading.L3ProductionKW) * 1000,
+		},
+		totalW:    (reading.CurrentConsumptionKW - reading.CurrentProductionKW) * 1000,
+		importKWH: reading.TotalConsumptionDayKWH + reading.TotalConsumptionNightKWH,
+		exportKWH: reading.TotalProductionDayKWH + reading.TotalProductionNightKWH,
+		serial:    reading.MeterSerialElectricity,
+	}
+	voltages := [3]float64{reading.L1VoltageV, reading.L2VoltageV, reading.L3VoltageV}
+	currents := [3]float64{reading.L1CurrentA, reading.L2CurrentA, reading.L3CurrentA}
+	for phase := range 3 {
+		values.voltageV[phase] = voltages[phase]
+		if values.voltageV[phase] == 0 && values.powerW[phase] != 0 {
+			values.voltageV[phase] = nominalVoltageV
+		}
+		values.currentA[phase] = currents[phase]
+		if values.voltageV[phase] > 0 {
+			values.currentA[phase] = math.Abs(values.powerW[phase]) / values.voltageV[phase]
+		}
+	}
+	return values
+}
+
+// Average of the phases that report a voltage.
+func (v *meterValues) averageVoltageV() float64 {
+	sum, count := 0.0, 0
+	for _, voltage := range v.voltageV {
+		if voltage > 0 {
+			sum += voltage
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// Voltage between two phases, assuming they are 120 degrees apart.
+func lineVoltageV(a float64, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return math.Sqrt(a*a + b*b + a*b)
+}
+
+// Registers of a profile, written to the server in one call.
+type registerBlock []uint16
+
+func (b registerBlock) setFloat32(offset int, value float64) {
+	bits := math.Float32bits(float32(value))
+	b[offset], b[offset+1] = uint16(bits>>16), uint16(bits)
+}
+
+// Rounded and clamped to the int16 range.
+func (b registerBlock) setInt16(offset int, value float64) {
+	b[offset] = uint16(int16(max(min(math.Round(value), math.MaxInt16), math.MinInt16)))
+}
+
+// Rounded and clamped to the uint32 range, high word first.
+func (b registerBlock) setUint32(offset int, value float64) {
+	clamped := uint32(max(min(math.Round(value), math.MaxUint32), 0))
+	b[offset], b[offset+1] = uint16(clamped>>16), uint16(clamped)
+}
+
+// ASCII over length registers, padded with zeros.
+func (b registerBlock) setString(offset int, length int, value string) {
+	data := make([]byte, length*2)
+	copy(data, value)
+	for i := range length {
+		b[offset+i] = uint16(data[i*2])<<8 | uint16(data[i*2+1])
+	}
+}
@@ -0,0 +1,63 @@
+package virtualmeter
+
+import (
+	"math"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/modbusserver"
+)
+
+// Eastron SDM630 input registers, 32 bit floats high word first.
+// Values the P1 port does not report read as zero, the power factor as 1 and the frequency as 50 Hz.
+const (
+	sdm630Voltage        = 0x0000 // Per phase
+	sdm630Current        = 0x0006
+	sdm630Power          = 0x000C
+	sdm630ApparentPower  = 0x0012
+	sdm630ReactivePower  = 0x0018
+	sdm630PowerFactor    = 0x001E
+	sdm630AverageVoltage = 0x002A
+	sdm630AverageCurrent = 0x002E
+	sdm630SumCurrent     = 0x0030
+	sdm630TotalPower     = 0x0034
+	sdm630TotalApparent  = 0x0038
+	sdm630TotalPF        = 0x003E
+	sdm630Frequency      = 0x0046
+	sdm630ImportKWH      = 0x0048
+	sdm630ExportKWH      = 0x004A
+	sdm630LineVoltage    = 0x00C8 // L1-L2, L2-L3, L3-L1
+	sdm630TotalKWH       = 0x0156
+
+	sdm630RegisterCount = 0x0180
+)
+
+func setupSDM630(server *modbusserver.Server) {
+	server.SetRegisters(0, make([]uint16, sdm630RegisterCount)...)
+}
+
+// All registers are set at once, so a read never sees half a reading.
+func updateSDM630(server *modbusserver.Server, values *meterValues) {
+	registers := make(registerBlock, sdm630RegisterCount)
+	sumCurrent, totalApparent := 0.0, 0.0
+	for phase := range 3 {
+		offset := 2 * phase
+		registers.setFloat32(sdm630Voltage+offset, values.voltageV[phase])
+		registers.setFloat32(sdm630Current+offset, values.currentA[phase])
+		registers.setFloat32(sdm630Power+offset, values.powerW[phase])
+		registers.setFloat32(sdm630ApparentPower+offset, math.Abs(values.powerW[phase]))
+		registers.setFloat32(sdm630PowerFactor+offset, 1)
+		registers.setFloat32(sdm630LineVoltage+offset, lineVoltageV(values.voltageV[phase], values.voltageV[(phase+1)%3]))
+		sumCurrent += values.currentA[phase]
+		totalApparent += math.Abs(values.powerW[phase])
+	}
+	registers.setFloat32(sdm630AverageVoltage, values.averageVoltageV())
+	registers.setFloat32(sdm630AverageCurrent, sumCurrent/3)
+	registers.setFloat32(sdm630SumCurrent, sumCurrent)
+	registers.setFloat32(sdm630TotalPower, values.totalW)
+	registers.setFloat32(sdm630TotalApparent, totalApparent)
+	registers.setFloat32(sdm630TotalPF, 1)
+	registers.setFloat32(sdm630Frequency, 50)
+	registers.setFloat32(sdm630ImportKWH, values.importKWH)
+	registers.setFloat32(sdm630ExportKWH, values.exportKWH)
+	registers.setFloat32(sdm630TotalKWH, values.importKWH+values.exportKWH)
+	server.SetRegisters(0, registers...)
+}
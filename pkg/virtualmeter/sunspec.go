@@ -0,0 +1,105 @@
+package virtualmeter
+
+import (
+	"math"
+
+	"github.com/NotCoffee418/european_smart_meter/pkg/modbusserver"
+)
+
+// SunSpec holding registers: the common model followed by a three phase meter (model 203).
+// Values the P1 port does not report read as zero or not implemented.
+const (
+	sunSpecBase = 40000
+
+	sunSpecCommonModel  = 1
+	sunSpecCommonLength = 66
+	sunSpecMeterModel   = 203
+	sunSpecMeterLength  = 105
+	sunSpecEndModel     = 0xFFFF
+
+	sunSpecNotImplemented = 0x8000
+
+	// Offsets in the meter model, after its id and length
+	sunSpecCurrent       = 0 // Total, then per phase
+	sunSpecCurrentSF     = 4
+	sunSpecVoltage       = 5 // Average and per phase, then average and line to line
+	sunSpecVoltageSF     = 13
+	sunSpecFrequency     = 14
+	sunSpecFrequencySF   = 15
+	sunSpecPower         = 16 // Total, then per phase
+	sunSpecPowerSF       = 20
+	sunSpecApparentPower = 21
+	sunSpecApparentSF    = 25
+	sunSpecReactivePower = 26
+	sunSpecReactiveSF    = 30
+	sunSpecPowerFactor   = 31
+	sunSpecPowerFactorSF = 35
+	sunSpecExportWh      = 36 // Total, then per phase, 32 bit
+	sunSpecImportWh      = 44
+	sunSpecEnergySF      = 52
+)
+
+// Registers from the SunS marker up to and including the end model
+const sunSpecRegisterCount = 2 + 2 + sunSpecCommonLength + 2 + sunSpecMeterLength + 2
+
+func setupSunSpec(server *modbusserver.Server) {
+	server.SetRegisters(sunSpecBase, make([]uint16, sunSpecRegisterCount)...)
+}
+
+// All registers are set at once, so a read never sees half a reading.
+func updateSunSpec(server *modbusserver.Server, values *meterValues) {
+	registers := make(registerBlock, sunSpecRegisterCount)
+	registers.setString(0, 2, "SunS")
+
+	common := 2
+	registers[common] = sunSpecCommonModel
+	registers[common+1] = sunSpecCommonLength
+	registers.setString(common+2, 16, "European Smart Meter")
+	registers.setString(common+18, 16, "Virtual Meter")
+	registers.setString(common+50, 16, values.serial)
+	registers[common+66] = 1 // Device address
+
+	meter := common + 2 + sunSpecCommonLength
+	registers[meter] = sunSpecMeterModel
+	registers[meter+1] = sunSpecMeterLength
+	data := meter + 2
+
+	sumCurrent, totalApparent := 0.0, 0.0
+	sumLineVoltage, lineCount := 0.0, 0
+	for phase := range 3 {
+		lineVoltage := lineVoltageV(values.voltageV[phase], values.voltageV[(phase+1)%3])
+		if lineVoltage > 0 {
+			sumLineVoltage += lineVoltage
+			lineCount++
+		}
+		registers.setInt16(data+sunSpecCurrent+1+phase, values.currentA[phase]*100)
+		registers.setInt16(data+sunSpecVoltage+1+phase, values.voltageV[phase]*10)
+		registers.setInt16(data+sunSpecVoltage+5+phase, lineVoltage*10)
+		registers.setInt16(data+sunSpecPower+1+phase, values.powerW[phase])
+		registers.setInt16(data+sunSpecApparentPower+1+phase, math.Abs(values.powerW[phase]))
+		registers.setInt16(data+sunSpecPowerFactor+1+phase, 100)
+		sumCurrent += values.currentA[phase]
+		totalApparent += math.Abs(values.powerW[phase])
+	}
+	registers.setInt16(data+sunSpecCurrent, sumCurrent*100)
+	registers.setInt16(data+sunSpecCurrentSF, -2)
+	registers.setInt16(data+sunSpecVoltage, values.averageVoltageV()*10)
+	if lineCount > 0 {
+		registers.setInt16(data+sunSpecVoltage+4, sumLineVoltage/float64(lineCount)*10)
+	}
+	registers.setInt16(data+sunSpecVoltageSF, -1)
+	registers.setInt16(data+sunSpecFrequency, 5000)
+	registers.setInt16(data+sunSpecFrequencySF, -2)
+	registers.setInt16(data+sunSpecPower, values.totalW)
+	registers.setInt16(data+sunSpecApparentPower, totalApparent)
+	registers.setInt16(data+sunSpecPowerFactor, 100)
+	for i := range 5 {
+		registers[data+sunSpecReactivePower+i] = sunSpecNotImplemented
+	}
+	registers.setInt16(data+sunSpecReactiveSF, 0)
+	registers.setUint32(data+sunSpecExportWh, values.exportKWH*1000)
+	registers.setUint32(data+sunSpecImportWh, values.importKWH*1000)
+
+	registers[data+sunSpecMeterLength] = sunSpecEndModel
+	server.SetRegisters(sunSpecBase, registers...)
+}